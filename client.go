@@ -1,7 +1,13 @@
 package goipmi
 
 import (
+	"bytes"
+	"context"
 	"errors"
+	"io"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/runner-mei/goipmi/protocol"
 	"github.com/runner-mei/goipmi/protocol/commands"
@@ -25,15 +31,20 @@ var (
 )
 
 type ConnectionOption = protocol.ConnectionOption
+type CipherSuite = protocol.CipherSuite
+type Target = protocol.Target
+type SOLConn = protocol.SOLConn
 
 type ClientHandler interface {
 	Open() error
+	OpenContext(ctx context.Context) error
 	Close() error
 	IsConnected() bool
 	//Send(req *Request, resp *Response) error
 	//DeviceID() (*DeviceIDResponse, error)
 
 	Exec(cmd commands.CommandCode, req, resp interface{}) error
+	ExecContext(ctx context.Context, cmd commands.CommandCode, req, resp interface{}) error
 }
 
 func NewClient(opt *protocol.ConnectionOption) (*Client, error) {
@@ -52,112 +63,842 @@ func (c *Client) IsConnected() bool {
 	return c.ClientHandler.IsConnected()
 }
 
+// ActiveInterface returns the interface of the session, it is "lan" or
+// "lanplus" once the "auto" interface has been negotiated by Open.
+func (c *Client) ActiveInterface() string {
+	if h, ok := c.ClientHandler.(interface {
+		ActiveInterface() string
+	}); ok {
+		return h.ActiveInterface()
+	}
+	return ""
+}
+
+// ExecTarget is like Exec but the request is sent to the controller at
+// target, e.g. the owner of a sensor, by bridging it through the BMC.
+func (c *Client) ExecTarget(target Target, cmd commands.CommandCode, req, resp interface{}) error {
+	return c.ExecTargetContext(context.Background(), target, cmd, req, resp)
+}
+
+func (c *Client) ExecTargetContext(ctx context.Context, target Target, cmd commands.CommandCode, req, resp interface{}) error {
+	if target.IsBMC() && target.LUN == 0 {
+		return c.ExecContext(ctx, cmd, req, resp)
+	}
+	if h, ok := c.ClientHandler.(interface {
+		ExecTargetContext(ctx context.Context, target Target, cmd commands.CommandCode, req, resp interface{}) error
+	}); ok {
+		return h.ExecTargetContext(ctx, target, cmd, req, resp)
+	}
+	return errors.New("bridging is unsupported by the client")
+}
+
+// ActivateSOL activates the SOL payload instance and returns the host serial
+// console, it is a *SOLConn that also sends breaks and flushes.
+func (c *Client) ActivateSOL(instance uint8) (io.ReadWriteCloser, error) {
+	return c.ActivateSOLContext(context.Background(), instance)
+}
+
+func (c *Client) ActivateSOLContext(ctx context.Context, instance uint8) (io.ReadWriteCloser, error) {
+	if h, ok := c.ClientHandler.(interface {
+		ActivateSOLContext(ctx context.Context, instance uint8) (io.ReadWriteCloser, error)
+	}); ok {
+		return h.ActivateSOLContext(ctx, instance)
+	}
+	return nil, errors.New("SOL is unsupported by the client")
+}
+
 // DeviceID get the Device ID of the BMC
 func (c *Client) GetDeviceID() (*DeviceIDResponse, error) {
+	return c.GetDeviceIDContext(context.Background())
+}
+
+func (c *Client) GetDeviceIDContext(ctx context.Context) (*DeviceIDResponse, error) {
 	req := &DeviceIDRequest{}
 	resp := &DeviceIDResponse{}
-	return resp, c.Exec(GetDeviceID, req, resp)
+	return resp, c.ExecContext(ctx, GetDeviceID, req, resp)
+}
+
+// GetDeviceGUID get the GUID of the BMC
+func (c *Client) GetDeviceGUID() (string, error) {
+	return c.GetDeviceGUIDContext(context.Background())
+}
+
+func (c *Client) GetDeviceGUIDContext(ctx context.Context) (string, error) {
+	var getDeviceGuidRequest GetDeviceGuidRequest
+	var getDeviceGuidResponse GetDeviceGuidResponse
+	if err := c.ExecContext(ctx, GetDeviceGUID, &getDeviceGuidRequest, &getDeviceGuidResponse); err != nil {
+		return "", err
+	}
+	return formatGUID(getDeviceGuidResponse.Guid[:]), nil
+}
+
+// GetChannelCipherSuites get the cipher suites supported by the channel
+func (c *Client) GetChannelCipherSuites(channel uint8) ([]CipherSuite, error) {
+	return c.GetChannelCipherSuitesContext(context.Background(), channel)
+}
+
+func (c *Client) GetChannelCipherSuitesContext(ctx context.Context, channel uint8) ([]CipherSuite, error) {
+	return protocol.ReadChannelCipherSuites(ctx, channel, c.ExecContext)
 }
 
 func (c *Client) GetACPIPowerState() (*GetACPIPowerStateResponse, error) {
+	return c.GetACPIPowerStateContext(context.Background())
+}
+
+func (c *Client) GetACPIPowerStateContext(ctx context.Context) (*GetACPIPowerStateResponse, error) {
 	var getACPIPowerStateRequest GetACPIPowerStateRequest
 	var getACPIPowerStateResponse GetACPIPowerStateResponse
-	return &getACPIPowerStateResponse, c.Exec(GetACPIPowerState,
+	return &getACPIPowerStateResponse, c.ExecContext(ctx, GetACPIPowerState,
 		&getACPIPowerStateRequest,
 		&getACPIPowerStateResponse)
 }
 
 func (c *Client) GetChassisCapabilities() (*GetChassisCapabilitiesResponse, error) {
+	return c.GetChassisCapabilitiesContext(context.Background())
+}
+
+func (c *Client) GetChassisCapabilitiesContext(ctx context.Context) (*GetChassisCapabilitiesResponse, error) {
 	var getChassisCapabilitiesRequest GetChassisCapabilitiesRequest
 	var getChassisCapabilitiesResponse GetChassisCapabilitiesResponse
 	return &getChassisCapabilitiesResponse,
-		c.Exec(GetChassisCapabilities,
+		c.ExecContext(ctx, GetChassisCapabilities,
 			&getChassisCapabilitiesRequest,
 			&getChassisCapabilitiesResponse)
 }
 
 func (c *Client) GetChassisStatus() (*GetChassisStatusResponse, error) {
+	return c.GetChassisStatusContext(context.Background())
+}
+
+func (c *Client) GetChassisStatusContext(ctx context.Context) (*GetChassisStatusResponse, error) {
 	var getChassisStatusRequest GetChassisStatusRequest
 	var getChassisStatusResponse GetChassisStatusResponse
 	return &getChassisStatusResponse,
-		c.Exec(GetChassisStatus,
+		c.ExecContext(ctx, GetChassisStatus,
 			&getChassisStatusRequest,
 			&getChassisStatusResponse)
 }
 
 func (c *Client) GetSystemRestartCause() (*GetSystemRestartCauseResponse, error) {
+	return c.GetSystemRestartCauseContext(context.Background())
+}
+
+func (c *Client) GetSystemRestartCauseContext(ctx context.Context) (*GetSystemRestartCauseResponse, error) {
 	var getSystemRestartCauseRequest GetSystemRestartCauseRequest
 	var getSystemRestartCauseResponse GetSystemRestartCauseResponse
 	return &getSystemRestartCauseResponse,
-		c.Exec(GetSystemRestartCause,
+		c.ExecContext(ctx, GetSystemRestartCause,
 			&getSystemRestartCauseRequest,
 			&getSystemRestartCauseResponse)
 }
 
 func (c *Client) GetSDRRepositoryInfo() (*GetSDRInfoResponse, error) {
+	return c.GetSDRRepositoryInfoContext(context.Background())
+}
+
+func (c *Client) GetSDRRepositoryInfoContext(ctx context.Context) (*GetSDRInfoResponse, error) {
 	var getSDRInfoRequest GetSDRInfoRequest
 	var getSDRInfoResponse GetSDRInfoResponse
 	return &getSDRInfoResponse,
-		c.Exec(GetSDRRepositoryInfo,
+		c.ExecContext(ctx, GetSDRRepositoryInfo,
 			&getSDRInfoRequest,
 			&getSDRInfoResponse)
 }
 
 func (c *Client) GetReserveSDRRepository() (*ReserveSDRResponse, error) {
+	return c.GetReserveSDRRepositoryContext(context.Background())
+}
+
+func (c *Client) GetReserveSDRRepositoryContext(ctx context.Context) (*ReserveSDRResponse, error) {
 	var reserveSDRRequest ReserveSDRRequest
 	var reserveSDRResponse ReserveSDRResponse
 	return &reserveSDRResponse,
-		c.Exec(ReserveSDRRepository,
+		c.ExecContext(ctx, ReserveSDRRepository,
 			&reserveSDRRequest,
 			&reserveSDRResponse)
 }
 
 func (c *Client) GetSensorReading(number uint8) (*GetSensorReadingResponse, error) {
+	return c.GetSensorReadingContext(context.Background(), number)
+}
+
+func (c *Client) GetSensorReadingContext(ctx context.Context, number uint8) (*GetSensorReadingResponse, error) {
+	return c.GetSensorReadingTargetContext(ctx, Target{}, number)
+}
+
+// GetSensorReadingTargetContext reads the sensor of the controller at target.
+func (c *Client) GetSensorReadingTargetContext(ctx context.Context, target Target, number uint8) (*GetSensorReadingResponse, error) {
 	var getSensorReadingRequest GetSensorReadingRequest
 	var getSensorReadingResponse GetSensorReadingResponse
 
 	getSensorReadingRequest.Number = number
 	return &getSensorReadingResponse,
-		c.Exec(GetSensorReading,
+		c.ExecTargetContext(ctx, target, GetSensorReading,
 			&getSensorReadingRequest,
 			&getSensorReadingResponse)
 }
 
 func (c *Client) GetSensorHysteresis(number uint8) (*GetSensorHysteresisResponse, error) {
+	return c.GetSensorHysteresisContext(context.Background(), number)
+}
+
+func (c *Client) GetSensorHysteresisContext(ctx context.Context, number uint8) (*GetSensorHysteresisResponse, error) {
 	var getSensorHysteresisRequest GetSensorHysteresisRequest
 	var getSensorHysteresisResponse GetSensorHysteresisResponse
 
 	getSensorHysteresisRequest.Number = number
 	return &getSensorHysteresisResponse,
-		c.Exec(GetSensorHysteresis,
+		c.ExecContext(ctx, GetSensorHysteresis,
 			&getSensorHysteresisRequest,
 			&getSensorHysteresisResponse)
 }
 
 func (c *Client) GetSensorThresholds(number uint8) (*GetSensorThresholdsResponse, error) {
+	return c.GetSensorThresholdsContext(context.Background(), number)
+}
+
+func (c *Client) GetSensorThresholdsContext(ctx context.Context, number uint8) (*GetSensorThresholdsResponse, error) {
+	return c.GetSensorThresholdsTargetContext(ctx, Target{}, number)
+}
+
+// GetSensorThresholdsTargetContext gets the thresholds of the sensor of the
+// controller at target.
+func (c *Client) GetSensorThresholdsTargetContext(ctx context.Context, target Target, number uint8) (*GetSensorThresholdsResponse, error) {
 	var getSensorThresholdsRequest GetSensorThresholdsRequest
 	var getSensorThresholdsResponse GetSensorThresholdsResponse
 
 	getSensorThresholdsRequest.Number = number
 	return &getSensorThresholdsResponse,
-		c.Exec(GetSensorThresholds,
+		c.ExecTargetContext(ctx, target, GetSensorThresholds,
 			&getSensorThresholdsRequest,
 			&getSensorThresholdsResponse)
 }
 
+// GetSensorReadingFactors gets the factors of the reading of the sensor of
+// the record, they are of the readings from the reading up to the one before
+// the next reading of the response per section 35.5.
+func (c *Client) GetSensorReadingFactors(record *FullSensorRecord, reading uint8) (*GetSensorReadingFactorsResponse, error) {
+	return c.GetSensorReadingFactorsContext(context.Background(), record, reading)
+}
+
+func (c *Client) GetSensorReadingFactorsContext(ctx context.Context, record *FullSensorRecord, reading uint8) (*GetSensorReadingFactorsResponse, error) {
+	var getSensorReadingFactorsRequest = GetSensorReadingFactorsRequest{Number: record.SensorNumber, ReadingByte: reading}
+	var getSensorReadingFactorsResponse GetSensorReadingFactorsResponse
+	return &getSensorReadingFactorsResponse,
+		c.ExecTargetContext(ctx, record.Owner(), GetSensorReadingFactors,
+			&getSensorReadingFactorsRequest,
+			&getSensorReadingFactorsResponse)
+}
+
+// CalcSensorReading converts the reading of the sensor of the record as
+// Calc, the reading of a non-linear sensor is converted with the factors of
+// GetSensorReadingFactors.
+func (c *Client) CalcSensorReading(record *FullSensorRecord, reading uint8) (float64, error) {
+	return c.CalcSensorReadingContext(context.Background(), record, reading)
+}
+
+func (c *Client) CalcSensorReadingContext(ctx context.Context, record *FullSensorRecord, reading uint8) (float64, error) {
+	factors, err := c.sensorFactors(ctx, nil, record, reading)
+	if err != nil {
+		return 0, err
+	}
+	return calcSensorValue(record, reading, factors)
+}
+
+// sensorFactors returns the factors of the reading of a non-linear sensor,
+// it returns nil for the other sensors. The factors are looked up in the
+// cache first if it isn't nil.
+func (c *Client) sensorFactors(ctx context.Context, cache *sensorFactorsCache, record *FullSensorRecord, reading uint8) (*GetSensorReadingFactorsResponse, error) {
+	if !record.IsNonLinear() {
+		return nil, nil
+	}
+	if factors := cache.load(record, reading); factors != nil {
+		return factors, nil
+	}
+	factors, err := c.GetSensorReadingFactorsContext(ctx, record, reading)
+	if err != nil {
+		return nil, errors.New("get sensor reading factors, " + err.Error())
+	}
+	cache.store(record, reading, factors)
+	return factors, nil
+}
+
+type sensorFactorsKey struct {
+	owner  Target
+	number uint8
+}
+
+// sensorFactorsRange is the factors of the readings from first to last.
+type sensorFactorsRange struct {
+	first, last uint8
+	factors     *GetSensorReadingFactorsResponse
+}
+
+// sensorFactorsCache caches the factors of the non-linear sensors while the
+// sensors are read by ReadSensors, a nil cache caches nothing.
+type sensorFactorsCache struct {
+	mu     sync.Mutex
+	ranges map[sensorFactorsKey][]sensorFactorsRange
+}
+
+func (self *sensorFactorsCache) load(record *FullSensorRecord, reading uint8) *GetSensorReadingFactorsResponse {
+	if self == nil {
+		return nil
+	}
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	for _, r := range self.ranges[sensorFactorsKey{owner: record.Owner(), number: record.SensorNumber}] {
+		if r.first <= reading && reading <= r.last {
+			return r.factors
+		}
+	}
+	return nil
+}
+
+func (self *sensorFactorsCache) store(record *FullSensorRecord, reading uint8, factors *GetSensorReadingFactorsResponse) {
+	if self == nil {
+		return
+	}
+	// the factors are of the reading only if the next reading isn't greater
+	last := reading
+	if factors.NextReading > reading {
+		last = factors.NextReading - 1
+	}
+	key := sensorFactorsKey{owner: record.Owner(), number: record.SensorNumber}
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	if self.ranges == nil {
+		self.ranges = map[sensorFactorsKey][]sensorFactorsRange{}
+	}
+	self.ranges[key] = append(self.ranges[key], sensorFactorsRange{first: reading, last: last, factors: factors})
+}
+
+// SetSensorThresholds sets the thresholds of the sensor of the record, the
+// thresholds are in the engineering units and the nil thresholds aren't
+// changed. It returns an error if a threshold isn't settable per the record.
+func (c *Client) SetSensorThresholds(record *FullSensorRecord, thresholds SensorThresholds) error {
+	return c.SetSensorThresholdsContext(context.Background(), record, thresholds)
+}
+
+func (c *Client) SetSensorThresholdsContext(ctx context.Context, record *FullSensorRecord, thresholds SensorThresholds) error {
+	var setSensorThresholdsRequest = SetSensorThresholdsRequest{Number: record.SensorNumber}
+	var setSensorThresholdsResponse SetSensorThresholdsResponse
+
+	settable := record.Masks[5] & 0x3f
+	for _, threshold := range []struct {
+		name  string
+		mask  uint8
+		value *float64
+		raw   *uint8
+	}{
+		{"lower non-critical", ThresholdLowerNonCritical, thresholds.LowerNonCritical, &setSensorThresholdsRequest.LowerNonCriticalThreshold},
+		{"lower critical", ThresholdLowerCritical, thresholds.LowerCritical, &setSensorThresholdsRequest.LowerCriticalThreshold},
+		{"lower non-recoverable", ThresholdLowerNonRecoverable, thresholds.LowerNonRecoverable, &setSensorThresholdsRequest.LowerNonrecoverableThreshold},
+		{"upper non-critical", ThresholdUpperNonCritical, thresholds.UpperNonCritical, &setSensorThresholdsRequest.UpperNonCriticalThreshold},
+		{"upper critical", ThresholdUpperCritical, thresholds.UpperCritical, &setSensorThresholdsRequest.UpperCriticalThreshold},
+		{"upper non-recoverable", ThresholdUpperNonRecoverable, thresholds.UpperNonRecoverable, &setSensorThresholdsRequest.UpperNonrecoverableThreshold},
+	} {
+		if threshold.value == nil {
+			continue
+		}
+		if settable&threshold.mask == 0 {
+			return errors.New("the " + threshold.name + " threshold of '" + record.IdString + "' isn't settable.")
+		}
+		raw, err := record.RawValue(*threshold.value)
+		if err != nil {
+			return errors.New("the " + threshold.name + " threshold of '" + record.IdString + "', " + err.Error())
+		}
+		*threshold.raw = raw
+		setSensorThresholdsRequest.Flags |= threshold.mask
+	}
+	if setSensorThresholdsRequest.Flags == 0 {
+		return nil
+	}
+	return c.ExecTargetContext(ctx, record.Owner(), SetSensorThresholds,
+		&setSensorThresholdsRequest,
+		&setSensorThresholdsResponse)
+}
+
+// SetSensorHysteresis sets the positive-going and negative-going hysteresis
+// of the sensor of the record in the engineering units, it returns an error
+// if the hysteresis isn't settable per the record.
+func (c *Client) SetSensorHysteresis(record *FullSensorRecord, positive, negative float64) error {
+	return c.SetSensorHysteresisContext(context.Background(), record, positive, negative)
+}
+
+func (c *Client) SetSensorHysteresisContext(ctx context.Context, record *FullSensorRecord, positive, negative float64) error {
+	if (record.SensorCapablilities>>4)&0x03 != 0x02 {
+		return errors.New("the hysteresis of '" + record.IdString + "' isn't settable.")
+	}
+
+	var setSensorHysteresisRequest = SetSensorHysteresisRequest{Number: record.SensorNumber}
+	var setSensorHysteresisResponse SetSensorHysteresisResponse
+	var err error
+	if setSensorHysteresisRequest.Positive_ThresholdHysteresisValue, err = record.RawHysteresis(positive); err != nil {
+		return err
+	}
+	if setSensorHysteresisRequest.Negative_ThresholdHysteresisValue, err = record.RawHysteresis(negative); err != nil {
+		return err
+	}
+	return c.ExecTargetContext(ctx, record.Owner(), SetSensorHysteresis,
+		&setSensorHysteresisRequest,
+		&setSensorHysteresisResponse)
+}
+
+// SetSensorEventEnable enables or disables the events of the sensor of the
+// controller at target.
+func (c *Client) SetSensorEventEnable(target Target, req *SetSensorEventEnableRequest) error {
+	return c.SetSensorEventEnableContext(context.Background(), target, req)
+}
+
+func (c *Client) SetSensorEventEnableContext(ctx context.Context, target Target, req *SetSensorEventEnableRequest) error {
+	var setSensorEventEnableResponse SetSensorEventEnableResponse
+	return c.ExecTargetContext(ctx, target, SetSensorEventEnable, req, &setSensorEventEnableResponse)
+}
+
+// RearmSensorEvents re-arms the events of the sensor of the controller at
+// target.
+func (c *Client) RearmSensorEvents(target Target, req *RearmSensorEventsRequest) error {
+	return c.RearmSensorEventsContext(context.Background(), target, req)
+}
+
+func (c *Client) RearmSensorEventsContext(ctx context.Context, target Target, req *RearmSensorEventsRequest) error {
+	var rearmSensorEventsResponse RearmSensorEventsResponse
+	return c.ExecTargetContext(ctx, target, ReArmSensorEvents, req, &rearmSensorEventsResponse)
+}
+
 func (c *Client) GetPOH() (*GetPOHCounterResponse, error) {
+	return c.GetPOHContext(context.Background())
+}
+
+func (c *Client) GetPOHContext(ctx context.Context) (*GetPOHCounterResponse, error) {
 	var getPOHCounterRequest GetPOHCounterRequest
 	var getPOHCounterResponse GetPOHCounterResponse
 	return &getPOHCounterResponse,
-		c.Exec(GetPOHCounter,
+		c.ExecContext(ctx, GetPOHCounter,
 			&getPOHCounterRequest,
 			&getPOHCounterResponse)
 }
 
+// GetSOLConfigParameter reads the SOL configuration parameter of the channel
+// into param, the channel 0x0e is the channel of the session.
+func (c *Client) GetSOLConfigParameter(channel uint8, param SOLConfigParameter) error {
+	return c.GetSOLConfigParameterContext(context.Background(), channel, param)
+}
+
+func (c *Client) GetSOLConfigParameterContext(ctx context.Context, channel uint8, param SOLConfigParameter) error {
+	req := GetSOLConfigRequest{Channel: channel, Selector: param.Selector()}
+	resp := GetSOLConfigResponse{Parameter: param}
+	return c.ExecContext(ctx, GetSOLConfigurationParameters, &req, &resp)
+}
+
+func (c *Client) SetSOLConfigParameter(channel uint8, param SOLConfigParameter) error {
+	return c.SetSOLConfigParameterContext(context.Background(), channel, param)
+}
+
+func (c *Client) SetSOLConfigParameterContext(ctx context.Context, channel uint8, param SOLConfigParameter) error {
+	req := SetSOLConfigRequest{Channel: channel, Parameter: param}
+	resp := SetSOLConfigResponse{}
+	return c.ExecContext(ctx, SetSOLConfigurationParameters, &req, &resp)
+}
+
+// GetSOLConfig reads the SOL configuration of the channel, the parameters
+// that are unsupported by the BMC are left zero.
+func (c *Client) GetSOLConfig(channel uint8) (*SOLConfig, error) {
+	return c.GetSOLConfigContext(context.Background(), channel)
+}
+
+func (c *Client) GetSOLConfigContext(ctx context.Context, channel uint8) (*SOLConfig, error) {
+	var config SOLConfig
+	for _, param := range config.Parameters() {
+		if err := c.GetSOLConfigParameterContext(ctx, channel, param); err != nil {
+			if err == ErrSOLParamUnsupported {
+				continue
+			}
+			return nil, err
+		}
+	}
+	return &config, nil
+}
+
+// SetSOLConfig sets the SOL configuration parameters of the channel, they are
+// set while the set in progress parameter is SOLSetInProgress so that the
+// other parties don't see a partial configuration. ErrSOLSetInProgress is
+// returned if another party is setting the parameters.
+func (c *Client) SetSOLConfig(channel uint8, params ...SOLConfigParameter) error {
+	return c.SetSOLConfigContext(context.Background(), channel, params...)
+}
+
+func (c *Client) SetSOLConfigContext(ctx context.Context, channel uint8, params ...SOLConfigParameter) error {
+	err := c.SetSOLConfigParameterContext(ctx, channel, &SOLSetInProgressParam{State: SOLSetInProgress})
+	inProgress := err == nil
+	if err != nil && err != ErrSOLParamUnsupported { // set in progress is optional
+		return err
+	}
+
+	err = nil
+	for _, param := range params {
+		if err = c.SetSOLConfigParameterContext(ctx, channel, param); err != nil {
+			break
+		}
+	}
+
+	if inProgress {
+		// set complete even if ctx is done, otherwise the parameters are
+		// locked until the BMC is reset
+		e := c.SetSOLConfigParameterContext(context.Background(), channel, &SOLSetInProgressParam{State: SOLSetComplete})
+		if err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// the FRU data is read by 32 bytes, the count is shrunk by 8 bytes if the
+// BMC can't return it.
+const (
+	fruReadLength   = 32
+	fruShrinkLength = 8
+)
+
+// ReadFRU reads and parses the FRU information of the logical FRU device.
+func (c *Client) ReadFRU(deviceID uint8) (*FRUInventory, error) {
+	return c.ReadFRUContext(context.Background(), deviceID)
+}
+
+func (c *Client) ReadFRUContext(ctx context.Context, deviceID uint8) (*FRUInventory, error) {
+	data, err := c.ReadFRUBytesContext(ctx, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	return ParseFRU(data)
+}
+
+// ReadFRUBytes reads the whole FRU inventory area of the logical FRU device.
+func (c *Client) ReadFRUBytes(deviceID uint8) ([]byte, error) {
+	return c.ReadFRUBytesContext(context.Background(), deviceID)
+}
+
+func (c *Client) ReadFRUBytesContext(ctx context.Context, deviceID uint8) ([]byte, error) {
+	info, err := c.getFRUInventoryAreaInfo(ctx, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	return c.readFRUData(ctx, deviceID, info, 0, int(info.AreaSize))
+}
+
+// WriteFRU writes data at offset of the logical FRU device, the data is read
+// back to verify that it is written.
+func (c *Client) WriteFRU(deviceID uint8, offset uint16, data []byte) error {
+	return c.WriteFRUContext(context.Background(), deviceID, offset, data)
+}
+
+func (c *Client) WriteFRUContext(ctx context.Context, deviceID uint8, offset uint16, data []byte) error {
+	info, err := c.getFRUInventoryAreaInfo(ctx, deviceID)
+	if err != nil {
+		return err
+	}
+	return c.writeFRUData(ctx, deviceID, info, int(offset), data)
+}
+
+// SetProductAssetTag sets the asset tag of the product info area.
+func (c *Client) SetProductAssetTag(deviceID uint8, tag string) error {
+	return c.SetProductAssetTagContext(context.Background(), deviceID, tag)
+}
+
+func (c *Client) SetProductAssetTagContext(ctx context.Context, deviceID uint8, tag string) error {
+	return c.updateFRU(ctx, deviceID, func(fru *FRUInventory) error {
+		if fru.Product == nil {
+			return errors.New("FRU product area isn't present.")
+		}
+		fru.Product.AssetTag = tag
+		return nil
+	})
+}
+
+// SetBoardField sets the field of the board info area.
+func (c *Client) SetBoardField(deviceID uint8, field FRUBoardField, value string) error {
+	return c.SetBoardFieldContext(context.Background(), deviceID, field, value)
+}
+
+func (c *Client) SetBoardFieldContext(ctx context.Context, deviceID uint8, field FRUBoardField, value string) error {
+	return c.updateFRU(ctx, deviceID, func(fru *FRUInventory) error {
+		if fru.Board == nil {
+			return errors.New("FRU board area isn't present.")
+		}
+		fru.Board.SetField(field, value)
+		return nil
+	})
+}
+
+// updateFRU reads the FRU information, updates it and writes the bytes that
+// are changed only.
+func (c *Client) updateFRU(ctx context.Context, deviceID uint8, update func(fru *FRUInventory) error) error {
+	info, err := c.getFRUInventoryAreaInfo(ctx, deviceID)
+	if err != nil {
+		return err
+	}
+	data, err := c.readFRUData(ctx, deviceID, info, 0, int(info.AreaSize))
+	if err != nil {
+		return err
+	}
+	origin, err := ParseFRU(data)
+	if err != nil {
+		return err
+	}
+	fru, _ := ParseFRU(data)
+	if err := update(fru); err != nil {
+		return err
+	}
+	updated, err := encodeFRUUpdate(data, origin, fru)
+	if err != nil {
+		return err
+	}
+
+	start, end := 0, len(data)
+	for start < end && data[start] == updated[start] {
+		start++
+	}
+	for end > start && data[end-1] == updated[end-1] {
+		end--
+	}
+	if start == end {
+		return nil
+	}
+	if info.ByWords() {
+		start &^= 1
+		end += end & 1
+	}
+	return c.writeFRUData(ctx, deviceID, info, start, updated[start:end])
+}
+
+func (c *Client) getFRUInventoryAreaInfo(ctx context.Context, deviceID uint8) (*GetFRUInventoryAreaInfoResponse, error) {
+	var infoRequest = GetFRUInventoryAreaInfoRequest{DeviceID: deviceID}
+	var infoResponse GetFRUInventoryAreaInfoResponse
+	if e := c.ExecContext(ctx, GetFRUInventoryAreaInfo, &infoRequest, &infoResponse); e != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, errors.New("get FRU inventory area info, " + e.Error())
+	}
+	return &infoResponse, nil
+}
+
+func (c *Client) readFRUData(ctx context.Context, deviceID uint8, info *GetFRUInventoryAreaInfoResponse, offset, size int) ([]byte, error) {
+	data := make([]byte, 0, size)
+	length := fruReadLength
+	for len(data) < size {
+		count := size - len(data)
+		if count > length {
+			count = length
+		}
+		var readRequest = ReadFRUDataRequest{
+			DeviceID: deviceID,
+			Offset:   uint16(offset + len(data)),
+			Count:    uint8(count)}
+		if info.ByWords() {
+			readRequest.Offset /= 2
+			readRequest.Count = uint8((count + 1) / 2)
+		}
+		var readResponse ReadFRUDataResponse
+
+		if e := c.ExecContext(ctx, ReadFRUData, &readRequest, &readResponse); e != nil {
+			if (e == protocol.ErrLongPacket || e == ErrRequestData) && length > fruShrinkLength {
+				length -= fruShrinkLength
+				continue
+			}
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return nil, errors.New("read FRU data, " + e.Error())
+		}
+		if len(readResponse.Data) == 0 {
+			return nil, errors.New("read FRU data, no data is returned.")
+		}
+		data = append(data, readResponse.Data...)
+	}
+	return data[:size], nil
+}
+
+func (c *Client) writeFRUData(ctx context.Context, deviceID uint8, info *GetFRUInventoryAreaInfoResponse, offset int, data []byte) error {
+	if offset+len(data) > int(info.AreaSize) {
+		return errors.New("write FRU data, the data is out of the FRU inventory area.")
+	}
+	if info.ByWords() && (offset%2 != 0 || len(data)%2 != 0) {
+		return errors.New("write FRU data, the FRU device is accessed by words.")
+	}
+
+	written := 0
+	length := fruReadLength
+	for written < len(data) {
+		count := len(data) - written
+		if count > length {
+			count = length
+		}
+		var writeRequest = WriteFRUDataRequest{
+			DeviceID: deviceID,
+			Offset:   uint16(offset + written),
+			Data:     data[written : written+count]}
+		if info.ByWords() {
+			writeRequest.Offset /= 2
+		}
+		var writeResponse WriteFRUDataResponse
+
+		if e := c.ExecContext(ctx, WriteFRUData, &writeRequest, &writeResponse); e != nil {
+			if (e == protocol.ErrLongPacket || e == ErrRequestData) && length > fruShrinkLength {
+				length -= fruShrinkLength
+				continue
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return errors.New("write FRU data, " + e.Error())
+		}
+		n := int(writeResponse.Count)
+		if info.ByWords() {
+			n *= 2
+		}
+		if n == 0 || n > count {
+			return errors.New("write FRU data, " + strconv.Itoa(n) + " bytes are written.")
+		}
+		written += n
+	}
+
+	bs, err := c.readFRUData(ctx, deviceID, info, offset, len(data))
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(bs, data) {
+		return errors.New("write FRU data, the data that is read back is different.")
+	}
+	return nil
+}
+
 const BLOCK_LENGTH = 16
 
 func (c *Client) ListSDR(reservationId uint16) ([]Record, error) {
-	var results = make([]Record, 0, 32)
+	return c.ListSDRContext(context.Background(), reservationId)
+}
+
+func (c *Client) ListSDRContext(ctx context.Context, reservationId uint16) ([]Record, error) {
+	list, err := c.listSDRData(ctx, reservationId)
+	if err != nil {
+		return nil, err
+	}
+	records, err := toSdrRecords(list)
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// ListSDRCached reads the records of the SDR repository as ListSDR, the
+// records are read from the cache if the repository isn't changed since they
+// are stored, otherwise they are read from the BMC and stored to the cache.
+// The cache isn't used if the BMC doesn't support the GUID.
+func (c *Client) ListSDRCached(cache SDRCache) ([]Record, error) {
+	return c.ListSDRCachedContext(context.Background(), cache)
+}
+
+func (c *Client) ListSDRCachedContext(ctx context.Context, cache SDRCache) ([]Record, error) {
+	key, err := c.SDRCacheKeyContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if key == "" {
+		reserve, err := c.GetReserveSDRRepositoryContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return c.ListSDRContext(ctx, reserve.Id)
+	}
+	info, err := c.GetSDRRepositoryInfoContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// an entry that can't be loaded is read again from the BMC and replaced
+	entry, err := cache.Load(key)
+	if err == nil && entry != nil && entry.IsValid(info) {
+		list := make([]RecordData, len(entry.Records))
+		for i, bs := range entry.Records {
+			list[i].Data = bs
+		}
+		// a record that can't be parsed is read again from the BMC
+		if records, err := toSdrRecords(list); err == nil {
+			return records, nil
+		}
+	}
+
+	reserve, err := c.GetReserveSDRRepositoryContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	list, err := c.listSDRData(ctx, reserve.Id)
+	if err != nil {
+		return nil, err
+	}
+	records, err := toSdrRecords(list)
+	if err != nil {
+		return nil, err
+	}
+
+	entry = &SDRCacheEntry{
+		RecentAddTimestamp: info.RecentAddTimestamp,
+		RecentDelTimestamp: info.RecentDelTimestamp,
+		RecordCount:        info.RecordCount,
+		Records:            make([][]byte, len(list)),
+	}
+	for i := range list {
+		entry.Records[i] = list[i].Data
+	}
+	// the records are read already, so they are returned even if the cache
+	// can't be written
+	_ = cache.Store(key, entry)
+	return records, nil
+}
+
+// SDRCacheKey returns the key of the BMC in the SDR cache, it is the
+// manufacturer, product and device id and the GUID of the BMC. The key is
+// empty if the GUID isn't supported, the BMCs of the same product can't be
+// told apart without it.
+func (c *Client) SDRCacheKey() (string, error) {
+	return c.SDRCacheKeyContext(context.Background())
+}
+
+func (c *Client) SDRCacheKeyContext(ctx context.Context) (string, error) {
+	deviceID, err := c.GetDeviceIDContext(ctx)
+	if err != nil {
+		return "", err
+	}
+	guid, err := c.GetDeviceGUIDContext(ctx)
+	if err != nil {
+		if _, ok := err.(protocol.CompletionCode); !ok {
+			return "", err
+		}
+		return "", nil
+	}
+	return strconv.Itoa(int(deviceID.ManufacturerID)) + "-" +
+		strconv.Itoa(int(deviceID.ProductID)) + "-" +
+		strconv.Itoa(int(deviceID.DeviceID)) + "-" + guid, nil
+}
+
+func toSdrRecords(list []RecordData) ([]Record, error) {
+	var results = make([]Record, 0, len(list))
+	for i := range list {
+		record, e := list[i].ToSdrRecord()
+		if nil != e {
+			return nil, errors.New("toRecord:" + e.Error())
+		}
+		results = append(results, record)
+	}
+	return results, nil
+}
+
+// listSDRData reads the records of the SDR repository.
+func (c *Client) listSDRData(ctx context.Context, reservationId uint16) ([]RecordData, error) {
+	var results = make([]RecordData, 0, 32)
 	record_id := uint16(0)
 	for {
 		offset := uint8(0)
@@ -181,11 +922,14 @@ func (c *Client) ListSDR(reservationId uint16) ([]Record, error) {
 			var getSDRResponse GetSDRResponse
 			getSDRResponse.Data = &data
 
-			if e := c.Exec(GetSDR, &getSDRRequest, &getSDRResponse); e != nil {
+			if e := c.ExecContext(ctx, GetSDR, &getSDRRequest, &getSDRResponse); e != nil {
 				if e == ErrRequestData {
 					next_record_id = getSDRResponse.NextRecordId
 					break
 				}
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
 				return nil, errors.New("get Sdr info, " + e.Error())
 			}
 
@@ -216,11 +960,7 @@ func (c *Client) ListSDR(reservationId uint16) ([]Record, error) {
 			offset += uint8(getSDRResponse.DataLength)
 		}
 		if len(data.Data) != 0 {
-			record, e := data.ToSdrRecord()
-			if nil != e {
-				return nil, errors.New("toRecord:" + e.Error())
-			}
-			results = append(results, record)
+			results = append(results, data)
 		}
 
 		record_id = next_record_id
@@ -232,6 +972,10 @@ func (c *Client) ListSDR(reservationId uint16) ([]Record, error) {
 }
 
 func (c *Client) ListSEL(reservationId uint16) ([]interface{}, error) {
+	return c.ListSELContext(context.Background(), reservationId)
+}
+
+func (c *Client) ListSELContext(ctx context.Context, reservationId uint16) ([]interface{}, error) {
 	var results = make([]interface{}, 0, 32)
 	record_id := uint16(0)
 	for {
@@ -248,7 +992,10 @@ func (c *Client) ListSEL(reservationId uint16) ([]interface{}, error) {
 			var getSELResponse GetSELResponse
 			getSELResponse.Data = &data
 
-			if e := c.Exec(GetSELEntry, &getSELRequest, &getSELResponse); e != nil {
+			if e := c.ExecContext(ctx, GetSELEntry, &getSELRequest, &getSELResponse); e != nil {
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
 				return nil, errors.New("get SEL info, " + e.Error())
 			}
 
@@ -294,33 +1041,557 @@ func (c *Client) ListSEL(reservationId uint16) ([]interface{}, error) {
 	return results, nil
 }
 
-type SensorReadingResponse struct {
-	Response *GetSensorReadingResponse
-	Error    error
+// ListSELRecords reads the SEL and decodes the records.
+func (c *Client) ListSELRecords(reservationId uint16) ([]SELRecord, error) {
+	return c.ListSELRecordsContext(context.Background(), reservationId)
+}
+
+func (c *Client) ListSELRecordsContext(ctx context.Context, reservationId uint16) ([]SELRecord, error) {
+	list, err := c.ListSELContext(ctx, reservationId)
+	if err != nil {
+		return nil, err
+	}
+	records := make([]SELRecord, 0, len(list))
+	for _, v := range list {
+		data := RecordData{Data: v.([]byte)}
+		record, e := data.ToSELRecord()
+		if e != nil {
+			return nil, errors.New("toSELRecord:" + e.Error())
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+func (c *Client) GetSELInfo() (*GetSELInfoResponse, error) {
+	return c.GetSELInfoContext(context.Background())
+}
+
+func (c *Client) GetSELInfoContext(ctx context.Context) (*GetSELInfoResponse, error) {
+	var getSELInfoRequest GetSELInfoRequest
+	var getSELInfoResponse GetSELInfoResponse
+	return &getSELInfoResponse,
+		c.ExecContext(ctx, GetSELInfo,
+			&getSELInfoRequest,
+			&getSELInfoResponse)
+}
+
+func (c *Client) GetReserveSEL() (*ReserveSELResponse, error) {
+	return c.GetReserveSELContext(context.Background())
+}
+
+func (c *Client) GetReserveSELContext(ctx context.Context) (*ReserveSELResponse, error) {
+	var reserveSELRequest ReserveSELRequest
+	var reserveSELResponse ReserveSELResponse
+	return &reserveSELResponse,
+		c.ExecContext(ctx, ReserveSEL,
+			&reserveSELRequest,
+			&reserveSELResponse)
+}
+
+// the erasure of the SEL is polled every selErasePollInterval until it is
+// completed in selEraseTimeout.
+var (
+	selErasePollInterval = 100 * time.Millisecond
+	selEraseTimeout      = 30 * time.Second
+)
+
+// ClearSEL erases all the SEL records and waits until the erasure is
+// completed.
+func (c *Client) ClearSEL() error {
+	return c.ClearSELContext(context.Background())
+}
+
+func (c *Client) ClearSELContext(ctx context.Context) error {
+	reservation, err := c.GetReserveSELContext(ctx)
+	if err != nil {
+		return errors.New("reserve SEL, " + err.Error())
+	}
+	var clearSELRequest = ClearSELRequest{ReservationId: reservation.Id, Operation: SELEraseInitiate}
+	var clearSELResponse ClearSELResponse
+	if e := c.ExecContext(ctx, ClearSEL, &clearSELRequest, &clearSELResponse); e != nil {
+		return errors.New("clear SEL, " + e.Error())
+	}
+
+	deadline := time.Now().Add(selEraseTimeout)
+	clearSELRequest.Operation = SELEraseStatus
+	for !clearSELResponse.IsCompleted() {
+		if time.Now().After(deadline) {
+			return errors.New("clear SEL, the erasure isn't completed.")
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(selErasePollInterval):
+		}
+
+		e := c.ExecContext(ctx, ClearSEL, &clearSELRequest, &clearSELResponse)
+		if e == protocol.ErrInvalidResv {
+			// the reservation is cancelled by the erasure on some BMCs
+			if reservation, e = c.GetReserveSELContext(ctx); e == nil {
+				clearSELRequest.ReservationId = reservation.Id
+				e = c.ExecContext(ctx, ClearSEL, &clearSELRequest, &clearSELResponse)
+			}
+		}
+		if e != nil {
+			return errors.New("get SEL erasure status, " + e.Error())
+		}
+	}
+	return nil
 }
 
-func (c *Client) ListFullSDRReading(sdr_list []Record) ([]*FullSensorRecord, []SensorReadingResponse, error) {
-	records := make([]*FullSensorRecord, 0, len(sdr_list))
-	results := make([]SensorReadingResponse, 0, len(sdr_list))
+// DeleteSELEntry deletes the SEL record, the record ID 0x0000 is the first
+// record and 0xffff is the last record.
+func (c *Client) DeleteSELEntry(recordId uint16) error {
+	return c.DeleteSELEntryContext(context.Background(), recordId)
+}
 
-	for _, v := range sdr_list {
-		if full, ok := v.(*FullSensorRecord); ok {
-			records = append(records, full)
+func (c *Client) DeleteSELEntryContext(ctx context.Context, recordId uint16) error {
+	var e error
+	for i := 0; i < 2; i++ {
+		var reservation *ReserveSELResponse
+		if reservation, e = c.GetReserveSELContext(ctx); e != nil {
+			return errors.New("reserve SEL, " + e.Error())
+		}
+		var deleteSELEntryRequest = DeleteSELEntryRequest{ReservationId: reservation.Id, RecordId: recordId}
+		var deleteSELEntryResponse DeleteSELEntryResponse
+		e = c.ExecContext(ctx, DeleteSELEntry, &deleteSELEntryRequest, &deleteSELEntryResponse)
+		if e != protocol.ErrInvalidResv { // the reservation is cancelled by a new record
+			break
 		}
 	}
+	if e != nil {
+		return errors.New("delete SEL entry, " + e.Error())
+	}
+	return nil
+}
+
+// AddSELEntry adds the record to the SEL and returns the record ID, the
+// timestamp of a system event record is set by the BMC.
+func (c *Client) AddSELEntry(record SELRecord) (uint16, error) {
+	return c.AddSELEntryContext(context.Background(), record)
+}
+
+func (c *Client) AddSELEntryContext(ctx context.Context, record SELRecord) (uint16, error) {
+	var addSELEntryRequest = AddSELEntryRequest{Record: record}
+	var addSELEntryResponse AddSELEntryResponse
+	return addSELEntryResponse.RecordId,
+		c.ExecContext(ctx, AddSELEntry,
+			&addSELEntryRequest,
+			&addSELEntryResponse)
+}
+
+// GetSELTime returns the time of the SEL device, it is the time of the SEL
+// record timestamps.
+func (c *Client) GetSELTime() (time.Time, error) {
+	return c.GetSELTimeContext(context.Background())
+}
+
+func (c *Client) GetSELTimeContext(ctx context.Context) (time.Time, error) {
+	var getSELTimeRequest GetSELTimeRequest
+	var getSELTimeResponse GetSELTimeResponse
+	if e := c.ExecContext(ctx, GetSELTime, &getSELTimeRequest, &getSELTimeResponse); e != nil {
+		return time.Time{}, e
+	}
+	return selTime(getSELTimeResponse.Time), nil
+}
+
+// SetSELTime sets the time of the SEL device.
+func (c *Client) SetSELTime(t time.Time) error {
+	return c.SetSELTimeContext(context.Background(), t)
+}
+
+func (c *Client) SetSELTimeContext(ctx context.Context, t time.Time) error {
+	if t.Unix() < 0 || t.Unix() >= 0xffffffff {
+		return errors.New("SEL time is out of range.")
+	}
+	var setSELTimeRequest = SetSELTimeRequest{Time: uint32(t.Unix())}
+	var setSELTimeResponse SetSELTimeResponse
+	return c.ExecContext(ctx, SetSELTime, &setSELTimeRequest, &setSELTimeResponse)
+}
+
+func (c *Client) GetSELTimeUTCOffset() (*GetSELTimeUTCOffsetResponse, error) {
+	return c.GetSELTimeUTCOffsetContext(context.Background())
+}
+
+func (c *Client) GetSELTimeUTCOffsetContext(ctx context.Context) (*GetSELTimeUTCOffsetResponse, error) {
+	var getSELTimeUTCOffsetRequest GetSELTimeUTCOffsetRequest
+	var getSELTimeUTCOffsetResponse GetSELTimeUTCOffsetResponse
+	return &getSELTimeUTCOffsetResponse,
+		c.ExecContext(ctx, GetSELTimeUTCOffset,
+			&getSELTimeUTCOffsetRequest,
+			&getSELTimeUTCOffsetResponse)
+}
 
-	for _, rec := range records {
-		// if rec.CanIgnore() {
-		// 	results = append(results, SensorReadingResponse{Error: ErrIgnoreSensor})
-		// } else
+// SetSELTimeUTCOffset sets the offset of the local time of the BMC from UTC,
+// it is in minutes from -24 to +24 hours.
+func (c *Client) SetSELTimeUTCOffset(offset time.Duration) error {
+	return c.SetSELTimeUTCOffsetContext(context.Background(), offset)
+}
+
+func (c *Client) SetSELTimeUTCOffsetContext(ctx context.Context, offset time.Duration) error {
+	minutes := offset / time.Minute
+	if minutes < -1440 || minutes > 1440 {
+		return errors.New("SEL time UTC offset is out of range.")
+	}
+	var setSELTimeUTCOffsetRequest = SetSELTimeUTCOffsetRequest{Offset: int16(minutes)}
+	var setSELTimeUTCOffsetResponse SetSELTimeUTCOffsetResponse
+	return c.ExecContext(ctx, SetSELTimeUTCOffset, &setSELTimeUTCOffsetRequest, &setSELTimeUTCOffsetResponse)
+}
 
-		if res, err := c.GetSensorReading(rec.SensorNumber); err != nil {
-			results = append(results, SensorReadingResponse{Error: err})
+// SELFollowLatest is the since of FollowSEL to follow the records that are
+// added after the records in the SEL now.
+const SELFollowLatest = 0xffff
+
+// the SEL is polled every selFollowInterval by FollowSEL.
+var selFollowInterval = 10 * time.Second
+
+// SELRecordResult is a record of FollowSEL, or the error of a poll.
+type SELRecordResult struct {
+	Record SELRecord
+	Error  error
+}
+
+// FollowSEL polls the SEL and sends the records that are added after the
+// record since, all the records are sent if since is 0. The SEL is read
+// only if its RecentAddTimestamp or RecentDelTimestamp is changed. The SEL is
+// followed from the first record again if it is cleared, that is the last
+// record that is sent is replaced by another record of the same ID, or it is
+// gone and the first record is changed too. If only the last record is
+// deleted, the records of greater IDs are sent. The errors are sent and the
+// SEL is polled again, the channel is closed once ctx is done.
+func (c *Client) FollowSEL(ctx context.Context, since uint16) <-chan SELRecordResult {
+	results := make(chan SELRecordResult)
+	go func() {
+		defer close(results)
+
+		f := &selFollower{c: c, results: results, last: since, latest: since == SELFollowLatest}
+		for {
+			if err := f.poll(ctx); err != nil && ctx.Err() == nil {
+				f.send(ctx, SELRecordResult{Error: err})
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(selFollowInterval):
+			}
+		}
+	}()
+	return results
+}
+
+type selFollower struct {
+	c       *Client
+	results chan SELRecordResult
+
+	last        uint16 // the record ID of the last record that is sent
+	lastData    []byte // the last record that is sent, nil if it isn't read
+	firstData   []byte // the first record in the SEL, nil if it isn't read
+	latest      bool   // skip the records in the SEL now
+	polled      bool
+	reservation uint16
+	addTime     uint32
+	delTime     uint32
+}
+
+func (f *selFollower) send(ctx context.Context, result SELRecordResult) bool {
+	select {
+	case f.results <- result:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (f *selFollower) poll(ctx context.Context) error {
+	info, err := f.c.GetSELInfoContext(ctx)
+	if err != nil {
+		return errors.New("get SEL info, " + err.Error())
+	}
+	if f.polled && info.RecentAddTimestamp == f.addTime && info.RecentDelTimestamp == f.delTime {
+		return nil
+	}
+
+	if info.Enitities == 0 {
+		f.last, f.lastData, f.firstData = 0, nil, nil
+		f.latest = false
+	} else if f.latest {
+		// the last record in the SEL now
+		entry, last, err := f.getEntry(ctx, 0xffff)
+		if err != nil && err != protocol.ErrNoObj {
+			return err
+		}
+		if err == nil {
+			f.last, f.lastData = last, entry.Data
+		}
+		f.latest = false
+	}
+
+	next := uint16(0) // the first record
+	skip := uint16(0) // the records of IDs up to skip are sent already
+	if f.last != 0 && info.Enitities != 0 {
+		var err error
+		if next, skip, err = f.resume(ctx); err != nil {
+			return err
+		}
+	}
+	for info.Enitities != 0 && next != 0xffff {
+		entry, id, err := f.getEntry(ctx, next)
+		if err == protocol.ErrNoObj {
+			break // the SEL is cleared meanwhile
+		}
+		if err != nil {
+			return err
+		}
+		next = entry.nextRecordId
+		if id <= skip {
+			continue
+		}
+		f.last, f.lastData = id, entry.Data
+
+		record, err := entry.ToSELRecord()
+		if !f.send(ctx, SELRecordResult{Record: record, Error: err}) {
+			return ctx.Err()
+		}
+	}
+
+	if info.Enitities != 0 && (f.firstData == nil || !f.polled || info.RecentDelTimestamp != f.delTime) {
+		entry, _, err := f.getEntry(ctx, 0)
+		if err != nil && err != protocol.ErrNoObj {
+			return err
+		}
+		if err == nil {
+			f.firstData = entry.Data
+		}
+	}
+
+	f.polled = true
+	f.addTime = info.RecentAddTimestamp
+	f.delTime = info.RecentDelTimestamp
+	return nil
+}
+
+// resume returns the record ID to follow the SEL from, it is the next record
+// of the last record if the last record isn't changed. If the last record is
+// deleted but the first record isn't changed, the SEL is followed from the
+// first record and the records of IDs up to the last record are skipped.
+// Otherwise the SEL is cleared and it is followed from the first record.
+func (f *selFollower) resume(ctx context.Context) (next, skip uint16, err error) {
+	entry, _, err := f.getEntry(ctx, f.last)
+	if err != nil && err != protocol.ErrNoObj {
+		return 0, 0, err
+	}
+	if err == nil {
+		if f.lastData == nil || bytes.Equal(entry.Data, f.lastData) {
+			return entry.nextRecordId, 0, nil
+		}
+		return 0, 0, nil // the record ID is reused after the SEL is cleared
+	}
+
+	if f.lastData == nil {
+		return 0, f.last, nil // the record since is gone
+	}
+	first, _, err := f.getEntry(ctx, 0)
+	if err != nil && err != protocol.ErrNoObj {
+		return 0, 0, err
+	}
+	if err == nil && f.firstData != nil && bytes.Equal(first.Data, f.firstData) {
+		return 0, f.last, nil
+	}
+	return 0, 0, nil
+}
+
+type selEntry struct {
+	RecordData
+	nextRecordId uint16
+}
+
+// getEntry reads the record and returns it with its record ID, the record is
+// read again with a new reservation if the reservation is cancelled.
+func (f *selFollower) getEntry(ctx context.Context, recordId uint16) (*selEntry, uint16, error) {
+	for i := 0; ; i++ {
+		var entry = selEntry{RecordData: RecordData{Data: make([]byte, 0, 16)}}
+		var getSELRequest = GetSELRequest{
+			ReservationId: f.reservation,
+			RecordId:      recordId,
+			WillReadBytes: 0xff}
+		var getSELResponse = GetSELResponse{Data: &entry.RecordData}
+
+		e := f.c.ExecContext(ctx, GetSELEntry, &getSELRequest, &getSELResponse)
+		if e == protocol.ErrInvalidResv && i == 0 {
+			reservation, err := f.c.GetReserveSELContext(ctx)
+			if err != nil {
+				return nil, 0, errors.New("reserve SEL, " + err.Error())
+			}
+			f.reservation = reservation.Id
+			continue
+		}
+		if e != nil {
+			if e == protocol.ErrNoObj {
+				return nil, 0, e
+			}
+			return nil, 0, errors.New("get SEL entry, " + e.Error())
+		}
+		if len(entry.Data) < 2 {
+			return nil, 0, errors.New("get SEL entry, the record is empty.")
+		}
+		entry.nextRecordId = getSELResponse.NextRecordId
+		return &entry, uint16(entry.Data[0]) | uint16(entry.Data[1])<<8, nil
+	}
+}
+
+// ListSDRReading reads the sensors of the full and compact records, the
+// shared compact records are expanded to their sensors as SensorInstances.
+func (c *Client) ListSDRReading(sdr_list []Record) ([]SensorInstance, []SensorReadingResponse, error) {
+	return c.ListSDRReadingContext(context.Background(), sdr_list)
+}
+
+func (c *Client) ListSDRReadingContext(ctx context.Context, sdr_list []Record) ([]SensorInstance, []SensorReadingResponse, error) {
+	instances := make([]SensorInstance, 0, len(sdr_list))
+	for _, instance := range SensorInstances(sdr_list) {
+		if _, ok := instance.Record.(*EventOnlyRecord); !ok {
+			instances = append(instances, instance)
+		}
+	}
+
+	results := make([]SensorReadingResponse, len(instances))
+	c.readConcurrently(len(instances), func(i int) {
+		instance := &instances[i]
+		if res, err := c.GetSensorReadingTargetContext(ctx, instance.Owner, instance.Number); err != nil {
+			results[i] = SensorReadingResponse{Error: err}
 		} else if res.GetReadingUnavailable() {
-			results = append(results, SensorReadingResponse{Error: ErrReadingUnavailable})
+			results[i] = SensorReadingResponse{Error: ErrReadingUnavailable}
 		} else {
-			results = append(results, SensorReadingResponse{Response: res})
+			results[i] = SensorReadingResponse{Response: res}
 		}
+	})
+
+	if ctx.Err() != nil {
+		return nil, nil, ctx.Err()
+	}
+	return instances, results, nil
+}
+
+// readConcurrently calls read for the indexes from 0 to count-1 by as many
+// workers as the requests that may be outstanding on the session, so the
+// readings are pipelined as far as ConnectionOption.Window allows.
+func (c *Client) readConcurrently(count int, read func(i int)) {
+	workers := 1
+	if h, ok := c.ClientHandler.(*protocol.Client); ok && h.ConnectionOption != nil {
+		workers = h.WindowSize()
+	}
+	if workers > count {
+		workers = count
+	}
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				read(i)
+			}
+		}()
+	}
+	for i := 0; i < count; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+}
+
+type SensorReadingResponse struct {
+	Response *GetSensorReadingResponse
+	Error    error
+}
+
+// ListFullSDRReading reads the sensors of the full and compact records as
+// ListSDRReading, the Record of an instance is a *FullSensorRecord or a
+// *CompactSensorRecord.
+func (c *Client) ListFullSDRReading(sdr_list []Record) ([]SensorInstance, []SensorReadingResponse, error) {
+	return c.ListSDRReadingContext(context.Background(), sdr_list)
+}
+
+func (c *Client) ListFullSDRReadingContext(ctx context.Context, sdr_list []Record) ([]SensorInstance, []SensorReadingResponse, error) {
+	return c.ListSDRReadingContext(ctx, sdr_list)
+}
+
+// ListSensors reads the sensors of the SDR repository as "ipmitool sensor
+// list".
+func (c *Client) ListSensors() ([]Sensor, error) {
+	return c.ListSensorsContext(context.Background())
+}
+
+func (c *Client) ListSensorsContext(ctx context.Context) ([]Sensor, error) {
+	reserve, err := c.GetReserveSDRRepositoryContext(ctx)
+	if err != nil {
+		return nil, errors.New("reserve SDR, " + err.Error())
+	}
+	records, err := c.ListSDRContext(ctx, reserve.Id)
+	if err != nil {
+		return nil, err
+	}
+	return c.ReadSensorsContext(ctx, records)
+}
+
+// ReadSensors reads the sensors of the records, such as the records of
+// ListSDRCached. The records that aren't sensor records are skipped, the
+// error of reading a sensor is in its Error.
+func (c *Client) ReadSensors(records []Record) ([]Sensor, error) {
+	return c.ReadSensorsContext(context.Background(), records)
+}
+
+func (c *Client) ReadSensorsContext(ctx context.Context, records []Record) ([]Sensor, error) {
+	instances := SensorInstances(records)
+	sensors := make([]Sensor, len(instances))
+	for i, instance := range instances {
+		sensors[i] = newSensor(instance)
+	}
+
+	// as ListSDRReading, the sensors are read concurrently, the factors of
+	// the non-linear sensors are cached while they are read
+	var cache sensorFactorsCache
+	c.readConcurrently(len(sensors), func(i int) {
+		if _, ok := sensors[i].Record.(*EventOnlyRecord); !ok {
+			c.readSensor(ctx, &cache, &sensors[i])
+		}
+	})
+
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	return sensors, nil
+}
+
+func (c *Client) readSensor(ctx context.Context, cache *sensorFactorsCache, sensor *Sensor) {
+	res, err := c.GetSensorReadingTargetContext(ctx, sensor.Owner, sensor.Number)
+	if err == nil && (res.GetReadingUnavailable() || res.GetScaningDisabled()) {
+		err = ErrReadingUnavailable
+	}
+	if err != nil {
+		sensor.Status = SensorStatusNotAvailable
+		sensor.Error = err
+		return
+	}
+	sensor.setReading(res)
+
+	full, ok := sensor.Record.(*FullSensorRecord)
+	if !ok {
+		return
+	}
+	factors := func(raw uint8) (*GetSensorReadingFactorsResponse, error) {
+		return c.sensorFactors(ctx, cache, full, raw)
+	}
+	if full.SensorUnits1&0xc0 != 0xc0 {
+		sensor.setValue(full, factors)
+	}
+	if !sensor.IsThreshold() || full.Masks[4]&0x3f == 0 {
+		return
+	}
+	// the status is known without the thresholds, so their error is ignored
+	if thresholds, err := c.GetSensorThresholdsTargetContext(ctx, sensor.Owner, sensor.Number); err == nil {
+		sensor.setThresholds(full, thresholds, factors)
 	}
-	return records, results, nil
 }
@@ -0,0 +1,78 @@
+package goipmi
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/runner-mei/goipmi/protocol"
+	"github.com/runner-mei/goipmi/protocol/commands"
+)
+
+// fakeRequest is a request received by the fakeHandler, data is the request
+// data without the IPMI message header and checksum.
+type fakeRequest struct {
+	cmd  commands.CommandCode
+	data []byte
+}
+
+// fakeHandler is a ClientHandler that answers the requests by handle, the
+// request is encoded and the response is decoded as they are in a session.
+// The requests may be executed concurrently, so handle must be safe for it.
+type fakeHandler struct {
+	handle   func(cmd commands.CommandCode, data []byte) (protocol.CompletionCode, []byte)
+	mu       sync.Mutex
+	requests []fakeRequest
+}
+
+func (h *fakeHandler) Open() error                           { return nil }
+func (h *fakeHandler) OpenContext(ctx context.Context) error { return nil }
+func (h *fakeHandler) Close() error                          { return nil }
+func (h *fakeHandler) IsConnected() bool                     { return true }
+
+func (h *fakeHandler) Exec(cmd commands.CommandCode, req, resp interface{}) error {
+	return h.ExecContext(context.Background(), cmd, req, resp)
+}
+
+func (h *fakeHandler) ExecContext(ctx context.Context, cmd commands.CommandCode, req, resp interface{}) error {
+	w := protocol.Writer{}
+	w.Init(nil)
+	protocol.NewRequest(cmd, req).WriteBytes(&w)
+	if w.Err() != nil {
+		return w.Err()
+	}
+	bs := w.Bytes()
+	data := append([]byte(nil), bs[protocol.IPMIBodySize:len(bs)-1]...)
+	h.mu.Lock()
+	h.requests = append(h.requests, fakeRequest{cmd: cmd, data: data})
+	h.mu.Unlock()
+
+	code, respData := h.handle(cmd, data)
+	raw := make([]byte, protocol.IPMIBodySize, protocol.IPMIBodySize+len(respData)+2)
+	raw = append(raw, uint8(code))
+	raw = append(raw, respData...)
+	raw = append(raw, 0) // checksum
+
+	response := protocol.NewResponse(cmd, resp)
+	r := protocol.NewReader(raw)
+	response.ReadBytes(r)
+	if code != protocol.CommandCompleted {
+		return code
+	}
+	return r.Err()
+}
+
+func assertEquals(t *testing.T, field string, actual, excepted interface{}) {
+	if bs, ok := actual.([]byte); ok {
+		if !bytes.Equal(bs, excepted.([]byte)) {
+			t.Error("["+field+"] excepted is", len(excepted.([]byte)), excepted.([]byte))
+			t.Error("["+field+"] actual   is", len(actual.([]byte)), actual.([]byte))
+		}
+	} else if !reflect.DeepEqual(actual, excepted) {
+		t.Error("["+field+"] excepted is", fmt.Sprintf("%T", excepted), excepted)
+		t.Error("["+field+"] actual   is", fmt.Sprintf("%T", actual), actual)
+	}
+}
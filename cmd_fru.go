@@ -0,0 +1,943 @@
+package goipmi
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/runner-mei/goipmi/protocol"
+	"golang.org/x/text/encoding/charmap"
+)
+
+// GetFRUInventoryAreaInfoRequest per section 34.1
+type GetFRUInventoryAreaInfoRequest struct {
+	DeviceID uint8
+}
+
+// GetFRUInventoryAreaInfoResponse per section 34.1
+type GetFRUInventoryAreaInfoResponse struct {
+	// CompletionCode
+	AreaSize   uint16 // LS Byte first
+	AccessType uint8
+}
+
+// ByWords returns true if the device is accessed by words, the offset and
+// the count of Read FRU Data are in words then.
+func (self *GetFRUInventoryAreaInfoResponse) ByWords() bool {
+	return self.AccessType&0x01 != 0
+}
+
+// ReadFRUDataRequest per section 34.2
+type ReadFRUDataRequest struct {
+	DeviceID uint8
+	Offset   uint16 // LS Byte first
+	Count    uint8
+}
+
+// ReadFRUDataResponse per section 34.2
+type ReadFRUDataResponse struct {
+	// CompletionCode
+	Count uint8
+	Data  []byte
+}
+
+func (self *ReadFRUDataResponse) ReadBytes(r *protocol.Reader) {
+	self.Count = r.ReadUint8()
+	self.Data = r.ReadCopy(r.Len())
+}
+
+// WriteFRUDataRequest per section 34.3
+type WriteFRUDataRequest struct {
+	DeviceID uint8
+	Offset   uint16 // LS Byte first
+	Data     []byte
+}
+
+func (self *WriteFRUDataRequest) WriteBytes(w *protocol.Writer) {
+	w.WriteUint8(self.DeviceID)
+	w.WriteUint16(self.Offset)
+	w.WriteBytes(self.Data)
+}
+
+// WriteFRUDataResponse per section 34.3
+type WriteFRUDataResponse struct {
+	// CompletionCode
+	Count uint8
+}
+
+// Completion codes of Write FRU Data per section 34.3
+var (
+	ErrFRUWriteProtected = protocol.CompletionCode(0x80)
+	ErrFRUDeviceBusy     = protocol.CompletionCode(0x81)
+)
+
+// FRUCommonHeader is the common header of the FRU information per section
+// 8 of the Platform Management FRU Information Storage Definition, the
+// offsets are in multiples of 8 bytes and 0 means that the area isn't
+// present.
+type FRUCommonHeader struct {
+	Version           uint8
+	InternalUseOffset uint8
+	ChassisOffset     uint8
+	BoardOffset       uint8
+	ProductOffset     uint8
+	MultiRecordOffset uint8
+}
+
+// FRUChassisArea is the chassis info area per section 10 of the FRU
+// specification.
+type FRUChassisArea struct {
+	Type         uint8 // per SMBIOS
+	PartNumber   string
+	SerialNumber string
+	Custom       []string
+}
+
+// TypeString returns the chassis type name per SMBIOS.
+func (self *FRUChassisArea) TypeString() string {
+	if int(self.Type) < len(chassisTypes) && chassisTypes[self.Type] != "" {
+		return chassisTypes[self.Type]
+	}
+	return "Unknown(" + strconv.Itoa(int(self.Type)) + ")"
+}
+
+var chassisTypes = []string{
+	"", "Other", "Unknown", "Desktop", "Low Profile Desktop", "Pizza Box",
+	"Mini Tower", "Tower", "Portable", "LapTop", "Notebook", "Hand Held",
+	"Docking Station", "All in One", "Sub Notebook", "Space-saving",
+	"Lunch Box", "Main Server Chassis", "Expansion Chassis", "SubChassis",
+	"Bus Expansion Chassis", "Peripheral Chassis", "RAID Chassis",
+	"Rack Mount Chassis", "Sealed-case PC", "Multi-system Chassis",
+	"Compact PCI", "Advanced TCA", "Blade", "Blade Enclosure", "Tablet",
+	"Convertible", "Detachable", "IoT Gateway", "Embedded PC", "Mini PC",
+	"Stick PC",
+}
+
+func (self *FRUChassisArea) WriteBytes(w *protocol.Writer) {
+	self.writeFields(w, nil)
+}
+
+func (self *FRUChassisArea) writeFields(w *protocol.Writer, raw []fruField) {
+	writeFRUArea(w, []byte{self.Type}, raw, self.Custom, self.PartNumber, self.SerialNumber)
+}
+
+// FRUBoardArea is the board info area per section 11 of the FRU
+// specification, MfgDate is zero if it is unspecified.
+type FRUBoardArea struct {
+	Language     uint8
+	MfgDate      time.Time
+	Manufacturer string
+	ProductName  string
+	SerialNumber string
+	PartNumber   string
+	FRUFileID    string
+	Custom       []string
+}
+
+func (self *FRUBoardArea) WriteBytes(w *protocol.Writer) {
+	self.writeFields(w, nil)
+}
+
+func (self *FRUBoardArea) writeFields(w *protocol.Writer, raw []fruField) {
+	var minutes int64
+	if !self.MfgDate.IsZero() {
+		minutes = int64(self.MfgDate.Sub(fruEpoch) / time.Minute)
+		if minutes <= 0 || minutes > 0xffffff {
+			w.SetError(errors.New("FRU board manufacturing date is out of range."))
+			return
+		}
+	}
+	writeFRUArea(w, []byte{self.Language, uint8(minutes), uint8(minutes >> 8), uint8(minutes >> 16)},
+		raw, self.Custom, self.Manufacturer, self.ProductName, self.SerialNumber, self.PartNumber, self.FRUFileID)
+}
+
+// Fields of FRUBoardArea, FRUBoardCustom + n is the n-th custom field.
+type FRUBoardField int
+
+const (
+	FRUBoardManufacturer FRUBoardField = iota
+	FRUBoardProductName
+	FRUBoardSerialNumber
+	FRUBoardPartNumber
+	FRUBoardFRUFileID
+	FRUBoardCustom
+)
+
+// SetField sets the field of the board area, the custom fields are added
+// up to the field if it is a custom field.
+func (self *FRUBoardArea) SetField(field FRUBoardField, value string) {
+	switch field {
+	case FRUBoardManufacturer:
+		self.Manufacturer = value
+	case FRUBoardProductName:
+		self.ProductName = value
+	case FRUBoardSerialNumber:
+		self.SerialNumber = value
+	case FRUBoardPartNumber:
+		self.PartNumber = value
+	case FRUBoardFRUFileID:
+		self.FRUFileID = value
+	default:
+		index := int(field - FRUBoardCustom)
+		for len(self.Custom) <= index {
+			self.Custom = append(self.Custom, "")
+		}
+		self.Custom[index] = value
+	}
+}
+
+// FRUProductArea is the product info area per section 12 of the FRU
+// specification.
+type FRUProductArea struct {
+	Language     uint8
+	Manufacturer string
+	Name         string
+	PartNumber   string
+	Version      string
+	SerialNumber string
+	AssetTag     string
+	FRUFileID    string
+	Custom       []string
+}
+
+func (self *FRUProductArea) WriteBytes(w *protocol.Writer) {
+	self.writeFields(w, nil)
+}
+
+func (self *FRUProductArea) writeFields(w *protocol.Writer, raw []fruField) {
+	writeFRUArea(w, []byte{self.Language}, raw, self.Custom, self.Manufacturer, self.Name,
+		self.PartNumber, self.Version, self.SerialNumber, self.AssetTag, self.FRUFileID)
+}
+
+// FRUInventory is the FRU information of a FRU device, the areas that
+// aren't present are nil.
+type FRUInventory struct {
+	CommonHeader FRUCommonHeader
+	InternalUse  []byte
+	Chassis      *FRUChassisArea
+	Board        *FRUBoardArea
+	Product      *FRUProductArea
+	MultiRecords []FRUMultiRecord
+
+	// fields are the fields of the chassis, board and product areas as they
+	// are read, the fields that aren't changed are written as they are.
+	fields [3][]fruField
+}
+
+// fruField is a field of an info area, raw is the type/length byte and the
+// bytes of value.
+type fruField struct {
+	value string
+	raw   []byte
+}
+
+// fruAreaWriter encodes an info area, the fields that are equal to the
+// values of raw are written as raw.
+type fruAreaWriter interface {
+	writeFields(w *protocol.Writer, raw []fruField)
+}
+
+// areaBytes encodes the info area of index, 0 is the chassis area, 1 is the
+// board area and 2 is the product area.
+func (self *FRUInventory) areaBytes(index int, area fruAreaWriter) ([]byte, error) {
+	w := protocol.NewWriter(make([]byte, 0, 256))
+	area.writeFields(w, self.fields[index])
+	return w.Bytes(), w.Err()
+}
+
+// UUID returns the system unique ID of the management access records, it is
+// empty if there isn't one.
+func (self *FRUInventory) UUID() string {
+	for _, record := range self.MultiRecords {
+		if access, ok := record.(*FRUManagementAccessRecord); ok {
+			if uuid, ok := access.UUID(); ok {
+				return uuid
+			}
+		}
+	}
+	return ""
+}
+
+// WriteBytes encodes the FRU information, the areas are laid out in the
+// order of the common header.
+func (self *FRUInventory) WriteBytes(w *protocol.Writer) {
+	header := []byte{0x01, 0, 0, 0, 0, 0, 0}
+	body := make([]byte, 0, 256)
+	place := func(index int, bs []byte, err error) {
+		if err != nil {
+			w.SetError(err)
+			return
+		}
+		offset := (len(header) + 1 + len(body)) / 8
+		if offset > 0xff {
+			w.SetError(errors.New("FRU data is too large."))
+			return
+		}
+		header[index] = uint8(offset)
+		body = append(body, bs...)
+	}
+
+	if self.InternalUse != nil {
+		bs := append([]byte(nil), self.InternalUse...)
+		for len(bs)%8 != 0 {
+			bs = append(bs, 0)
+		}
+		place(1, bs, nil)
+	}
+	if self.Chassis != nil {
+		bs, err := self.areaBytes(0, self.Chassis)
+		place(2, bs, err)
+	}
+	if self.Board != nil {
+		bs, err := self.areaBytes(1, self.Board)
+		place(3, bs, err)
+	}
+	if self.Product != nil {
+		bs, err := self.areaBytes(2, self.Product)
+		place(4, bs, err)
+	}
+	if len(self.MultiRecords) != 0 {
+		bs, err := encodeFRUMultiRecords(self.MultiRecords)
+		place(5, bs, err)
+	}
+	if w.Err() != nil {
+		return
+	}
+	w.WriteBytes(append(header, -zeroChecksum(header)))
+	w.WriteBytes(body)
+}
+
+// FRU multi records per section 18 of the FRU specification
+const (
+	FRURecordPowerSupply           = 0x00
+	FRURecordDCOutput              = 0x01
+	FRURecordDCLoad                = 0x02
+	FRURecordManagementAccess      = 0x03
+	FRURecordBaseCompatibility     = 0x04
+	FRURecordExtendedCompatibility = 0x05
+	FRURecordOEM                   = 0xc0 // 0xc0 to 0xff
+)
+
+// FRUMultiRecordHeader is the header of a multi record per section 16 of
+// the FRU specification.
+type FRUMultiRecordHeader struct {
+	TypeID    uint8
+	EndOfList bool
+	Version   uint8
+	Length    uint8
+}
+
+// FRUMultiRecord is a record of the multi record area, the data of the
+// record is read by ReadBytes.
+type FRUMultiRecord interface {
+	protocol.Readable
+	protocol.Writable
+
+	GetHeader() FRUMultiRecordHeader
+}
+
+// Flags of FRUPowerSupplyRecord
+const (
+	FRUPowerSupplyPredictiveFail   = 0x01
+	FRUPowerSupplyPowerFactor      = 0x02
+	FRUPowerSupplyAutoSwitch       = 0x04
+	FRUPowerSupplyHotSwap          = 0x08
+	FRUPowerSupplyTachometerPulses = 0x10 // 2 pulses per rotation, 1 if it isn't set
+)
+
+// FRUPowerSupplyRecord per section 18.1 of the FRU specification, the
+// voltages are in 10 mV.
+type FRUPowerSupplyRecord struct {
+	FRUMultiRecordHeader
+
+	OverallCapacity        uint16 // watts
+	PeakVA                 uint16
+	InrushCurrent          uint8 // amps
+	InrushInterval         uint8 // ms
+	LowInputVoltage1       uint16
+	HighInputVoltage1      uint16
+	LowInputVoltage2       uint16
+	HighInputVoltage2      uint16
+	LowInputFrequency      uint8 // Hz
+	HighInputFrequency     uint8 // Hz
+	DropoutTolerance       uint8 // ms
+	Flags                  uint8
+	PeakWattage            uint16 // watts
+	HoldUpTime             uint8  // seconds
+	CombinedVoltage1       uint8
+	CombinedVoltage2       uint8
+	TotalCombinedWattage   uint16 // watts
+	TachometerLowThreshold uint8  // RPS
+}
+
+func (self *FRUPowerSupplyRecord) GetHeader() FRUMultiRecordHeader {
+	return self.FRUMultiRecordHeader
+}
+
+func (self *FRUPowerSupplyRecord) ReadBytes(r *protocol.Reader) {
+	self.OverallCapacity = r.ReadUint16() & 0x0fff
+	self.PeakVA = r.ReadUint16()
+	self.InrushCurrent = r.ReadUint8()
+	self.InrushInterval = r.ReadUint8()
+	self.LowInputVoltage1 = r.ReadUint16()
+	self.HighInputVoltage1 = r.ReadUint16()
+	self.LowInputVoltage2 = r.ReadUint16()
+	self.HighInputVoltage2 = r.ReadUint16()
+	self.LowInputFrequency = r.ReadUint8()
+	self.HighInputFrequency = r.ReadUint8()
+	self.DropoutTolerance = r.ReadUint8()
+	self.Flags = r.ReadUint8() & 0x1f
+	peak := r.ReadUint16()
+	self.PeakWattage = peak & 0x0fff
+	self.HoldUpTime = uint8(peak >> 12)
+	voltages := r.ReadUint8()
+	self.CombinedVoltage1 = voltages >> 4
+	self.CombinedVoltage2 = voltages & 0x0f
+	self.TotalCombinedWattage = r.ReadUint16()
+	self.TachometerLowThreshold = r.ReadUint8()
+}
+
+func (self *FRUPowerSupplyRecord) WriteBytes(w *protocol.Writer) {
+	w.WriteUint16(self.OverallCapacity & 0x0fff)
+	w.WriteUint16(self.PeakVA)
+	w.WriteUint8(self.InrushCurrent)
+	w.WriteUint8(self.InrushInterval)
+	w.WriteUint16(self.LowInputVoltage1)
+	w.WriteUint16(self.HighInputVoltage1)
+	w.WriteUint16(self.LowInputVoltage2)
+	w.WriteUint16(self.HighInputVoltage2)
+	w.WriteUint8(self.LowInputFrequency)
+	w.WriteUint8(self.HighInputFrequency)
+	w.WriteUint8(self.DropoutTolerance)
+	w.WriteUint8(self.Flags & 0x1f)
+	w.WriteUint16(self.PeakWattage&0x0fff | uint16(self.HoldUpTime)<<12)
+	w.WriteUint8(self.CombinedVoltage1<<4 | self.CombinedVoltage2&0x0f)
+	w.WriteUint16(self.TotalCombinedWattage)
+	w.WriteUint8(self.TachometerLowThreshold)
+}
+
+// FRUDCOutputRecord per section 18.2 of the FRU specification, the voltages
+// are in 10 mV.
+type FRUDCOutputRecord struct {
+	FRUMultiRecordHeader
+
+	Standby              bool
+	OutputNumber         uint8
+	NominalVoltage       int16
+	MaxNegativeDeviation int16
+	MaxPositiveDeviation int16
+	RippleNoise          uint16 // mV
+	MinCurrent           uint16 // mA
+	MaxCurrent           uint16 // mA
+}
+
+func (self *FRUDCOutputRecord) GetHeader() FRUMultiRecordHeader {
+	return self.FRUMultiRecordHeader
+}
+
+func (self *FRUDCOutputRecord) ReadBytes(r *protocol.Reader) {
+	info := r.ReadUint8()
+	self.Standby = info&0x80 != 0
+	self.OutputNumber = info & 0x0f
+	self.NominalVoltage = r.ReadInt16()
+	self.MaxNegativeDeviation = r.ReadInt16()
+	self.MaxPositiveDeviation = r.ReadInt16()
+	self.RippleNoise = r.ReadUint16()
+	self.MinCurrent = r.ReadUint16()
+	self.MaxCurrent = r.ReadUint16()
+}
+
+func (self *FRUDCOutputRecord) WriteBytes(w *protocol.Writer) {
+	info := self.OutputNumber & 0x0f
+	if self.Standby {
+		info |= 0x80
+	}
+	w.WriteUint8(info)
+	w.WriteInt16(self.NominalVoltage)
+	w.WriteInt16(self.MaxNegativeDeviation)
+	w.WriteInt16(self.MaxPositiveDeviation)
+	w.WriteUint16(self.RippleNoise)
+	w.WriteUint16(self.MinCurrent)
+	w.WriteUint16(self.MaxCurrent)
+}
+
+// Sub-record types of FRUManagementAccessRecord
+const (
+	FRUAccessSystemURL         = 0x01
+	FRUAccessSystemName        = 0x02
+	FRUAccessSystemPingAddress = 0x03
+	FRUAccessComponentURL      = 0x04
+	FRUAccessComponentName     = 0x05
+	FRUAccessComponentPing     = 0x06
+	FRUAccessSystemUniqueID    = 0x07
+)
+
+// FRUManagementAccessRecord per section 18.4 of the FRU specification, Data
+// is a string except for the system unique ID.
+type FRUManagementAccessRecord struct {
+	FRUMultiRecordHeader
+
+	SubType uint8
+	Data    []byte
+}
+
+func (self *FRUManagementAccessRecord) GetHeader() FRUMultiRecordHeader {
+	return self.FRUMultiRecordHeader
+}
+
+func (self *FRUManagementAccessRecord) ReadBytes(r *protocol.Reader) {
+	self.SubType = r.ReadUint8()
+	self.Data = r.ReadCopy(r.Len())
+}
+
+func (self *FRUManagementAccessRecord) WriteBytes(w *protocol.Writer) {
+	w.WriteUint8(self.SubType)
+	w.WriteBytes(self.Data)
+}
+
+// UUID returns the system unique ID if it is the sub-record.
+func (self *FRUManagementAccessRecord) UUID() (string, bool) {
+	if self.SubType != FRUAccessSystemUniqueID || len(self.Data) != 16 {
+		return "", false
+	}
+	return formatGUID(self.Data), true
+}
+
+func (self *FRUManagementAccessRecord) String() string {
+	if uuid, ok := self.UUID(); ok {
+		return uuid
+	}
+	return string(self.Data)
+}
+
+// formatGUID formats the GUID, the time fields are LS Byte first as in
+// SMBIOS.
+func formatGUID(bs []byte) string {
+	return fmt.Sprintf("%02x%02x%02x%02x-%02x%02x-%02x%02x-%02x%02x-%02x%02x%02x%02x%02x%02x",
+		bs[3], bs[2], bs[1], bs[0], bs[5], bs[4], bs[7], bs[6],
+		bs[8], bs[9], bs[10], bs[11], bs[12], bs[13], bs[14], bs[15])
+}
+
+// FRURawRecord is a multi record that isn't decoded, such as the OEM
+// records.
+type FRURawRecord struct {
+	FRUMultiRecordHeader
+
+	Data []byte
+}
+
+func (self *FRURawRecord) GetHeader() FRUMultiRecordHeader {
+	return self.FRUMultiRecordHeader
+}
+
+func (self *FRURawRecord) ReadBytes(r *protocol.Reader) {
+	self.Data = r.ReadCopy(r.Len())
+}
+
+func (self *FRURawRecord) WriteBytes(w *protocol.Writer) {
+	w.WriteBytes(self.Data)
+}
+
+// encodeFRUMultiRecords encodes the records with their headers, the last
+// one is marked as the end of list.
+func encodeFRUMultiRecords(records []FRUMultiRecord) ([]byte, error) {
+	var bs []byte
+	for i, record := range records {
+		body, err := protocol.ToBytes(record)
+		if err != nil {
+			return nil, err
+		}
+		if len(body) > 0xff {
+			return nil, errors.New("FRU multi record is too large.")
+		}
+		typeID := record.GetHeader().TypeID
+		switch record.(type) {
+		case *FRUPowerSupplyRecord:
+			typeID = FRURecordPowerSupply
+		case *FRUDCOutputRecord:
+			typeID = FRURecordDCOutput
+		case *FRUManagementAccessRecord:
+			typeID = FRURecordManagementAccess
+		}
+		flags := uint8(0x02)
+		if i == len(records)-1 {
+			flags |= 0x80
+		}
+		header := []byte{typeID, flags, uint8(len(body)), -zeroChecksum(body)}
+		bs = append(bs, header...)
+		bs = append(bs, -zeroChecksum(header))
+		bs = append(bs, body...)
+	}
+	return bs, nil
+}
+
+var ErrFRUVersion = errors.New("FRU format version is unsupported.")
+
+const fruEndOfFields = 0xc1
+
+// the board manufacturing date is in minutes from 0:00 1/1/96
+var fruEpoch = time.Date(1996, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// ParseFRU parses the FRU information per the Platform Management FRU
+// Information Storage Definition v1.0.
+func ParseFRU(data []byte) (*FRUInventory, error) {
+	if len(data) < 8 {
+		return nil, ErrInsufficientBytes
+	}
+	if zeroChecksum(data[:8]) != 0 {
+		return nil, errors.New("FRU common header checksum is invalid.")
+	}
+	var fru FRUInventory
+	header := &fru.CommonHeader
+	header.Version = data[0] & 0x0f
+	header.InternalUseOffset = data[1]
+	header.ChassisOffset = data[2]
+	header.BoardOffset = data[3]
+	header.ProductOffset = data[4]
+	header.MultiRecordOffset = data[5]
+	if header.Version != 1 {
+		return nil, ErrFRUVersion
+	}
+
+	if header.InternalUseOffset != 0 {
+		// the internal use area has no length, it ends at the next area
+		start := int(header.InternalUseOffset) * 8
+		end := len(data)
+		for _, offset := range []uint8{header.ChassisOffset, header.BoardOffset,
+			header.ProductOffset, header.MultiRecordOffset} {
+			if int(offset)*8 > start && int(offset)*8 < end {
+				end = int(offset) * 8
+			}
+		}
+		if start >= len(data) {
+			return nil, errors.New("FRU internal use area is out of range.")
+		}
+		fru.InternalUse = append([]byte(nil), data[start:end]...)
+	}
+
+	if header.ChassisOffset != 0 {
+		r, err := fruArea(data, header.ChassisOffset, "chassis")
+		if err != nil {
+			return nil, err
+		}
+		area := &FRUChassisArea{Type: r.r.ReadUint8()}
+		area.PartNumber = r.field()
+		area.SerialNumber = r.field()
+		area.Custom = r.custom()
+		if r.r.Err() != nil {
+			return nil, errors.New("FRU chassis area, " + r.r.Err().Error())
+		}
+		fru.Chassis = area
+		fru.fields[0] = r.fields
+	}
+
+	if header.BoardOffset != 0 {
+		r, err := fruArea(data, header.BoardOffset, "board")
+		if err != nil {
+			return nil, err
+		}
+		area := &FRUBoardArea{Language: r.r.ReadUint8()}
+		if bs := r.r.ReadBytes(3); len(bs) == 3 {
+			if minutes := int(bs[0]) | int(bs[1])<<8 | int(bs[2])<<16; minutes != 0 {
+				area.MfgDate = fruEpoch.Add(time.Duration(minutes) * time.Minute)
+			}
+		} else {
+			r.r.SetError(ErrInsufficientBytes)
+		}
+		area.Manufacturer = r.field()
+		area.ProductName = r.field()
+		area.SerialNumber = r.field()
+		area.PartNumber = r.field()
+		area.FRUFileID = r.field()
+		area.Custom = r.custom()
+		if r.r.Err() != nil {
+			return nil, errors.New("FRU board area, " + r.r.Err().Error())
+		}
+		fru.Board = area
+		fru.fields[1] = r.fields
+	}
+
+	if header.ProductOffset != 0 {
+		r, err := fruArea(data, header.ProductOffset, "product")
+		if err != nil {
+			return nil, err
+		}
+		area := &FRUProductArea{Language: r.r.ReadUint8()}
+		area.Manufacturer = r.field()
+		area.Name = r.field()
+		area.PartNumber = r.field()
+		area.Version = r.field()
+		area.SerialNumber = r.field()
+		area.AssetTag = r.field()
+		area.FRUFileID = r.field()
+		area.Custom = r.custom()
+		if r.r.Err() != nil {
+			return nil, errors.New("FRU product area, " + r.r.Err().Error())
+		}
+		fru.Product = area
+		fru.fields[2] = r.fields
+	}
+
+	if header.MultiRecordOffset != 0 {
+		records, err := parseFRUMultiRecords(data, int(header.MultiRecordOffset)*8)
+		if err != nil {
+			return nil, err
+		}
+		fru.MultiRecords = records
+	}
+	return &fru, nil
+}
+
+// fruArea returns the reader of the fields of the info area at offset, the
+// version and length bytes are checked and skipped.
+func fruArea(data []byte, offset uint8, name string) (*fruFieldReader, error) {
+	start := int(offset) * 8
+	if start+2 > len(data) {
+		return nil, errors.New("FRU " + name + " area is out of range.")
+	}
+	if data[start]&0x0f != 1 {
+		return nil, errors.New("FRU " + name + " area format version is unsupported.")
+	}
+	end := start + int(data[start+1])*8
+	if end <= start+2 || end > len(data) {
+		return nil, errors.New("FRU " + name + " area length is invalid.")
+	}
+	if zeroChecksum(data[start:end]) != 0 {
+		return nil, errors.New("FRU " + name + " area checksum is invalid.")
+	}
+	return &fruFieldReader{r: protocol.NewReader(data[start+2 : end-1])}, nil
+}
+
+// writeFRUArea encodes an info area of the fixed bytes and the fields, the
+// custom fields follow the fields. A field that is equal to the value of the
+// field of raw at the same index is written as the raw field, others are
+// encoded by encodeFRUField.
+func writeFRUArea(w *protocol.Writer, fixed []byte, raw []fruField, custom []string, fields ...string) {
+	area := append([]byte{0x01, 0x00}, fixed...)
+	for i, field := range append(fields, custom...) {
+		if i < len(raw) && raw[i].value == field {
+			area = append(area, raw[i].raw...)
+			continue
+		}
+		bs, err := encodeFRUField(field)
+		if err != nil {
+			w.SetError(err)
+			return
+		}
+		area = append(area, bs...)
+	}
+	area = append(area, fruEndOfFields)
+	if len(area) >= 0xff*8 {
+		w.SetError(errors.New("FRU area is too large."))
+		return
+	}
+	w.WriteBytes(padFRUArea(area, 0))
+}
+
+// encodeFRUField encodes the field as 8-bit ASCII + Latin 1 with the
+// type/length byte. The type/length byte of a field of one byte would be the
+// end marker, so the field is encoded as 6-bit packed ASCII, or as binary
+// if it isn't in the 6-bit ASCII set.
+func encodeFRUField(field string) ([]byte, error) {
+	bs, err := charmap.ISO8859_1.NewEncoder().Bytes([]byte(field))
+	if err != nil {
+		return nil, errors.New("FRU field '" + field + "' isn't Latin 1.")
+	}
+	if len(bs) > 0x3f {
+		return nil, errors.New("FRU field '" + field + "' is too long.")
+	}
+	if len(bs) != 1 {
+		return append([]byte{0xc0 | uint8(len(bs))}, bs...), nil
+	}
+	switch {
+	case bs[0] > 0x20 && bs[0] < 0x60:
+		return []byte{0x81, bs[0] - 0x20}, nil
+	case bs[0] < 0x80:
+		return []byte{0x01, bs[0]}, nil
+	default:
+		return nil, errors.New("FRU field '" + field + "' of one byte isn't ASCII.")
+	}
+}
+
+// padFRUArea pads the area that is without the checksum to a multiple of 8
+// bytes and at least length bytes, the length byte and the checksum are
+// updated.
+func padFRUArea(area []byte, length int) []byte {
+	for len(area)+1 < length || (len(area)+1)%8 != 0 {
+		area = append(area, 0)
+	}
+	area[1] = uint8((len(area) + 1) / 8)
+	return append(area, -zeroChecksum(area))
+}
+
+// encodeFRUUpdate encodes the areas of fru that are different from origin,
+// data is the FRU data of origin. The area is written in place if it fits in
+// the origin area, otherwise the FRU is laid out again.
+func encodeFRUUpdate(data []byte, origin, fru *FRUInventory) ([]byte, error) {
+	updated := append([]byte(nil), data...)
+	relayout := !reflect.DeepEqual(origin.InternalUse, fru.InternalUse) ||
+		!reflect.DeepEqual(origin.MultiRecords, fru.MultiRecords)
+
+	for index, area := range []struct {
+		offset         uint8
+		origin, update interface{}
+	}{
+		{origin.CommonHeader.ChassisOffset, origin.Chassis, fru.Chassis},
+		{origin.CommonHeader.BoardOffset, origin.Board, fru.Board},
+		{origin.CommonHeader.ProductOffset, origin.Product, fru.Product},
+	} {
+		if relayout || reflect.DeepEqual(area.origin, area.update) {
+			continue
+		}
+		writer, ok := area.update.(fruAreaWriter)
+		if !ok || reflect.ValueOf(area.update).IsNil() || reflect.ValueOf(area.origin).IsNil() {
+			relayout = true // the area is added or removed
+			continue
+		}
+		bs, err := fru.areaBytes(index, writer)
+		if err != nil {
+			return nil, err
+		}
+		start := int(area.offset) * 8
+		length := int(data[start+1]) * 8
+		if len(bs) > length {
+			relayout = true
+			continue
+		}
+		copy(updated[start:], padFRUArea(bs[:len(bs)-1], length))
+	}
+	if !relayout {
+		return updated, nil
+	}
+
+	bs, err := protocol.ToBytes(fru)
+	if err != nil {
+		return nil, err
+	}
+	if len(bs) > len(data) {
+		return nil, errors.New("FRU data is too large, the FRU inventory area size is " + strconv.Itoa(len(data)) + ".")
+	}
+	copy(updated, data)
+	copy(updated, bs)
+	return updated, nil
+}
+
+// fruFieldReader reads the type/length fields of an info area, the fields
+// after the end marker are empty. fields are the fields that are read.
+type fruFieldReader struct {
+	r      *protocol.Reader
+	end    bool
+	fields []fruField
+}
+
+func (self *fruFieldReader) next() (string, bool) {
+	if self.end {
+		return "", false
+	}
+	typeLength := self.r.ReadUint8()
+	if self.r.Err() != nil || typeLength == fruEndOfFields {
+		self.end = true
+		return "", false
+	}
+	bs := self.r.ReadBytes(int(typeLength & 0x3f))
+	if len(bs) != int(typeLength&0x3f) {
+		self.r.SetError(ErrInsufficientBytes)
+		self.end = true
+		return "", false
+	}
+	field := fruField{value: decodeFRUField(typeLength, bs), raw: append([]byte{typeLength}, bs...)}
+	self.fields = append(self.fields, field)
+	return field.value, true
+}
+
+func (self *fruFieldReader) field() string {
+	s, _ := self.next()
+	return s
+}
+
+func (self *fruFieldReader) custom() []string {
+	var fields []string
+	for {
+		s, ok := self.next()
+		if !ok {
+			return fields
+		}
+		fields = append(fields, s)
+	}
+}
+
+// decodeFRUField decodes the field by decodeName, the 6-bit packed ASCII is
+// padded by spaces.
+func decodeFRUField(typeLength uint8, bs []byte) string {
+	s := decodeName(typeLength, bs)
+	if typeLength>>6 == 2 {
+		s = strings.TrimRight(s, " ")
+	}
+	return s
+}
+
+func parseFRUMultiRecords(data []byte, offset int) ([]FRUMultiRecord, error) {
+	var records []FRUMultiRecord
+	for {
+		if offset+5 > len(data) {
+			return nil, errors.New("FRU multi record is out of range.")
+		}
+		bs := data[offset : offset+5]
+		if zeroChecksum(bs) != 0 {
+			return nil, errors.New("FRU multi record header checksum is invalid.")
+		}
+		header := FRUMultiRecordHeader{
+			TypeID:    bs[0],
+			EndOfList: bs[1]&0x80 != 0,
+			Version:   bs[1] & 0x0f,
+			Length:    bs[2],
+		}
+		if header.Version != 2 {
+			return nil, errors.New("FRU multi record format version is unsupported.")
+		}
+		offset += 5
+		if offset+int(header.Length) > len(data) {
+			return nil, errors.New("FRU multi record is out of range.")
+		}
+		body := data[offset : offset+int(header.Length)]
+		if zeroChecksum(body)+bs[3] != 0 {
+			return nil, errors.New("FRU multi record checksum is invalid.")
+		}
+
+		var record FRUMultiRecord
+		switch header.TypeID {
+		case FRURecordPowerSupply:
+			record = &FRUPowerSupplyRecord{FRUMultiRecordHeader: header}
+		case FRURecordDCOutput:
+			record = &FRUDCOutputRecord{FRUMultiRecordHeader: header}
+		case FRURecordManagementAccess:
+			record = &FRUManagementAccessRecord{FRUMultiRecordHeader: header}
+		default:
+			record = &FRURawRecord{FRUMultiRecordHeader: header}
+		}
+		r := protocol.NewReader(body)
+		record.ReadBytes(r)
+		if r.Err() != nil {
+			return nil, errors.New("FRU multi record " + strconv.Itoa(int(header.TypeID)) + ", " + r.Err().Error())
+		}
+		records = append(records, record)
+
+		offset += int(header.Length)
+		if header.EndOfList {
+			return records, nil
+		}
+	}
+}
+
+// zeroChecksum returns the sum of bs, it is zero if the last byte of bs is
+// the zero checksum of the others.
+func zeroChecksum(bs []byte) uint8 {
+	var sum uint8
+	for _, b := range bs {
+		sum += b
+	}
+	return sum
+}
@@ -0,0 +1,320 @@
+package goipmi
+
+import (
+	"testing"
+	"time"
+
+	"github.com/runner-mei/goipmi/protocol"
+	"github.com/runner-mei/goipmi/protocol/commands"
+)
+
+// testFRUArea builds an info area of the fixed bytes and the 8-bit ASCII
+// fields.
+func testFRUArea(fixed []byte, fields ...string) []byte {
+	area := append([]byte{0x01, 0x00}, fixed...)
+	for _, field := range fields {
+		area = append(area, 0xc0|uint8(len(field)))
+		area = append(area, field...)
+	}
+	area = append(area, 0xc1)
+	for (len(area)+1)%8 != 0 {
+		area = append(area, 0)
+	}
+	area[1] = uint8((len(area) + 1) / 8)
+	return append(area, -zeroChecksum(area))
+}
+
+func testFRUMultiRecord(typeID uint8, end bool, data []byte) []byte {
+	flags := uint8(0x02)
+	if end {
+		flags |= 0x80
+	}
+	header := []byte{typeID, flags, uint8(len(data)), -zeroChecksum(data)}
+	header = append(header, -zeroChecksum(header))
+	return append(header, data...)
+}
+
+func testFRU() []byte {
+	chassis := testFRUArea([]byte{0x17}, "CH-PART", "CH-SERIAL", "extra")
+	board := testFRUArea([]byte{0x00, 0x60, 0xe4, 0x0b}, "ACME", "Mainboard", "BD123", "PN-1", "")
+	product := testFRUArea([]byte{0x19}, "ACME", "Server", "M-1", "1.0", "SN-42", "ASSET-7", "")
+
+	data := []byte{0x01, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00}
+	data[2] = uint8(len(data) / 8)
+	data = append(data, chassis...)
+	data[3] = uint8(len(data) / 8)
+	data = append(data, board...)
+	data[4] = uint8(len(data) / 8)
+	data = append(data, product...)
+	data[5] = uint8(len(data) / 8)
+	data[7] = -zeroChecksum(data[:7])
+
+	data = append(data, testFRUMultiRecord(FRURecordPowerSupply, false, []byte{
+		0x20, 0x03, 0x00, 0x00, 0x1e, 0x05, 0x10, 0x27, 0x98, 0x3a, 0x00, 0x00, 0x00, 0x00,
+		0x2f, 0x3f, 0x14, 0x0e, 0x84, 0x13, 0x00, 0x00, 0x00, 0x00})...)
+	data = append(data, testFRUMultiRecord(FRURecordDCOutput, false, []byte{
+		0x81, 0xb0, 0x04, 0x3c, 0x00, 0x3c, 0x00, 0x32, 0x00, 0x00, 0x00, 0x10, 0x27})...)
+	data = append(data, testFRUMultiRecord(FRURecordManagementAccess, true, []byte{
+		FRUAccessSystemUniqueID, 0x33, 0x22, 0x11, 0x00, 0x55, 0x44, 0x77, 0x66,
+		0x88, 0x99, 0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff})...)
+	return data
+}
+
+func TestParseFRU(t *testing.T) {
+	fru, e := ParseFRU(testFRU())
+	if e != nil {
+		t.Fatal(e)
+	}
+	assertEquals(t, "Chassis", *fru.Chassis, FRUChassisArea{Type: 0x17,
+		PartNumber: "CH-PART", SerialNumber: "CH-SERIAL", Custom: []string{"extra"}})
+	assertEquals(t, "Chassis.Type", fru.Chassis.TypeString(), "Rack Mount Chassis")
+	assertEquals(t, "Board", *fru.Board, FRUBoardArea{
+		MfgDate:      time.Date(1996, 1, 1, 0, 0, 0, 0, time.UTC).Add(0x0be460 * time.Minute),
+		Manufacturer: "ACME", ProductName: "Mainboard", SerialNumber: "BD123", PartNumber: "PN-1"})
+	assertEquals(t, "Product", *fru.Product, FRUProductArea{Language: 0x19,
+		Manufacturer: "ACME", Name: "Server", PartNumber: "M-1", Version: "1.0",
+		SerialNumber: "SN-42", AssetTag: "ASSET-7"})
+
+	assertEquals(t, "MultiRecords", len(fru.MultiRecords), 3)
+	assertEquals(t, "PowerSupply", *fru.MultiRecords[0].(*FRUPowerSupplyRecord), FRUPowerSupplyRecord{
+		FRUMultiRecordHeader: FRUMultiRecordHeader{TypeID: FRURecordPowerSupply, Version: 2, Length: 24},
+		OverallCapacity:      800, InrushCurrent: 30, InrushInterval: 5,
+		LowInputVoltage1: 10000, HighInputVoltage1: 15000,
+		LowInputFrequency: 47, HighInputFrequency: 63, DropoutTolerance: 20,
+		Flags:       FRUPowerSupplyHotSwap | FRUPowerSupplyAutoSwitch | FRUPowerSupplyPowerFactor,
+		PeakWattage: 900, HoldUpTime: 1})
+	assertEquals(t, "DCOutput", *fru.MultiRecords[1].(*FRUDCOutputRecord), FRUDCOutputRecord{
+		FRUMultiRecordHeader: FRUMultiRecordHeader{TypeID: FRURecordDCOutput, Version: 2, Length: 13},
+		Standby:              true, OutputNumber: 1, NominalVoltage: 1200,
+		MaxNegativeDeviation: 60, MaxPositiveDeviation: 60, RippleNoise: 50, MaxCurrent: 10000})
+	assertEquals(t, "UUID", fru.UUID(), "00112233-4455-6677-8899-aabbccddeeff")
+	assertEquals(t, "EndOfList", fru.MultiRecords[2].GetHeader().EndOfList, true)
+}
+
+func TestParseFRUChecksum(t *testing.T) {
+	data := testFRU()
+	data[0x0a]++ // chassis part number
+	if _, e := ParseFRU(data); e == nil || e.Error() != "FRU chassis area checksum is invalid." {
+		t.Error("excepted is chassis checksum error, actual is", e)
+	}
+
+	data = testFRU()
+	data[6]++
+	if _, e := ParseFRU(data); e == nil {
+		t.Error("excepted is header checksum error")
+	}
+}
+
+func TestReadFRU(t *testing.T) {
+	data := testFRU()
+	h := &fakeHandler{handle: func(cmd commands.CommandCode, req []byte) (protocol.CompletionCode, []byte) {
+		switch cmd {
+		case GetFRUInventoryAreaInfo:
+			return protocol.CommandCompleted, []byte{uint8(len(data)), uint8(len(data) >> 8), 0x00}
+		case ReadFRUData:
+			offset := int(req[1]) | int(req[2])<<8
+			count := int(req[3])
+			if count > 16 {
+				return protocol.ErrLongPacket, nil
+			}
+			bs := data[offset : offset+count]
+			return protocol.CommandCompleted, append([]byte{uint8(len(bs))}, bs...)
+		default:
+			return protocol.ErrInvalidCommand, nil
+		}
+	}}
+	c := &Client{ClientHandler: h}
+
+	bs, e := c.ReadFRUBytes(0)
+	if e != nil {
+		t.Fatal(e)
+	}
+	assertEquals(t, "data", bs, data)
+	// 32 and 24 bytes are too long
+	assertEquals(t, "request", h.requests[1].data, []byte{0x00, 0x00, 0x00, 32})
+	assertEquals(t, "request", h.requests[2].data, []byte{0x00, 0x00, 0x00, 24})
+	assertEquals(t, "request", h.requests[3].data, []byte{0x00, 0x00, 0x00, 16})
+	assertEquals(t, "request", h.requests[4].data, []byte{0x00, 0x10, 0x00, 16})
+
+	fru, e := c.ReadFRU(0)
+	if e != nil {
+		t.Fatal(e)
+	}
+	assertEquals(t, "AssetTag", fru.Product.AssetTag, "ASSET-7")
+}
+
+func TestEncodeFRU(t *testing.T) {
+	data := testFRU()
+	fru, e := ParseFRU(data)
+	if e != nil {
+		t.Fatal(e)
+	}
+	bs, e := protocol.ToBytes(fru)
+	if e != nil {
+		t.Fatal(e)
+	}
+	assertEquals(t, "data", bs, data)
+
+	fru.Board.SetField(FRUBoardCustom+1, "custom")
+	fru.Chassis = nil
+	if bs, e = protocol.ToBytes(fru); e != nil {
+		t.Fatal(e)
+	}
+	parsed, e := ParseFRU(bs)
+	if e != nil {
+		t.Fatal(e)
+	}
+	assertEquals(t, "Chassis", parsed.Chassis, (*FRUChassisArea)(nil))
+	assertEquals(t, "Board", parsed.Board, fru.Board)
+	assertEquals(t, "Board.Custom", parsed.Board.Custom, []string{"", "custom"})
+	assertEquals(t, "MultiRecords", parsed.MultiRecords, fru.MultiRecords)
+
+	fru.Product.AssetTag = string(make([]byte, 64))
+	if _, e = protocol.ToBytes(fru); e == nil {
+		t.Error("excepted is too long error")
+	}
+}
+
+func TestEncodeFRUFields(t *testing.T) {
+	fru, e := ParseFRU(testFRU())
+	if e != nil {
+		t.Fatal(e)
+	}
+	// the fields of one byte aren't the end marker
+	fru.Product.Version = "1"
+	fru.Product.SerialNumber = "x"
+	bs, e := protocol.ToBytes(fru)
+	if e != nil {
+		t.Fatal(e)
+	}
+	parsed, e := ParseFRU(bs)
+	if e != nil {
+		t.Fatal(e)
+	}
+	assertEquals(t, "Version", parsed.Product.Version, "1")
+	assertEquals(t, "SerialNumber", parsed.Product.SerialNumber, "x")
+	assertEquals(t, "AssetTag", parsed.Product.AssetTag, "ASSET-7")
+
+	// the fields that aren't changed keep their types
+	board := []byte{0x01, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0xc4, 'A', 'C', 'M', 'E',
+		0x82, 0x29, 0xdc, // "IPM" as 6-bit packed ASCII
+		0x41, 0x12, // "12" as BCD plus
+		0xc0, 0xc0,
+		0x02, 0x9a, 0xff, // binary
+		0xc1}
+	for (len(board)+1)%8 != 0 {
+		board = append(board, 0)
+	}
+	board[1] = uint8((len(board) + 1) / 8)
+	board = append(board, -zeroChecksum(board))
+	data := []byte{0x01, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0xfe}
+	data = append(data, board...)
+	if fru, e = ParseFRU(data); e != nil {
+		t.Fatal(e)
+	}
+	fru.Board.PartNumber = "PN-2"
+	if bs, e = protocol.ToBytes(fru); e != nil {
+		t.Fatal(e)
+	}
+	assertEquals(t, "fields", bs[8+6:8+16], board[6:16])
+	assertEquals(t, "custom", bs[8+22:8+26], []byte{0x02, 0x9a, 0xff, 0xc1})
+}
+
+// fakeFRUStorage is a FRU device of size bytes that accepts at most 16
+// bytes per request.
+func fakeFRUStorage(data []byte, size int) (*fakeHandler, []byte) {
+	storage := make([]byte, size)
+	copy(storage, data)
+	return &fakeHandler{handle: func(cmd commands.CommandCode, req []byte) (protocol.CompletionCode, []byte) {
+		switch cmd {
+		case GetFRUInventoryAreaInfo:
+			return protocol.CommandCompleted, []byte{uint8(size), uint8(size >> 8), 0x00}
+		case ReadFRUData:
+			offset := int(req[1]) | int(req[2])<<8
+			bs := storage[offset : offset+int(req[3])]
+			return protocol.CommandCompleted, append([]byte{uint8(len(bs))}, bs...)
+		case WriteFRUData:
+			offset := int(req[1]) | int(req[2])<<8
+			if len(req) > 3+16 {
+				return protocol.ErrRequestData, nil
+			}
+			copy(storage[offset:], req[3:])
+			return protocol.CommandCompleted, []byte{uint8(len(req) - 3)}
+		default:
+			return protocol.ErrInvalidCommand, nil
+		}
+	}}, storage
+}
+
+func TestSetProductAssetTag(t *testing.T) {
+	data := testFRU()
+	h, storage := fakeFRUStorage(data, 512)
+	c := &Client{ClientHandler: h}
+
+	// the tag fits in the product area
+	if e := c.SetProductAssetTag(0, "A-1"); e != nil {
+		t.Fatal(e)
+	}
+	fru, e := ParseFRU(storage)
+	if e != nil {
+		t.Fatal(e)
+	}
+	assertEquals(t, "AssetTag", fru.Product.AssetTag, "A-1")
+	assertEquals(t, "CommonHeader", storage[:8], data[:8])
+	productOffset := int(data[4]) * 8
+	for i := range data {
+		if data[i] != storage[i] && (i < productOffset || i >= productOffset+int(data[productOffset+1])*8) {
+			t.Error("byte", i, "out of the product area is changed")
+			break
+		}
+	}
+
+	// the product area is grown, so the multi records are moved
+	tag := "ASSET-TAG-THAT-DOES-NOT-FIT-IN-THE-PRODUCT-AREA"
+	if e := c.SetProductAssetTag(0, tag); e != nil {
+		t.Fatal(e)
+	}
+	if fru, e = ParseFRU(storage); e != nil {
+		t.Fatal(e)
+	}
+	assertEquals(t, "AssetTag", fru.Product.AssetTag, tag)
+	assertEquals(t, "UUID", fru.UUID(), "00112233-4455-6677-8899-aabbccddeeff")
+
+	if e := c.SetBoardField(0, FRUBoardSerialNumber, "BD456"); e != nil {
+		t.Fatal(e)
+	}
+	if fru, e = ParseFRU(storage); e != nil {
+		t.Fatal(e)
+	}
+	assertEquals(t, "SerialNumber", fru.Board.SerialNumber, "BD456")
+	assertEquals(t, "AssetTag", fru.Product.AssetTag, tag)
+
+	// nothing is written if the field isn't changed
+	h.requests = nil
+	if e := c.SetBoardField(0, FRUBoardSerialNumber, "BD456"); e != nil {
+		t.Fatal(e)
+	}
+	for _, req := range h.requests {
+		if req.cmd == WriteFRUData {
+			t.Error("the FRU data is written")
+		}
+	}
+
+	// a tag of one character doesn't end the fields
+	if e := c.SetProductAssetTag(0, "X"); e != nil {
+		t.Fatal(e)
+	}
+	if fru, e = ParseFRU(storage); e != nil {
+		t.Fatal(e)
+	}
+	assertEquals(t, "AssetTag", fru.Product.AssetTag, "X")
+	assertEquals(t, "SerialNumber", fru.Product.SerialNumber, "SN-42")
+
+	// the FRU inventory area is too small
+	h, _ = fakeFRUStorage(data, len(data))
+	c = &Client{ClientHandler: h}
+	if e := c.SetProductAssetTag(0, tag); e == nil {
+		t.Error("excepted is too large error")
+	}
+}
@@ -1,7 +1,10 @@
 package goipmi
 
 import (
+	"errors"
 	"fmt"
+	"strconv"
+	"time"
 
 	"github.com/runner-mei/goipmi/protocol"
 )
@@ -69,6 +72,59 @@ func (self *GetSELResponse) ReadBytes(r *protocol.Reader) {
 	self.Data.Write(r.ReadBytes(r.Len()))
 }
 
+// AddSELEntryRequest per section 31.6
+type AddSELEntryRequest struct {
+	Record SELRecord
+}
+
+func (self *AddSELEntryRequest) WriteBytes(w *protocol.Writer) {
+	self.Record.WriteBytes(w)
+}
+
+type AddSELEntryResponse struct {
+	// CompletionCode
+	RecordId uint16 // LS Byte first
+}
+
+// DeleteSELEntryRequest per section 31.8
+type DeleteSELEntryRequest struct {
+	ReservationId uint16 // LS Byte first
+	RecordId      uint16 // LS Byte first
+}
+
+type DeleteSELEntryResponse struct {
+	// CompletionCode
+	RecordId uint16 // LS Byte first
+}
+
+// Operations of ClearSELRequest
+const (
+	SELEraseStatus   = 0x00
+	SELEraseInitiate = 0xaa
+)
+
+// ClearSELRequest per section 31.9
+type ClearSELRequest struct {
+	ReservationId uint16 // LS Byte first
+	Operation     uint8
+}
+
+func (self *ClearSELRequest) WriteBytes(w *protocol.Writer) {
+	w.WriteUint16(self.ReservationId)
+	w.WriteBytes([]byte("CLR"))
+	w.WriteUint8(self.Operation)
+}
+
+type ClearSELResponse struct {
+	// CompletionCode
+	ErasureProgress uint8
+}
+
+// IsCompleted returns true if the erasure is completed.
+func (self *ClearSELResponse) IsCompleted() bool {
+	return self.ErasureProgress&0x0f == 0x01
+}
+
 // section 31.10
 type GetSELTimeRequest struct {
 }
@@ -78,6 +134,49 @@ type GetSELTimeResponse struct {
 	Time uint32 // LS Byte first
 }
 
+// SetSELTimeRequest per section 31.11
+type SetSELTimeRequest struct {
+	Time uint32 // LS Byte first
+}
+
+type SetSELTimeResponse struct {
+	// CompletionCode
+}
+
+// the SEL time UTC offset is unspecified
+const SELTimeUTCOffsetUnspecified = 0x7ff
+
+// GetSELTimeUTCOffsetRequest per section 31.11a
+type GetSELTimeUTCOffsetRequest struct {
+}
+
+type GetSELTimeUTCOffsetResponse struct {
+	// CompletionCode
+	Offset int16 // minutes, LS Byte first
+}
+
+// IsSpecified returns false if the offset is unspecified.
+func (self *GetSELTimeUTCOffsetResponse) IsSpecified() bool {
+	return self.Offset != SELTimeUTCOffsetUnspecified
+}
+
+// Duration returns the offset of the local time of the BMC from UTC.
+func (self *GetSELTimeUTCOffsetResponse) Duration() time.Duration {
+	if !self.IsSpecified() {
+		return 0
+	}
+	return time.Duration(self.Offset) * time.Minute
+}
+
+// SetSELTimeUTCOffsetRequest per section 31.11b
+type SetSELTimeUTCOffsetRequest struct {
+	Offset int16 // minutes, LS Byte first
+}
+
+type SetSELTimeUTCOffsetResponse struct {
+	// CompletionCode
+}
+
 // section 31.12
 type GetAuxiliaryLogStatusRequest struct {
 	Type uint8
@@ -91,3 +190,283 @@ type GetAuxiliaryLogStatusResponse struct {
 func (self *GetAuxiliaryLogStatusResponse) ReadBytes(r *protocol.Reader) {
 	self.Data = r.ReadCopy(r.Len())
 }
+
+// SELRecord is a SEL record per section 32, it is a *SELEventRecord, a
+// *SELOEMTimestampedRecord or a *SELOEMRecord.
+type SELRecord interface {
+	protocol.Readable
+	protocol.Writable
+
+	GetHeader() SELRecordHeader
+}
+
+type SELRecordHeader struct {
+	RecordId   uint16
+	RecordType uint8
+}
+
+// SEL record types per section 32.1
+const (
+	SELRecordTypeSystemEvent       = 0x02
+	SELRecordTypeOEMTimestampedMin = 0xc0
+	SELRecordTypeOEMTimestampedMax = 0xdf
+	SELRecordTypeOEMMin            = 0xe0
+)
+
+// selTime converts the SEL timestamp, it is zero if the timestamp is
+// unspecified. The timestamps up to 0x20000000 are relative to the
+// initialization of the BMC.
+func selTime(v uint32) time.Time {
+	if v == 0xffffffff {
+		return time.Time{}
+	}
+	return time.Unix(int64(v), 0).UTC()
+}
+
+func selTimestamp(t time.Time) uint32 {
+	if t.IsZero() {
+		return 0xffffffff
+	}
+	return uint32(t.Unix())
+}
+
+// SELEventRecord is the system event record per section 32.1.
+type SELEventRecord struct {
+	SELRecordHeader
+
+	Timestamp    time.Time
+	GeneratorID  uint16 // LS Byte first
+	EvMRev       uint8
+	SensorType   uint8
+	SensorNumber uint8
+	Deassertion  bool
+	EventType    uint8 // event/reading type code
+	EventData    [3]uint8
+}
+
+func (self *SELEventRecord) GetHeader() SELRecordHeader {
+	return self.SELRecordHeader
+}
+
+func (self *SELEventRecord) ReadBytes(r *protocol.Reader) {
+	self.RecordId = r.ReadUint16()
+	self.RecordType = r.ReadUint8()
+	self.Timestamp = selTime(r.ReadUint32())
+	self.GeneratorID = r.ReadUint16()
+	self.EvMRev = r.ReadUint8()
+	self.SensorType = r.ReadUint8()
+	self.SensorNumber = r.ReadUint8()
+	dirType := r.ReadUint8()
+	self.Deassertion = dirType&0x80 != 0
+	self.EventType = dirType & 0x7f
+	self.EventData[0] = r.ReadUint8()
+	self.EventData[1] = r.ReadUint8()
+	self.EventData[2] = r.ReadUint8()
+}
+
+func (self *SELEventRecord) WriteBytes(w *protocol.Writer) {
+	w.WriteUint16(self.RecordId)
+	w.WriteUint8(SELRecordTypeSystemEvent)
+	w.WriteUint32(selTimestamp(self.Timestamp))
+	w.WriteUint16(self.GeneratorID)
+	w.WriteUint8(self.EvMRev)
+	w.WriteUint8(self.SensorType)
+	w.WriteUint8(self.SensorNumber)
+	dirType := self.EventType & 0x7f
+	if self.Deassertion {
+		dirType |= 0x80
+	}
+	w.WriteUint8(dirType)
+	w.WriteBytes(self.EventData[:])
+}
+
+// Generator returns the controller that generated the event, the events
+// that are generated by the system software are of the BMC.
+func (self *SELEventRecord) Generator() Target {
+	return sensorOwner(uint8(self.GeneratorID), uint8(self.GeneratorID>>8))
+}
+
+// Offset returns the event offset of the event data 1.
+func (self *SELEventRecord) Offset() uint8 {
+	return self.EventData[0] & 0x0f
+}
+
+// EventString returns the event per table 42-2 for the threshold and
+// generic events and per table 42-3 for the sensor-specific events.
+func (self *SELEventRecord) EventString() string {
+	offset := self.Offset()
+	switch {
+	case self.EventType == 0x01:
+		if int(offset) < len(thresholdEvents) {
+			if self.Deassertion {
+				return thresholdEvents[offset].name + "_deassertion"
+			}
+			return thresholdEvents[offset].name + "_assertion"
+		}
+	default:
+		if name := discreteStateName(self.EventType, self.SensorType, offset); name != "" {
+			return discreteEventString(name, !self.Deassertion)
+		}
+	}
+	return discreteEventString("event offset "+strconv.Itoa(int(offset)), !self.Deassertion)
+}
+
+// Description returns the sensor and the event of the record, e.g.
+// "Power Supply #0x52 Power Supply Failure detected(assertion)".
+func (self *SELEventRecord) Description() string {
+	return SensorTypeName(self.SensorType) + " #0x" + strconv.FormatUint(uint64(self.SensorNumber), 16) +
+		" " + self.EventString()
+}
+
+// SELOEMTimestampedRecord is the OEM timestamped record per section 32.2.
+type SELOEMTimestampedRecord struct {
+	SELRecordHeader
+
+	Timestamp      time.Time
+	ManufacturerID uint32 // 3 bytes, LS Byte first
+	Data           [6]uint8
+}
+
+func (self *SELOEMTimestampedRecord) GetHeader() SELRecordHeader {
+	return self.SELRecordHeader
+}
+
+func (self *SELOEMTimestampedRecord) ReadBytes(r *protocol.Reader) {
+	self.RecordId = r.ReadUint16()
+	self.RecordType = r.ReadUint8()
+	self.Timestamp = selTime(r.ReadUint32())
+	self.ManufacturerID = uint32(r.ReadUint16())
+	self.ManufacturerID |= uint32(r.ReadUint8()) << 16
+	if r.Len() < len(self.Data) {
+		r.SetError(ErrInsufficientBytes)
+		return
+	}
+	copy(self.Data[:], r.ReadBytes(len(self.Data)))
+}
+
+func (self *SELOEMTimestampedRecord) WriteBytes(w *protocol.Writer) {
+	w.WriteUint16(self.RecordId)
+	w.WriteUint8(self.RecordType)
+	w.WriteUint32(selTimestamp(self.Timestamp))
+	w.WriteUint16(uint16(self.ManufacturerID))
+	w.WriteUint8(uint8(self.ManufacturerID >> 16))
+	w.WriteBytes(self.Data[:])
+}
+
+// Description returns the manufacturer and the data of the record.
+func (self *SELOEMTimestampedRecord) Description() string {
+	return fmt.Sprintf("OEM record %02x, manufacturer %d, data % x", self.RecordType, self.ManufacturerID, self.Data[:])
+}
+
+// SELOEMRecord is the OEM non-timestamped record per section 32.3.
+type SELOEMRecord struct {
+	SELRecordHeader
+
+	Data [13]uint8
+}
+
+func (self *SELOEMRecord) GetHeader() SELRecordHeader {
+	return self.SELRecordHeader
+}
+
+func (self *SELOEMRecord) ReadBytes(r *protocol.Reader) {
+	self.RecordId = r.ReadUint16()
+	self.RecordType = r.ReadUint8()
+	if r.Len() < len(self.Data) {
+		r.SetError(ErrInsufficientBytes)
+		return
+	}
+	copy(self.Data[:], r.ReadBytes(len(self.Data)))
+}
+
+func (self *SELOEMRecord) WriteBytes(w *protocol.Writer) {
+	w.WriteUint16(self.RecordId)
+	w.WriteUint8(self.RecordType)
+	w.WriteBytes(self.Data[:])
+}
+
+// Description returns the data of the record.
+func (self *SELOEMRecord) Description() string {
+	return fmt.Sprintf("OEM record %02x, data % x", self.RecordType, self.Data[:])
+}
+
+func (self *RecordData) ToSELRecord() (SELRecord, error) {
+	if !self.SelIsOk() {
+		return nil, errors.New("SEL record length is " + strconv.Itoa(len(self.Data)) + ", excepted is 16.")
+	}
+
+	var result SELRecord
+	switch recordType := self.Data[2]; {
+	case recordType == SELRecordTypeSystemEvent:
+		result = &SELEventRecord{}
+	case recordType >= SELRecordTypeOEMTimestampedMin && recordType <= SELRecordTypeOEMTimestampedMax:
+		result = &SELOEMTimestampedRecord{}
+	case recordType >= SELRecordTypeOEMMin:
+		result = &SELOEMRecord{}
+	default:
+		return nil, errors.New("unknown SEL record type - " + strconv.FormatUint(uint64(recordType), 10))
+	}
+
+	var reader = protocol.NewReader(self.Data)
+	result.ReadBytes(reader)
+	if reader.Err() != nil {
+		return nil, reader.Err()
+	}
+	return result, nil
+}
+
+// sensorSpecificEvents per table 42-3, they are keyed by the sensor type and
+// indexed by the event offset.
+var sensorSpecificEvents = map[uint8][]string{
+	SENSOR_PHYSICALSECURITY: {"General Chassis Intrusion", "Drive Bay intrusion",
+		"I/O Card area intrusion", "Processor area intrusion", "LAN Leash Lost",
+		"Unauthorized dock", "FAN area intrusion"},
+	SENSOR_PROCESSOR: {"IERR", "Thermal Trip", "FRB1/BIST failure",
+		"FRB2/Hang in POST failure", "FRB3/Processor Startup/Initialization failure",
+		"Configuration Error", "SM BIOS Uncorrectable CPU-complex Error",
+		"Processor Presence detected", "Processor disabled", "Terminator Presence Detected",
+		"Processor Automatically Throttled", "Machine Check Exception (Uncorrectable)",
+		"Correctable Machine Check Error"},
+	SENSOR_POWERSUPPLY: {"Presence detected", "Power Supply Failure detected",
+		"Predictive Failure", "Power Supply input lost (AC/DC)",
+		"Power Supply input lost or out-of-range", "Power Supply input out-of-range, but present",
+		"Configuration error", "Power Supply Inactive"},
+	SENSOR_POWERUNIT: {"Power Off / Power Down", "Power Cycle", "240VA Power Down",
+		"Interlock Power Down", "AC lost / Power input lost", "Soft Power Control Failure",
+		"Power Unit Failure detected", "Predictive Failure"},
+	SENSOR_MEMORY: {"Correctable ECC", "Uncorrectable ECC", "Parity", "Memory Scrub Failed",
+		"Memory Device Disabled", "Correctable ECC logging limit reached",
+		"Presence detected", "Configuration error", "Spare",
+		"Memory Automatically Throttled", "Critical Overtemperature"},
+	SENSOR_DRIVEBAY: {"Drive Presence", "Drive Fault", "Predictive Failure", "Hot Spare",
+		"Consistency Check / Parity Check in progress", "In Critical Array",
+		"In Failed Array", "Rebuild/Remap in progress", "Rebuild/Remap Aborted"},
+	SENSOR_SYSTEMFIRMWAREPROGESS: {"System Firmware Error (POST Error)",
+		"System Firmware Hang", "System Firmware Progress"},
+	SENSOR_EVENTLOGGINGDISABLED: {"Correctable Memory Error Logging Disabled",
+		"Event Type Logging Disabled", "Log Area Reset/Cleared", "All Event Logging Disabled",
+		"SEL Full", "SEL Almost Full", "Correctable Machine Check Error Logging Disabled"},
+	SENSOR_SYSTEMEVENT: {"System Reconfigured", "OEM System Boot Event",
+		"Undetermined system hardware failure", "Entry added to Auxiliary Log",
+		"PEF Action", "Timestamp Clock Synch"},
+	SENSOR_CRITICALINTERRUPT: {"Front Panel NMI / Diagnostic Interrupt", "Bus Timeout",
+		"I/O channel check NMI", "Software NMI", "PCI PERR", "PCI SERR",
+		"EISA Fail Safe Timeout", "Bus Correctable Error", "Bus Uncorrectable Error",
+		"Fatal NMI", "Bus Fatal Error", "Bus Degraded"},
+	SENSOR_BUTTONSWITCH: {"Power Button pressed", "Sleep Button pressed",
+		"Reset Button pressed", "FRU latch open", "FRU service request button"},
+	SENSOR_SYSTEMBOOT: {"Initiated by power up", "Initiated by hard reset",
+		"Initiated by warm reset", "User requested PXE boot", "Automatic boot to diagnostic",
+		"OS / run-time software initiated hard reset",
+		"OS / run-time software initiated warm reset", "System Restart"},
+	SENSOR_OSBOOT: {"A: boot completed", "C: boot completed", "PXE boot completed",
+		"Diagnostic boot completed", "CD-ROM boot completed", "ROM boot completed",
+		"boot completed - boot device not specified"},
+	SENSOR_OSSTOP: {"Critical stop during OS load / initialization", "Run-time Critical Stop",
+		"OS Graceful Stop", "OS Graceful Shutdown", "Soft Shutdown initiated by PEF",
+		"Agent Not Responding"},
+	SENSOR_WATCHDOG2: {"Timer expired", "Hard Reset", "Power Down", "Power Cycle",
+		"", "", "", "", "Timer interrupt"},
+	SENSOR_ENTITYPRESENCE: {"Entity Present", "Entity Absent", "Entity Disabled"},
+	SENSOR_BATTERY:        {"battery low", "battery failed", "battery presence detected"},
+}
@@ -0,0 +1,372 @@
+package goipmi
+
+import (
+	"context"
+	"encoding/binary"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/runner-mei/goipmi/protocol"
+	"github.com/runner-mei/goipmi/protocol/commands"
+)
+
+var testSELRecords = [][]byte{
+	// temperature upper critical going high
+	{0x01, 0x00, 0x02, 0x00, 0x10, 0x5e, 0x5f, 0x20, 0x00, 0x04, 0x01, 0x30, 0x01, 0x59, 0x5a, 0x55},
+	// power supply input lost, deasserted, by the controller 0x2c on channel 1
+	{0x02, 0x00, 0x02, 0x00, 0x10, 0x5e, 0x5f, 0x2c, 0x12, 0x04, 0x08, 0x52, 0xef, 0x03, 0xff, 0xff},
+	// device inserted, by the system software
+	{0x03, 0x00, 0x02, 0xff, 0xff, 0xff, 0xff, 0x41, 0x00, 0x04, 0x0d, 0x01, 0x08, 0x01, 0xff, 0xff},
+	{0x04, 0x00, 0xc1, 0x00, 0x10, 0x5e, 0x5f, 0x57, 0x01, 0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06},
+	{0x05, 0x00, 0xe0, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d},
+}
+
+func TestSELRecords(t *testing.T) {
+	var records []SELRecord
+	for _, bs := range testSELRecords {
+		data := RecordData{Data: bs}
+		record, e := data.ToSELRecord()
+		if e != nil {
+			t.Fatal(e)
+		}
+		records = append(records, record)
+	}
+
+	timestamp := time.Date(2020, 9, 13, 12, 26, 40, 0, time.UTC)
+	threshold := records[0].(*SELEventRecord)
+	assertEquals(t, "threshold", *threshold, SELEventRecord{
+		SELRecordHeader: SELRecordHeader{RecordId: 1, RecordType: SELRecordTypeSystemEvent},
+		Timestamp:       timestamp, GeneratorID: 0x0020, EvMRev: 0x04,
+		SensorType: SENSOR_TEMPERATURE, SensorNumber: 0x30, EventType: 0x01,
+		EventData: [3]uint8{0x59, 0x5a, 0x55}})
+	assertEquals(t, "Generator", threshold.Generator(), Target{Address: 0x20})
+	assertEquals(t, "Description", threshold.Description(), "Temperature #0x30 upper_critical_going_high_assertion")
+	deasserted := *threshold
+	deasserted.Deassertion = true
+	assertEquals(t, "Description", deasserted.EventString(), "upper_critical_going_high_deassertion")
+
+	specific := records[1].(*SELEventRecord)
+	assertEquals(t, "Deassertion", specific.Deassertion, true)
+	assertEquals(t, "Generator", specific.Generator(), Target{Address: 0x2c, Channel: 1, LUN: 2})
+	assertEquals(t, "Description", specific.Description(), "Power Supply #0x52 Power Supply input lost (AC/DC -- deassertion)")
+
+	generic := records[2].(*SELEventRecord)
+	assertEquals(t, "Timestamp", generic.Timestamp.IsZero(), true)
+	assertEquals(t, "Generator", generic.Generator(), Target{})
+	assertEquals(t, "Description", generic.Description(), "Drive Slot / Bay #0x1 device inserted(assertion)")
+
+	assertEquals(t, "oem timestamped", *records[3].(*SELOEMTimestampedRecord), SELOEMTimestampedRecord{
+		SELRecordHeader: SELRecordHeader{RecordId: 4, RecordType: 0xc1},
+		Timestamp:       timestamp, ManufacturerID: 343,
+		Data: [6]uint8{0x01, 0x02, 0x03, 0x04, 0x05, 0x06}})
+	assertEquals(t, "oem", records[4].(*SELOEMRecord).Data[12], uint8(0x0d))
+
+	data := RecordData{Data: []byte{0x06, 0x00, 0x03, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}}
+	if _, e := data.ToSELRecord(); e == nil {
+		t.Error("excepted is unknown record type error")
+	}
+}
+
+func TestListSELRecords(t *testing.T) {
+	h := &fakeHandler{handle: func(cmd commands.CommandCode, req []byte) (protocol.CompletionCode, []byte) {
+		if cmd != GetSELEntry {
+			return protocol.ErrInvalidCommand, nil
+		}
+		index := int(req[2]) | int(req[3])<<8
+		if index == 0 {
+			index = 1
+		}
+		next := []byte{uint8(index + 1), 0x00}
+		if index == len(testSELRecords) {
+			next = []byte{0xff, 0xff}
+		}
+		return protocol.CommandCompleted, append(next, testSELRecords[index-1]...)
+	}}
+	c := &Client{ClientHandler: h}
+
+	records, e := c.ListSELRecords(0)
+	if e != nil {
+		t.Fatal(e)
+	}
+	assertEquals(t, "records", len(records), len(testSELRecords))
+	for i, record := range records {
+		assertEquals(t, "RecordId", record.GetHeader().RecordId, uint16(i+1))
+	}
+}
+
+func TestClearSEL(t *testing.T) {
+	selErasePollInterval = time.Millisecond
+	defer func() { selErasePollInterval = 100 * time.Millisecond }()
+
+	reservation, polls := uint16(0), 0
+	h := &fakeHandler{handle: func(cmd commands.CommandCode, req []byte) (protocol.CompletionCode, []byte) {
+		switch cmd {
+		case ReserveSEL:
+			reservation++
+			return protocol.CommandCompleted, []byte{uint8(reservation), 0x00}
+		case ClearSEL:
+			if uint16(req[0]) != reservation || string(req[2:5]) != "CLR" {
+				return protocol.ErrInvalidResv, nil
+			}
+			if req[5] == SELEraseInitiate {
+				reservation++ // the erasure cancels the reservation
+				return protocol.CommandCompleted, []byte{0x00}
+			}
+			if polls++; polls < 3 {
+				return protocol.CommandCompleted, []byte{0x00}
+			}
+			return protocol.CommandCompleted, []byte{0x01}
+		default:
+			return protocol.ErrInvalidCommand, nil
+		}
+	}}
+	c := &Client{ClientHandler: h}
+
+	if e := c.ClearSEL(); e != nil {
+		t.Fatal(e)
+	}
+	assertEquals(t, "polls", polls, 3)
+	assertEquals(t, "initiate", h.requests[1].data, []byte{0x01, 0x00, 'C', 'L', 'R', 0xaa})
+}
+
+func TestDeleteSELEntry(t *testing.T) {
+	reservation := uint16(0)
+	h := &fakeHandler{handle: func(cmd commands.CommandCode, req []byte) (protocol.CompletionCode, []byte) {
+		switch cmd {
+		case ReserveSEL:
+			reservation++
+			return protocol.CommandCompleted, []byte{uint8(reservation), 0x00}
+		case DeleteSELEntry:
+			if reservation == 1 { // cancelled by a new record
+				return protocol.ErrInvalidResv, nil
+			}
+			return protocol.CommandCompleted, req[2:4]
+		default:
+			return protocol.ErrInvalidCommand, nil
+		}
+	}}
+	c := &Client{ClientHandler: h}
+
+	if e := c.DeleteSELEntry(0x0102); e != nil {
+		t.Fatal(e)
+	}
+	assertEquals(t, "delete", h.requests[3].data, []byte{0x02, 0x00, 0x02, 0x01})
+}
+
+func TestAddSELEntry(t *testing.T) {
+	h := &fakeHandler{handle: func(cmd commands.CommandCode, req []byte) (protocol.CompletionCode, []byte) {
+		return protocol.CommandCompleted, []byte{0x07, 0x00}
+	}}
+	c := &Client{ClientHandler: h}
+
+	for _, bs := range testSELRecords {
+		data := RecordData{Data: bs}
+		record, e := data.ToSELRecord()
+		if e != nil {
+			t.Fatal(e)
+		}
+		id, e := c.AddSELEntry(record)
+		if e != nil {
+			t.Fatal(e)
+		}
+		assertEquals(t, "RecordId", id, uint16(7))
+		assertEquals(t, "request", h.requests[len(h.requests)-1].data, bs)
+	}
+}
+
+func TestSELTime(t *testing.T) {
+	h := &fakeHandler{handle: func(cmd commands.CommandCode, req []byte) (protocol.CompletionCode, []byte) {
+		switch cmd {
+		case GetSELTime:
+			return protocol.CommandCompleted, []byte{0x00, 0x10, 0x5e, 0x5f}
+		case GetSELTimeUTCOffset:
+			return protocol.CommandCompleted, []byte{0xc4, 0xff} // -60
+		default:
+			return protocol.CommandCompleted, nil
+		}
+	}}
+	c := &Client{ClientHandler: h}
+
+	now, e := c.GetSELTime()
+	if e != nil {
+		t.Fatal(e)
+	}
+	assertEquals(t, "time", now, time.Date(2020, 9, 13, 12, 26, 40, 0, time.UTC))
+	if e := c.SetSELTime(now.In(time.FixedZone("", 3600))); e != nil {
+		t.Fatal(e)
+	}
+	assertEquals(t, "set time", h.requests[1].data, []byte{0x00, 0x10, 0x5e, 0x5f})
+
+	offset, e := c.GetSELTimeUTCOffset()
+	if e != nil {
+		t.Fatal(e)
+	}
+	assertEquals(t, "offset", offset.Duration(), -time.Hour)
+	if e := c.SetSELTimeUTCOffset(8 * time.Hour); e != nil {
+		t.Fatal(e)
+	}
+	assertEquals(t, "set offset", h.requests[3].data, []byte{0xe0, 0x01})
+	if e := c.SetSELTimeUTCOffset(25 * time.Hour); e == nil {
+		t.Error("excepted is out of range error")
+	}
+}
+
+// fakeSEL is a SEL whose records are read by Get SEL Entry, the entries are
+// read with the reservation only.
+type fakeSEL struct {
+	mu          sync.Mutex
+	records     [][]byte
+	addTime     uint32
+	delTime     uint32
+	reservation uint16
+}
+
+func (sel *fakeSEL) add(id uint16) {
+	sel.mu.Lock()
+	defer sel.mu.Unlock()
+	sel.addLocked(id)
+}
+
+// addLocked adds a record whose timestamp is the RecentAddTimestamp, so the
+// records of a reused ID are different.
+func (sel *fakeSEL) addLocked(id uint16) {
+	sel.addTime++
+	record := append([]byte(nil), testSELRecords[0]...)
+	record[0], record[1] = uint8(id), uint8(id>>8)
+	binary.LittleEndian.PutUint32(record[3:], sel.addTime)
+	sel.records = append(sel.records, record)
+}
+
+// clear clears the SEL and adds the records of ids at once.
+func (sel *fakeSEL) clear(ids ...uint16) {
+	sel.mu.Lock()
+	defer sel.mu.Unlock()
+	sel.records = nil
+	sel.delTime++
+	sel.reservation++
+	for _, id := range ids {
+		sel.addLocked(id)
+	}
+}
+
+func (sel *fakeSEL) delete(id uint16) {
+	sel.mu.Lock()
+	defer sel.mu.Unlock()
+	for i, record := range sel.records {
+		if id == uint16(record[0])|uint16(record[1])<<8 {
+			sel.records = append(sel.records[:i:i], sel.records[i+1:]...)
+			break
+		}
+	}
+	sel.delTime++
+	sel.reservation++
+}
+
+func (sel *fakeSEL) handle(cmd commands.CommandCode, req []byte) (protocol.CompletionCode, []byte) {
+	sel.mu.Lock()
+	defer sel.mu.Unlock()
+	switch cmd {
+	case GetSELInfo:
+		return protocol.CommandCompleted, []byte{0x51, uint8(len(sel.records)), 0x00, 0x00, 0x00,
+			uint8(sel.addTime), 0x00, 0x00, 0x00, uint8(sel.delTime), 0x00, 0x00, 0x00, 0x00}
+	case ReserveSEL:
+		return protocol.CommandCompleted, []byte{uint8(sel.reservation), 0x00}
+	case GetSELEntry:
+		if uint16(req[0]) != sel.reservation {
+			return protocol.ErrInvalidResv, nil
+		}
+		id := uint16(req[2]) | uint16(req[3])<<8
+		for i, record := range sel.records {
+			if id == 0 && i == 0 || id == 0xffff && i == len(sel.records)-1 ||
+				id == uint16(record[0])|uint16(record[1])<<8 {
+				next := []byte{0xff, 0xff}
+				if i+1 < len(sel.records) {
+					next = sel.records[i+1][:2]
+				}
+				return protocol.CommandCompleted, append(append([]byte(nil), next...), record...)
+			}
+		}
+		return protocol.ErrNoObj, nil
+	default:
+		return protocol.ErrInvalidCommand, nil
+	}
+}
+
+func nextSELRecordIds(t *testing.T, results <-chan SELRecordResult, count int) []uint16 {
+	var ids []uint16
+	for i := 0; i < count; i++ {
+		select {
+		case result := <-results:
+			if result.Error != nil {
+				t.Fatal(result.Error)
+			}
+			ids = append(ids, result.Record.GetHeader().RecordId)
+		case <-time.After(time.Second):
+			t.Fatal("no record is followed")
+		}
+	}
+	select {
+	case result := <-results:
+		t.Fatal("unexcepted record", result)
+	case <-time.After(20 * time.Millisecond):
+	}
+	return ids
+}
+
+func TestFollowSEL(t *testing.T) {
+	selFollowInterval = time.Millisecond
+	defer func() { selFollowInterval = 10 * time.Second }()
+
+	sel := &fakeSEL{}
+	sel.add(1)
+	sel.add(2)
+	c := &Client{ClientHandler: &fakeHandler{handle: sel.handle}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	results := c.FollowSEL(ctx, SELFollowLatest)
+	nextSELRecordIds(t, results, 0)
+
+	sel.add(3)
+	sel.add(4)
+	assertEquals(t, "added", nextSELRecordIds(t, results, 2), []uint16{3, 4})
+
+	// the reservation is cancelled
+	sel.mu.Lock()
+	sel.reservation = 7
+	sel.mu.Unlock()
+	sel.add(5)
+	assertEquals(t, "added", nextSELRecordIds(t, results, 1), []uint16{5})
+
+	// only the last record is deleted
+	sel.delete(5)
+	nextSELRecordIds(t, results, 0)
+	sel.add(6)
+	assertEquals(t, "deleted", nextSELRecordIds(t, results, 1), []uint16{6})
+
+	// the SEL is cleared and the records are added up to the last ID at once
+	sel.clear(1, 2, 3, 4, 5, 6)
+	assertEquals(t, "replaced", nextSELRecordIds(t, results, 6), []uint16{1, 2, 3, 4, 5, 6})
+
+	// the SEL is cleared and the last ID isn't reused yet
+	sel.clear(1)
+	assertEquals(t, "cleared", nextSELRecordIds(t, results, 1), []uint16{1})
+
+	// the record IDs are reused after the SEL is cleared
+	sel.clear()
+	nextSELRecordIds(t, results, 0)
+	sel.add(1)
+	sel.add(2)
+	assertEquals(t, "cleared", nextSELRecordIds(t, results, 2), []uint16{1, 2})
+
+	cancel()
+	for range results {
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	results = c.FollowSEL(ctx, 0)
+	assertEquals(t, "all", nextSELRecordIds(t, results, 2), []uint16{1, 2})
+	cancel()
+	for range results {
+	}
+}
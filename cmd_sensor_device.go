@@ -3,6 +3,7 @@ package goipmi
 import (
 	"bytes"
 	"errors"
+	"strconv"
 	"strings"
 
 	"github.com/runner-mei/goipmi/protocol"
@@ -84,6 +85,28 @@ type GetSensorReadingFactorsResponse struct {
 	Bexp        int8
 }
 
+// ReadBytes decodes the factors as the bytes 25-30 of the full sensor
+// record.
+func (self *GetSensorReadingFactorsResponse) ReadBytes(r *protocol.Reader) {
+	self.NextReading = r.ReadUint8()
+	calcM := r.ReadUint8()
+	tolerance := r.ReadUint8()
+	calcB := r.ReadUint8()
+	accuracy := r.ReadUint8()
+	direction := r.ReadUint8()
+	rexpBexp := r.ReadUint8()
+
+	self.M = decode2sComplement((int16(tolerance&uint8(0xc0))<<2)|int16(calcM), 9)
+	self.Tolerance = uint8(tolerance) & 0x3f
+
+	self.B = decode2sComplement((int16(accuracy&uint8(0xc0))<<2)|int16(calcB), 9)
+	self.Accuracy = int16(uint8(accuracy)&0x3f) | int16(uint8(direction)&0xf0)<<2
+	self.AccuracyExp = (uint8(direction) & 0x0f) >> 2
+
+	self.Rexp = int8(decode2sComplement(int16(rexpBexp&uint8(0xf0))>>4, 3))
+	self.Bexp = int8(decode2sComplement(int16(rexpBexp&uint8(0x0f)), 3))
+}
+
 // section 35.6
 type GetSensorHysteresisRequest struct {
 	Number uint8
@@ -96,6 +119,54 @@ type GetSensorHysteresisResponse struct {
 	Negative_ThresholdHysteresisValue uint8
 }
 
+// SetSensorHysteresisRequest per section 35.6, the hysteresis values are in
+// the counts of the raw reading.
+type SetSensorHysteresisRequest struct {
+	Number                            uint8
+	Positive_ThresholdHysteresisValue uint8
+	Negative_ThresholdHysteresisValue uint8
+}
+
+func (self *SetSensorHysteresisRequest) WriteBytes(w *protocol.Writer) {
+	w.WriteUint8(self.Number)
+	w.WriteUint8(0xff) // reserved hysteresis mask
+	w.WriteUint8(self.Positive_ThresholdHysteresisValue)
+	w.WriteUint8(self.Negative_ThresholdHysteresisValue)
+}
+
+type SetSensorHysteresisResponse struct {
+	// CompletionCode
+}
+
+// Threshold masks of the Set Sensor Thresholds command, they are also the
+// readable and settable threshold masks of the full sensor record and the
+// threshold comparison status bits of the sensor reading.
+const (
+	ThresholdLowerNonCritical    = 0x01
+	ThresholdLowerCritical       = 0x02
+	ThresholdLowerNonRecoverable = 0x04
+	ThresholdUpperNonCritical    = 0x08
+	ThresholdUpperCritical       = 0x10
+	ThresholdUpperNonRecoverable = 0x20
+)
+
+// SetSensorThresholdsRequest per section 35.8, only the thresholds in Flags
+// are set.
+type SetSensorThresholdsRequest struct {
+	Number                       uint8
+	Flags                        uint8
+	LowerNonCriticalThreshold    uint8
+	LowerCriticalThreshold       uint8
+	LowerNonrecoverableThreshold uint8
+	UpperNonCriticalThreshold    uint8
+	UpperCriticalThreshold       uint8
+	UpperNonrecoverableThreshold uint8
+}
+
+type SetSensorThresholdsResponse struct {
+	// CompletionCode
+}
+
 // section 35.9
 type GetSensorThresholdsRequest struct {
 	Number uint8
@@ -104,12 +175,12 @@ type GetSensorThresholdsRequest struct {
 type GetSensorThresholdsResponse struct {
 	// CompletionCode
 	Flags                        uint8
-	UpperNonrecoverableThreshold uint8
-	UpperCriticalThreshold       uint8
-	UpperNonCriticalThreshold    uint8
-	LowerNonrecoverableThreshold uint8
-	LowerCriticalThreshold       uint8
 	LowerNonCriticalThreshold    uint8
+	LowerCriticalThreshold       uint8
+	LowerNonrecoverableThreshold uint8
+	UpperNonCriticalThreshold    uint8
+	UpperCriticalThreshold       uint8
+	UpperNonrecoverableThreshold uint8
 }
 
 func (self *GetSensorThresholdsResponse) HasUpperNonrecoverableThreshold() bool {
@@ -142,6 +213,63 @@ type GetSensorEventEnableResponse struct {
 	Values [5]byte
 }
 
+// Flags of the Set Sensor Event Enable command
+const (
+	SensorAllEventsEnabled      = 0x80
+	SensorScanningEnabled       = 0x40
+	SensorEnableSelectedEvents  = 0x10
+	SensorDisableSelectedEvents = 0x20
+)
+
+// SetSensorEventEnableRequest per section 35.10, the events of the bits of
+// AssertionEvents and DeassertionEvents are enabled or disabled by Flags,
+// they aren't changed if neither SensorEnableSelectedEvents nor
+// SensorDisableSelectedEvents is in Flags.
+type SetSensorEventEnableRequest struct {
+	Number            uint8
+	Flags             uint8
+	AssertionEvents   uint16
+	DeassertionEvents uint16
+}
+
+func (self *SetSensorEventEnableRequest) WriteBytes(w *protocol.Writer) {
+	w.WriteUint8(self.Number)
+	w.WriteUint8(self.Flags)
+	if self.Flags&(SensorEnableSelectedEvents|SensorDisableSelectedEvents) != 0 {
+		w.WriteUint16(self.AssertionEvents)
+		w.WriteUint16(self.DeassertionEvents)
+	}
+}
+
+type SetSensorEventEnableResponse struct {
+	// CompletionCode
+}
+
+// RearmSensorEventsRequest per section 35.12, all the events are re-armed
+// if All is true, otherwise only the events of the bits of AssertionEvents
+// and DeassertionEvents are re-armed.
+type RearmSensorEventsRequest struct {
+	Number            uint8
+	All               bool
+	AssertionEvents   uint16
+	DeassertionEvents uint16
+}
+
+func (self *RearmSensorEventsRequest) WriteBytes(w *protocol.Writer) {
+	w.WriteUint8(self.Number)
+	if self.All {
+		w.WriteUint8(0x00)
+		return
+	}
+	w.WriteUint8(0x80)
+	w.WriteUint16(self.AssertionEvents)
+	w.WriteUint16(self.DeassertionEvents)
+}
+
+type RearmSensorEventsResponse struct {
+	// CompletionCode
+}
+
 // section 35.14
 type GetSensorReadingRequest struct {
 	Number uint8
@@ -180,22 +308,7 @@ func (self *GetSensorReadingResponse) GetReadingUnavailable() bool {
 func (self *GetSensorReadingResponse) ToEventString(eventOrReadingTypeCode uint8) string {
 	var buf bytes.Buffer
 	if eventOrReadingTypeCode == 1 {
-		for _, v := range []struct {
-			t    ThresholdEventType
-			name string
-		}{{LOWER_NON_CRITICAL_GOING_LOW, "lower_non_critical_going_low"},
-			{LOWER_NON_CRITICAL_GOING_HIGH, "lower_non_critical_going_high"},
-			{LOWER_CRITICAL_GOING_LOW, "lower_critical_going_low"},
-			{LOWER_CRITICAL_GOING_HIGH, "lower_critical_going_high"},
-			{LOWER_NON_RECOVERABLE_GOING_LOW, "lower_non_recoverable_going_low"},
-			{LOWER_NON_RECOVERABLE_GOING_HIGH, "lower_non_recoverable_going_high"},
-			{UPPER_NON_CRITICAL_GOING_LOW, "upper_non_critical_going_low"},
-			{UPPER_NON_CRITICAL_GOING_HIGH, "upper_non_critical_going_high"},
-			{UPPER_CRITICAL_GOING_LOW, "upper_critical_going_low"},
-			{UPPER_CRITICAL_GOING_HIGH, "upper_critical_going_high"},
-			{UPPER_NON_RECOVERABLE_GOING_LOW, "upper_non_recoverable_going_low"},
-			{UPPER_NON_RECOVERABLE_GOING_HIGH, "upper_non_recoverable_going_high"},
-		} {
+		for _, v := range thresholdEvents {
 			if ok, err := self.GetAssertionThresholdEventOccurred(v.t); err != nil {
 				//panic(err)
 			} else if ok {
@@ -211,110 +324,162 @@ func (self *GetSensorReadingResponse) ToEventString(eventOrReadingTypeCode uint8
 		return buf.String()
 	}
 
-	var specs []ThresholdEventSpec
-	if eventOrReadingTypeCode == 2 {
-		specs = []ThresholdEventSpec{
-			{typ: 0, name: "transition to idle"},
-			{typ: 1, name: "transition to active"},
-			{typ: 2, name: "transition to busy"},
-		}
-	} else if eventOrReadingTypeCode == 3 {
-		specs = []ThresholdEventSpec{
-			{typ: 0, name: "state deasserted"},
-			{typ: 1, name: "state asserted"},
-		}
-	} else if eventOrReadingTypeCode == 4 {
-		specs = []ThresholdEventSpec{
-			{typ: 0, name: "predictive failure deasserted"},
-			{typ: 1, name: "predictive failure asserted"},
-		}
-	} else if eventOrReadingTypeCode == 5 {
-		specs = []ThresholdEventSpec{
-			{typ: 0, name: "limit not exceeded"},
-			{typ: 1, name: "limit exceeded"},
-		}
-	} else if eventOrReadingTypeCode == 6 {
-		specs = []ThresholdEventSpec{
-			{typ: 0, name: "performance met"},
-			{typ: 1, name: "performance lags"},
-		}
-	} else if eventOrReadingTypeCode == 7 {
-		specs = []ThresholdEventSpec{
-			{typ: 0, name: "transition to OK"},
-			{typ: 1, name: "transition to Non-critical from OK"},
-			{typ: 2, name: "transition to Critical from less servere"},
-			{typ: 3, name: "transition to Non-recoverable from less servere"},
-			{typ: 4, name: "transition to Non-critical from more servere"},
-			{typ: 5, name: "transition to Critical from Non-recoverable"},
-			{typ: 6, name: "transition to Non-recoverable"},
-			{typ: 7, name: "monitor"},
-			{typ: 8, name: "informational"},
-		}
-	} else if eventOrReadingTypeCode == 8 {
-		specs = []ThresholdEventSpec{
-			{typ: 0, name: "device removed"},
-			{typ: 0, name: "device inserted"},
-		}
-	} else if eventOrReadingTypeCode == 9 {
-		specs = []ThresholdEventSpec{
-			{typ: 0, name: "device disabled"},
-			{typ: 0, name: "device enabled"},
-		}
-	} else if eventOrReadingTypeCode == 10 {
-		specs = []ThresholdEventSpec{
-			{typ: 0, name: "transition to Running"},
-			{typ: 1, name: "transition to In Test"},
-			{typ: 2, name: "transition to Power Off"},
-			{typ: 3, name: "transition to On line"},
-			{typ: 4, name: "transition to Off line"},
-			{typ: 5, name: "transition to Off Duty"},
-			{typ: 6, name: "transition to Degraded"},
-			{typ: 7, name: "transition to Power Save"},
-			{typ: 8, name: "install error"},
-		}
-	} else if eventOrReadingTypeCode == 11 {
-		specs = []ThresholdEventSpec{
-			{typ: 0, name: "full redundancy"},
-			{typ: 1, name: "redundancy lost"},
-			{typ: 2, name: "redundancy degraded"},
-			{typ: 3, name: "non-redundant(sufficient resources from redundant)"},
-			{typ: 4, name: "non-redundant(sufficient resources from insufficient resources)"},
-			{typ: 5, name: "non-redundant(insufficient resources)"},
-			{typ: 6, name: "redundancy Degraded from fully redundant"},
-			{typ: 7, name: "redundancy Degraded from non-redundant"},
-		}
-	} else if eventOrReadingTypeCode == 12 {
-		specs = []ThresholdEventSpec{
-			{typ: 0, name: "D0 power state"},
-			{typ: 1, name: "D1 power state"},
-			{typ: 2, name: "D2 power state"},
-			{typ: 3, name: "D3 power state"},
-		}
-	}
-
-	for _, v := range specs {
+	for _, v := range genericEvents[eventOrReadingTypeCode] {
 		if ok, err := self.GetAssertionDiscreteEventOccurred(v.typ); err != nil {
 			panic(err)
 		} else if ok {
-			if strings.HasSuffix(v.name, ")") {
-				buf.WriteString(strings.TrimSuffix(v.name, ")") + " -- assertion),")
-			} else {
-				buf.WriteString(v.name + "(assertion),")
-			}
+			buf.WriteString(discreteEventString(v.name, true) + ",")
 		}
 		if ok, err := self.GetDeassertionDiscreteEventOccurred(v.typ); err != nil {
 			panic(err)
 		} else if ok {
-			if strings.HasSuffix(v.name, ")") {
-				buf.WriteString(strings.TrimSuffix(v.name, ")") + " -- deassertion),")
-			} else {
-				buf.WriteString(v.name + "(deassertion),")
-			}
+			buf.WriteString(discreteEventString(v.name, false) + ",")
 		}
 	}
 	return buf.String()
 }
 
+// DiscreteStates returns the asserted states of the discrete sensor, a
+// state that isn't in table 42-2 or 42-3 is named "state N".
+func (self *GetSensorReadingResponse) DiscreteStates(eventOrReadingTypeCode, sensorType uint8) []string {
+	var states []string
+	for offset := uint8(0); offset < 15; offset++ {
+		if ok, err := self.GetAssertionDiscreteEventOccurred(DiscreteEventType(offset)); err != nil || !ok {
+			continue
+		}
+		name := discreteStateName(eventOrReadingTypeCode, sensorType, offset)
+		if name == "" {
+			name = "state " + strconv.Itoa(int(offset))
+		}
+		states = append(states, name)
+	}
+	return states
+}
+
+// discreteStateName returns the name of the state at offset per table 42-2
+// for the generic and OEM states and per table 42-3 for the sensor-specific
+// states, it returns "" if the state is unknown.
+func discreteStateName(eventOrReadingTypeCode, sensorType, offset uint8) string {
+	switch {
+	case eventOrReadingTypeCode == 0x6f:
+		if events := sensorSpecificEvents[sensorType]; int(offset) < len(events) {
+			return events[offset]
+		}
+	case eventOrReadingTypeCode >= 0x70 && eventOrReadingTypeCode <= 0x7f:
+		return "OEM event " + strconv.Itoa(int(offset))
+	default:
+		for _, v := range genericEvents[eventOrReadingTypeCode] {
+			if v.typ == DiscreteEventType(offset) {
+				return v.name
+			}
+		}
+	}
+	return ""
+}
+
+// discreteEventString appends the direction to the name of the discrete
+// event.
+func discreteEventString(name string, assertion bool) string {
+	direction := "deassertion"
+	if assertion {
+		direction = "assertion"
+	}
+	if strings.HasSuffix(name, ")") {
+		return strings.TrimSuffix(name, ")") + " -- " + direction + ")"
+	}
+	return name + "(" + direction + ")"
+}
+
+// thresholdEvents per table 42-2, they are in the order of the event offsets.
+var thresholdEvents = []struct {
+	t    ThresholdEventType
+	name string
+}{{LOWER_NON_CRITICAL_GOING_LOW, "lower_non_critical_going_low"},
+	{LOWER_NON_CRITICAL_GOING_HIGH, "lower_non_critical_going_high"},
+	{LOWER_CRITICAL_GOING_LOW, "lower_critical_going_low"},
+	{LOWER_CRITICAL_GOING_HIGH, "lower_critical_going_high"},
+	{LOWER_NON_RECOVERABLE_GOING_LOW, "lower_non_recoverable_going_low"},
+	{LOWER_NON_RECOVERABLE_GOING_HIGH, "lower_non_recoverable_going_high"},
+	{UPPER_NON_CRITICAL_GOING_LOW, "upper_non_critical_going_low"},
+	{UPPER_NON_CRITICAL_GOING_HIGH, "upper_non_critical_going_high"},
+	{UPPER_CRITICAL_GOING_LOW, "upper_critical_going_low"},
+	{UPPER_CRITICAL_GOING_HIGH, "upper_critical_going_high"},
+	{UPPER_NON_RECOVERABLE_GOING_LOW, "upper_non_recoverable_going_low"},
+	{UPPER_NON_RECOVERABLE_GOING_HIGH, "upper_non_recoverable_going_high"},
+}
+
+// genericEvents per table 42-2, they are keyed by the event/reading type
+// code.
+var genericEvents = map[uint8][]ThresholdEventSpec{
+	2: {
+		{typ: 0, name: "transition to idle"},
+		{typ: 1, name: "transition to active"},
+		{typ: 2, name: "transition to busy"},
+	},
+	3: {
+		{typ: 0, name: "state deasserted"},
+		{typ: 1, name: "state asserted"},
+	},
+	4: {
+		{typ: 0, name: "predictive failure deasserted"},
+		{typ: 1, name: "predictive failure asserted"},
+	},
+	5: {
+		{typ: 0, name: "limit not exceeded"},
+		{typ: 1, name: "limit exceeded"},
+	},
+	6: {
+		{typ: 0, name: "performance met"},
+		{typ: 1, name: "performance lags"},
+	},
+	7: {
+		{typ: 0, name: "transition to OK"},
+		{typ: 1, name: "transition to Non-critical from OK"},
+		{typ: 2, name: "transition to Critical from less servere"},
+		{typ: 3, name: "transition to Non-recoverable from less servere"},
+		{typ: 4, name: "transition to Non-critical from more servere"},
+		{typ: 5, name: "transition to Critical from Non-recoverable"},
+		{typ: 6, name: "transition to Non-recoverable"},
+		{typ: 7, name: "monitor"},
+		{typ: 8, name: "informational"},
+	},
+	8: {
+		{typ: 0, name: "device removed"},
+		{typ: 1, name: "device inserted"},
+	},
+	9: {
+		{typ: 0, name: "device disabled"},
+		{typ: 1, name: "device enabled"},
+	},
+	10: {
+		{typ: 0, name: "transition to Running"},
+		{typ: 1, name: "transition to In Test"},
+		{typ: 2, name: "transition to Power Off"},
+		{typ: 3, name: "transition to On line"},
+		{typ: 4, name: "transition to Off line"},
+		{typ: 5, name: "transition to Off Duty"},
+		{typ: 6, name: "transition to Degraded"},
+		{typ: 7, name: "transition to Power Save"},
+		{typ: 8, name: "install error"},
+	},
+	11: {
+		{typ: 0, name: "full redundancy"},
+		{typ: 1, name: "redundancy lost"},
+		{typ: 2, name: "redundancy degraded"},
+		{typ: 3, name: "non-redundant(sufficient resources from redundant)"},
+		{typ: 4, name: "non-redundant(sufficient resources from insufficient resources)"},
+		{typ: 5, name: "non-redundant(insufficient resources)"},
+		{typ: 6, name: "redundancy Degraded from fully redundant"},
+		{typ: 7, name: "redundancy Degraded from non-redundant"},
+	},
+	12: {
+		{typ: 0, name: "D0 power state"},
+		{typ: 1, name: "D1 power state"},
+		{typ: 2, name: "D2 power state"},
+		{typ: 3, name: "D3 power state"},
+	},
+}
+
 type ThresholdEventSpec struct {
 	typ  DiscreteEventType
 	name string
@@ -3,6 +3,7 @@ package goipmi
 import (
 	"errors"
 	"math"
+	"strconv"
 
 	"github.com/runner-mei/goipmi/protocol"
 	"golang.org/x/text/encoding/charmap"
@@ -90,6 +91,21 @@ func (self *FullSensorRecord) GetHeader() SensorRecordHeader {
 	return self.SensorRecordHeader
 }
 
+// Owner returns the controller that owns the sensor.
+func (self *FullSensorRecord) Owner() Target {
+	return sensorOwner(self.SensorOwnerId, self.SensorOwnerLUN)
+}
+
+// sensorOwner returns the controller of the sensor owner ID and LUN per
+// section 43.1, a owner ID is a IPMB slave address if bit 0 is 0 and a system
+// software ID otherwise, whose sensors are read from the BMC.
+func sensorOwner(ownerID, ownerLUN uint8) Target {
+	if ownerID&0x01 != 0 {
+		return Target{LUN: ownerLUN & 0x03}
+	}
+	return Target{Address: ownerID, Channel: ownerLUN >> 4, LUN: ownerLUN & 0x03}
+}
+
 func (self *FullSensorRecord) CanIgnore() bool {
 	// fmt.Printf("%x %x %x %x %x %x %x %x %x %x %x \r\n",
 	// 	self.RecordId,
@@ -180,8 +196,100 @@ func (self *FullSensorRecord) ReadBytes(r *protocol.Reader) {
 	self.IdString = decodeName(self.IdTypeLength, r.ReadBytes(r.Len()))
 }
 
+// ErrNonLinearSensor is returned by Calc for the non-linear sensors, their
+// readings are converted by CalcWithFactors with the factors of Get Sensor
+// Reading Factors, or by Client.CalcSensorReading.
+var ErrNonLinearSensor = errors.New("the sensor is non-linear, the reading factors are required.")
+
 func (self *FullSensorRecord) Calc(value, length int32) (float64, error) {
-	return calcFormula(value, length, self.SensorUnits1, self.M, self.B, int16(self.Rexp), self.Linearization)
+	if self.IsNonLinear() {
+		return 0, ErrNonLinearSensor
+	}
+	return calcFormula(value, length, self.SensorUnits1, self.M, self.B, int16(self.Bexp), int16(self.Rexp), self.Linearization)
+}
+
+// IsNonLinear returns true if the conversion factors of the sensor vary with
+// the reading, they are read by the Get Sensor Reading Factors command.
+func (self *FullSensorRecord) IsNonLinear() bool {
+	return self.Linearization >= 0x70 && self.Linearization <= 0x7f
+}
+
+// CalcWithFactors converts the reading with the factors that are read for
+// the reading by the Get Sensor Reading Factors command.
+func (self *FullSensorRecord) CalcWithFactors(value, length int32, factors *GetSensorReadingFactorsResponse) (float64, error) {
+	return calcFormula(value, length, self.SensorUnits1, factors.M, factors.B, int16(factors.Bexp), int16(factors.Rexp), 0)
+}
+
+// ErrorBand returns the range of the converted reading per the tolerance and
+// the accuracy, the tolerance is in +/- 1/2 raw counts and the accuracy is in
+// 0.01 percent of the reading. The factors of the record are used if
+// factors is nil, they are required for a non-linear sensor.
+func (self *FullSensorRecord) ErrorBand(value, length int32, factors *GetSensorReadingFactorsResponse) (lower, upper float64, err error) {
+	if factors == nil && self.IsNonLinear() {
+		return 0, 0, ErrNonLinearSensor
+	}
+	if factors == nil {
+		factors = &GetSensorReadingFactorsResponse{M: self.M, Tolerance: self.Tolerance, B: self.B,
+			Accuracy: self.Accuracy, AccuracyExp: self.AccuracyExp, Rexp: self.Rexp, Bexp: self.Bexp}
+	}
+	linearization := self.Linearization
+	if self.IsNonLinear() {
+		linearization = 0
+	}
+
+	reading, err := calcFormula(value, length, self.SensorUnits1, factors.M, factors.B, int16(factors.Bexp), int16(factors.Rexp), linearization)
+	if err != nil {
+		return 0, 0, err
+	}
+	// the decoded raw reading is reading without the factors
+	x, err := calcFormula(value, length, self.SensorUnits1, 1, 0, 0, 0, 0)
+	if err != nil {
+		return 0, 0, err
+	}
+	tolerance := float64(factors.Tolerance) / 2
+	if lower, err = applyFormula(x-tolerance, factors.M, factors.B, int16(factors.Bexp), int16(factors.Rexp), linearization); err != nil {
+		return 0, 0, err
+	}
+	if upper, err = applyFormula(x+tolerance, factors.M, factors.B, int16(factors.Bexp), int16(factors.Rexp), linearization); err != nil {
+		return 0, 0, err
+	}
+	if lower > upper {
+		lower, upper = upper, lower
+	}
+
+	accuracy := math.Abs(reading) * float64(factors.Accuracy) * math.Pow(10, float64(factors.AccuracyExp)) / 10000
+	return lower - accuracy, upper + accuracy, nil
+}
+
+// RawValue converts the value in the engineering units to the raw value, it is
+// the inverse of Calc and the result is rounded to the nearest raw value.
+func (self *FullSensorRecord) RawValue(value float64) (uint8, error) {
+	return calcRawValue(value, self.SensorUnits1, self.M, self.B, int16(self.Bexp), int16(self.Rexp), self.Linearization)
+}
+
+// RawHysteresis converts the hysteresis in the engineering units to the raw
+// value, the hysteresis is in the counts of the raw reading, so B and the
+// linearization aren't applied.
+func (self *FullSensorRecord) RawHysteresis(value float64) (uint8, error) {
+	if self.M == 0 {
+		return 0, errors.New("M is 0.")
+	}
+	raw := math.Round(value / math.Abs(float64(self.M)*math.Pow(10, float64(self.Rexp))))
+	if raw < 0 || raw > 255 || math.IsNaN(raw) {
+		return 0, errors.New("hysteresis " + strconv.FormatFloat(value, 'f', -1, 64) + " is out of range.")
+	}
+	return uint8(raw), nil
+}
+
+// Units returns the unit of the readings.
+func (self *FullSensorRecord) Units() SensorUnits {
+	return decodeSensorUnits(self.SensorUnits1, self.SensorUnits2, self.SensorUnits3)
+}
+
+// FormatReading formats the reading that is converted by Calc with the unit,
+// such as "42 degrees C".
+func (self *FullSensorRecord) FormatReading(value float64) string {
+	return self.Units().FormatReading(value)
 }
 
 type CompactSensorRecord struct {
@@ -223,6 +331,11 @@ type CompactSensorRecord struct {
 	IdString                          string
 }
 
+// Owner returns the controller that owns the sensor.
+func (self *CompactSensorRecord) Owner() Target {
+	return sensorOwner(self.SensorOwnerId, self.SensorOwnerLUN)
+}
+
 func (self *CompactSensorRecord) GetHeader() SensorRecordHeader {
 	return self.SensorRecordHeader
 }
@@ -280,6 +393,91 @@ func (self *CompactSensorRecord) ReadBytes(r *protocol.Reader) {
 	self.IdString = decodeName(self.IdTypeLength, r.ReadBytes(r.Len()))
 }
 
+// Units returns the unit of the readings.
+func (self *CompactSensorRecord) Units() SensorUnits {
+	return decodeSensorUnits(self.SensorUnits1, self.SensorUnits2, self.SensorUnits3)
+}
+
+// FormatReading formats the reading with the unit.
+func (self *CompactSensorRecord) FormatReading(value float64) string {
+	return self.Units().FormatReading(value)
+}
+
+// Modifier unit types of the sensor units 1
+const (
+	SensorModifierNone     = 0
+	SensorModifierDivide   = 1 // Basic Unit / Modifier Unit
+	SensorModifierMultiply = 2 // Basic Unit * Modifier Unit
+)
+
+// Rate units of the sensor units 1
+const (
+	SensorRateNone        = 0
+	SensorRateMicrosecond = 1
+	SensorRateMillisecond = 2
+	SensorRateSecond      = 3
+	SensorRateMinute      = 4
+	SensorRateHour        = 5
+	SensorRateDay         = 6
+)
+
+var sensorRateNames = []string{"", "us", "ms", "s", "minute", "hour", "day"}
+
+// SensorUnits is the unit of the readings per section 43.1, it is decoded
+// from the sensor units 1, 2 and 3 of the full and compact sensor records.
+type SensorUnits struct {
+	Base         SensorUnit
+	Modifier     SensorUnit
+	ModifierType uint8
+	Rate         uint8
+	Percentage   bool
+}
+
+func decodeSensorUnits(units1, units2, units3 uint8) SensorUnits {
+	return SensorUnits{
+		Base:         SensorUnit(units2),
+		Modifier:     SensorUnit(units3),
+		ModifierType: (units1 >> 1) & 0x03,
+		Rate:         (units1 >> 3) & 0x07,
+		Percentage:   units1&0x01 != 0,
+	}
+}
+
+// String returns the unit as ipmitool, such as "degrees C", "Watts * hour"
+// or "% RPM", the rate unit is appended as "/s".
+func (self SensorUnits) String() string {
+	var s string
+	switch self.ModifierType {
+	case SensorModifierDivide:
+		s = self.Base.String() + "/" + self.Modifier.String()
+	case SensorModifierMultiply:
+		s = self.Base.String() + " * " + self.Modifier.String()
+	default:
+		if self.Base == SENSOR_UNIT_UNSPECIFIED && self.Percentage {
+			return "percent"
+		}
+		s = self.Base.String()
+	}
+	if self.Percentage {
+		s = "% " + s
+	}
+	if self.Rate != SensorRateNone && int(self.Rate) < len(sensorRateNames) {
+		s += "/" + sensorRateNames[self.Rate]
+	}
+	return s
+}
+
+// FormatReading formats the reading with the unit, the reading is rounded to
+// 3 decimal places, the unit is omitted if it is unspecified.
+func (self SensorUnits) FormatReading(value float64) string {
+	s := strconv.FormatFloat(math.Round(value*1000)/1000, 'f', -1, 64)
+	if self.Base == SENSOR_UNIT_UNSPECIFIED && !self.Percentage &&
+		self.ModifierType == SensorModifierNone {
+		return s
+	}
+	return s + " " + self.String()
+}
+
 type EventOnlyRecord struct {
 	// Header
 	SensorRecordHeader
@@ -308,6 +506,11 @@ type EventOnlyRecord struct {
 	IdString     string
 }
 
+// Owner returns the controller that owns the sensor.
+func (self *EventOnlyRecord) Owner() Target {
+	return sensorOwner(self.SensorOwnerId, self.SensorOwnerLUN)
+}
+
 func (self *EventOnlyRecord) GetHeader() SensorRecordHeader {
 	return self.SensorRecordHeader
 }
@@ -348,6 +551,73 @@ func (self *EventOnlyRecord) ReadBytes(r *protocol.Reader) {
 	self.IdString = decodeName(self.IdTypeLength, r.ReadBytes(r.Len()))
 }
 
+// SensorInstance is a sensor of a record, a compact or event-only record is
+// shared by the sensors of the sequential numbers per section 43.2, they
+// are named by the ID string and the instance modifier.
+type SensorInstance struct {
+	Record         Record
+	Owner          Target
+	Number         uint8
+	EntityInstance uint8
+	Name           string
+}
+
+// SensorInstances returns the sensors of the full, compact and event-only
+// records, the other records are skipped.
+func SensorInstances(records []Record) []SensorInstance {
+	instances := make([]SensorInstance, 0, len(records))
+	for _, record := range records {
+		switch rec := record.(type) {
+		case *FullSensorRecord:
+			instances = append(instances, SensorInstance{Record: record, Owner: rec.Owner(),
+				Number: rec.SensorNumber, EntityInstance: rec.EntityInstance & 0x7f, Name: rec.IdString})
+		case *CompactSensorRecord:
+			instances = appendSharedInstances(instances, SensorInstance{Record: record, Owner: rec.Owner(),
+				Number: rec.SensorNumber, EntityInstance: rec.EntityInstance & 0x7f, Name: rec.IdString},
+				rec.SensorRecordSharing, rec.IdStringInstanceModifierType,
+				rec.IdStringInstanceModifierOffset, rec.EntityInstanceSharing)
+		case *EventOnlyRecord:
+			instances = appendSharedInstances(instances, SensorInstance{Record: record, Owner: rec.Owner(),
+				Number: rec.SensorNumber, EntityInstance: rec.EntityInstance & 0x7f, Name: rec.IdString},
+				rec.SensorRecordSharing, rec.IdStringInstanceModifierType,
+				rec.IdStringInstanceModifierOffset, rec.EntityInstanceSharing)
+		}
+	}
+	return instances
+}
+
+// appendSharedInstances appends the count sensors of the shared record, the
+// instance modifier is numeric or alpha, the entity instance is incremented
+// unless it is same for all the sensors.
+func appendSharedInstances(instances []SensorInstance, first SensorInstance,
+	count, modifierType, modifierOffset uint8, sameEntityInstance bool) []SensorInstance {
+	if count <= 1 {
+		return append(instances, first)
+	}
+	for i := uint8(0); i < count; i++ {
+		instance := first
+		instance.Number = first.Number + i
+		if !sameEntityInstance {
+			instance.EntityInstance = (first.EntityInstance + i) & 0x7f
+		}
+		instance.Name = first.Name + instanceModifier(modifierType, int(modifierOffset)+int(i))
+		instances = append(instances, instance)
+	}
+	return instances
+}
+
+// instanceModifier returns the modifier that is appended to the ID string,
+// the alpha modifier is "A" to "Z" and then "AA" to "ZZ" as ipmitool.
+func instanceModifier(modifierType uint8, value int) string {
+	if modifierType != 1 {
+		return strconv.Itoa(value)
+	}
+	if value < 26 {
+		return string(rune('A' + value))
+	}
+	return string([]rune{rune('A' + value/26 - 1), rune('A' + value%26)})
+}
+
 type ListOrRangeType uint8
 
 const (
@@ -803,7 +1073,7 @@ func (self *OEMRecord) ReadBytes(r *protocol.Reader) {
 	self.OEMData = r.ReadCopy(r.Len())    // 16
 }
 
-func calcFormula(value, length int32, sensorUnits1 uint8, M, B, Rexp int16, linearization uint8) (float64, error) {
+func calcFormula(value, length int32, sensorUnits1 uint8, M, B, Bexp, Rexp int16, linearization uint8) (float64, error) {
 	dataFormat := int32((uint8(sensorUnits1) & 0xc0) >> 6)
 	base := int32(0)
 
@@ -828,7 +1098,13 @@ func calcFormula(value, length int32, sensorUnits1 uint8, M, B, Rexp int16, line
 		return 0, errors.New("Invalid data format in sensorUnits1")
 	}
 
-	result := (float64(M)*float64(base) + float64(B)) * math.Pow(10, float64(Rexp))
+	return applyFormula(float64(base), M, B, Bexp, Rexp, linearization)
+}
+
+// applyFormula converts the decoded raw reading x per section 36.3, x may be
+// fractional for the error band.
+func applyFormula(x float64, M, B, Bexp, Rexp int16, linearization uint8) (float64, error) {
+	result := (float64(M)*x + float64(B)*math.Pow(10, float64(Bexp))) * math.Pow(10, float64(Rexp))
 
 	switch linearization {
 	case 0:
@@ -839,6 +1115,8 @@ func calcFormula(value, length int32, sensorUnits1 uint8, M, B, Rexp int16, line
 		return math.Log10(result), nil
 	case 3:
 		return math.Log(result) / math.Log(2), nil
+	case 4:
+		return math.Exp(result), nil
 	case 5:
 		return math.Pow(10, result), nil
 	case 6:
@@ -852,10 +1130,72 @@ func calcFormula(value, length int32, sensorUnits1 uint8, M, B, Rexp int16, line
 	case 10:
 		return math.Pow(result, 0.5), nil
 	case 11:
-		return math.Pow(result, 0.33), nil
+		return math.Cbrt(result), nil
+	default:
+		return 0, errors.New("Unsupported linearization type")
+	}
+}
+
+// calcRawValue is the inverse of calcFormula, it returns an error if the
+// value is out of the range of the raw values.
+func calcRawValue(value float64, sensorUnits1 uint8, M, B, Bexp, Rexp int16, linearization uint8) (uint8, error) {
+	switch linearization {
+	case 0:
+	case 1:
+		value = math.Exp(value)
+	case 2:
+		value = math.Pow(10, value)
+	case 3:
+		value = math.Pow(2, value)
+	case 4:
+		value = math.Log(value)
+	case 5:
+		value = math.Log10(value)
+	case 6:
+		value = math.Log2(value)
+	case 7:
+		value = 1 / value
+	case 8:
+		value = math.Sqrt(value)
+	case 9:
+		value = math.Cbrt(value)
+	case 10:
+		value = value * value
+	case 11:
+		value = value * value * value
 	default:
 		return 0, errors.New("Unsupported linearization type")
 	}
+	if M == 0 {
+		return 0, errors.New("M is 0.")
+	}
+
+	raw := math.Round((value/math.Pow(10, float64(Rexp)) - float64(B)*math.Pow(10, float64(Bexp))) / float64(M))
+	if math.IsNaN(raw) {
+		return 0, errors.New("value is out of range.")
+	}
+	switch (sensorUnits1 & 0xc0) >> 6 {
+	case 0: // unsigned
+		if raw < 0 || raw > 255 {
+			return 0, errors.New("value is out of range.")
+		}
+		return uint8(raw), nil
+	case 1: // 1's complement
+		if raw < -127 || raw > 127 {
+			return 0, errors.New("value is out of range.")
+		}
+		if raw < 0 {
+			return ^uint8(-raw), nil
+		}
+		return uint8(raw), nil
+	case 2: // 2's complement
+		if raw < -128 || raw > 127 {
+			return 0, errors.New("value is out of range.")
+		}
+		return uint8(int8(raw)), nil
+	default: // no analog reading
+		return 0, errors.New("the sensor has no analog reading.")
+	}
 }
 
 // func littleEndianBcdByteToInt32(value byte) int32 {
@@ -924,7 +1264,7 @@ func decodeName(codingTypeAndLen uint8, name []byte) string {
 		if nil != err {
 			return string(name[:length])
 		}
-		return string(bs[:length])
+		return string(bs)
 	default:
 		panic("Invalid coding type.")
 	}
@@ -1,6 +1,7 @@
 package goipmi
 
 import (
+	"math"
 	"testing"
 
 	"github.com/runner-mei/goipmi/protocol"
@@ -80,3 +81,152 @@ func TestFullRecord(t *testing.T) {
 		t.Error(v)
 	}
 }
+
+func TestSensorOwner(t *testing.T) {
+	for _, test := range []struct {
+		ownerID, ownerLUN uint8
+		excepted          Target
+	}{
+		{ownerID: 0x20, ownerLUN: 0x00, excepted: Target{Address: 0x20}},
+		{ownerID: 0x2c, ownerLUN: 0x71, excepted: Target{Address: 0x2c, Channel: 7, LUN: 1}},
+		{ownerID: 0x41, ownerLUN: 0x02, excepted: Target{LUN: 2}},
+		{ownerID: 0x20, ownerLUN: 0x70, excepted: Target{Address: 0x20, Channel: 7}},
+	} {
+		owner := sensorOwner(test.ownerID, test.ownerLUN)
+		if owner != test.excepted {
+			t.Error("excepted is", test.excepted, ", actual is", owner)
+		}
+		if (test.ownerID == 0x20 && test.ownerLUN>>4 == 0 || test.ownerID&0x01 != 0) != owner.IsBMC() {
+			t.Error("IsBMC of", owner, "is", owner.IsBMC())
+		}
+	}
+}
+
+func TestSensorUnits(t *testing.T) {
+	for _, test := range []struct {
+		units1, units2, units3 uint8
+		value                  float64
+		excepted               string
+	}{
+		{units1: 0x80, units2: SENSOR_UNIT_DEGREESC, value: 42, excepted: "42 degrees C"},
+		{units1: 0x00, units2: SENSOR_UNIT_VOLTS, value: 12.0560001, excepted: "12.056 Volts"},
+		{units1: 0x04, units2: SENSOR_UNIT_WATTS, units3: SENSOR_UNIT_HOUR, value: 3, excepted: "3 Watts * hour"},
+		{units1: 0x02, units2: SENSOR_UNIT_FEET, units3: SENSOR_UNIT_MINUTE, value: 1, excepted: "1 feet/minute"},
+		{units1: 0x01, units2: SENSOR_UNIT_UNSPECIFIED, value: 50, excepted: "50 percent"},
+		{units1: 0x01, units2: SENSOR_UNIT_RPM, value: 80, excepted: "80 % RPM"},
+		{units1: 0x18, units2: SENSOR_UNIT_PACKETS, value: 7, excepted: "7 packets/s"},
+		{units1: 0x00, units2: SENSOR_UNIT_UNSPECIFIED, value: -1.5, excepted: "-1.5"},
+	} {
+		full := FullSensorRecord{SensorUnits1: test.units1, SensorUnits2: test.units2, SensorUnits3: test.units3}
+		assertEquals(t, "full", full.FormatReading(test.value), test.excepted)
+		compact := CompactSensorRecord{SensorUnits1: test.units1, SensorUnits2: test.units2, SensorUnits3: test.units3}
+		assertEquals(t, "compact", compact.FormatReading(test.value), test.excepted)
+	}
+
+	full := FullSensorRecord{SensorUnits1: 0x84, SensorUnits2: SENSOR_UNIT_WATTS, SensorUnits3: SENSOR_UNIT_HOUR}
+	assertEquals(t, "units", full.Units(), SensorUnits{Base: SENSOR_UNIT_WATTS, Modifier: SENSOR_UNIT_HOUR,
+		ModifierType: SensorModifierMultiply})
+	assertEquals(t, "unknown", SensorUnit(200).String(), "unknown")
+}
+
+func TestRawValue(t *testing.T) {
+	fan := FullSensorRecord{SensorUnits1: 0x00, M: 75}
+	for _, test := range []struct {
+		value    float64
+		excepted uint8
+	}{{1500, 20}, {1540, 21}, {0, 0}, {19125, 255}} {
+		raw, e := fan.RawValue(test.value)
+		if e != nil {
+			t.Error(e)
+		}
+		assertEquals(t, "raw", raw, test.excepted)
+	}
+	if _, e := fan.RawValue(20000); e == nil {
+		t.Error("excepted is out of range error")
+	}
+
+	// (x + 5 * 10) * 0.1
+	temp := FullSensorRecord{SensorUnits1: 0x80, M: 1, B: 5, Bexp: 1, Rexp: -1}
+	for _, raw := range []uint8{0x00, 0x0a, 0x7f, 0x80, 0xf6} {
+		value, e := temp.Calc(int32(raw), 8)
+		if e != nil {
+			t.Fatal(e)
+		}
+		actual, e := temp.RawValue(value)
+		if e != nil {
+			t.Fatal(e)
+		}
+		assertEquals(t, "raw", actual, raw)
+	}
+	value, _ := temp.Calc(0x0a, 8)
+	assertEquals(t, "value", value, 6.0)
+	if _, e := temp.RawValue(-10); e == nil {
+		t.Error("excepted is out of range error")
+	}
+
+	hysteresis, e := fan.RawHysteresis(150)
+	if e != nil {
+		t.Fatal(e)
+	}
+	assertEquals(t, "hysteresis", hysteresis, uint8(2))
+}
+
+func TestCalcBexp(t *testing.T) {
+	// y = (M * x + B * 10^Bexp) * 10^Rexp per section 36.3, the readings
+	// were converted without 10^Bexp before
+	for _, test := range []struct {
+		M, B       int16
+		Bexp, Rexp int8
+		raw        int32
+		excepted   float64
+	}{
+		{M: 1, B: 3, Bexp: 1, Rexp: -1, raw: 24, excepted: 5.4},
+		{M: 1, B: 3, Bexp: -1, Rexp: 0, raw: 24, excepted: 24.3},
+		{M: 2, B: -5, Bexp: 2, Rexp: 0, raw: 255, excepted: 10},
+		{M: 1, B: 3, Bexp: 0, Rexp: 0, raw: 24, excepted: 27},
+	} {
+		full := FullSensorRecord{M: test.M, B: test.B, Bexp: test.Bexp, Rexp: test.Rexp}
+		value, e := full.Calc(test.raw, 8)
+		if e != nil {
+			t.Fatal(e)
+		}
+		if math.Abs(value-test.excepted) > 1e-9 {
+			t.Error("excepted is", test.excepted, ", actual is", value)
+		}
+	}
+
+	// the exponents are the nibbles of the byte 30 of the record
+	var full FullSensorRecord
+	r := protocol.NewReader([]byte{0x0f, 0x00, 0x51, 0x01, 0x3b, 0x20, 0x00, 0x0d, 0x27, 0x01, 0x23, 0xc9, 0x01, 0x01, 0x00, 0x0a, 0x00, 0x60, 0x30, 0x00, 0x00, 0x01, 0x00, 0x00, 0x01, 0x00, 0x03, 0x00, 0x00, 0xf1, 0x00, 0x00, 0x00, 0x00, 0x7f, 0x81, 0x2d, 0x29, 0x27, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xc6, 0x54, 0x65, 0x6d, 0x70, 0x20, 0x31})
+	full.ReadBytes(r)
+	if r.Err() != nil {
+		t.Fatal(r.Err())
+	}
+	assertEquals(t, "exponents", []int8{full.Bexp, full.Rexp}, []int8{1, -1})
+	value, e := full.Calc(24, 8)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if math.Abs(value-5.4) > 1e-9 {
+		t.Error("excepted is 5.4, actual is", value)
+	}
+}
+
+func TestErrorBand(t *testing.T) {
+	var factors GetSensorReadingFactorsResponse
+	r := protocol.NewReader([]byte{0x05, 0x02, 0x44, 0x0a, 0xb2, 0x14, 0xf0})
+	factors.ReadBytes(r)
+	if r.Err() != nil {
+		t.Fatal(r.Err())
+	}
+	assertEquals(t, "factors", factors, GetSensorReadingFactorsResponse{NextReading: 5,
+		M: 0x102, Tolerance: 4, B: -502, Accuracy: 0x72, AccuracyExp: 1, Rexp: -1})
+
+	// 24 degrees C, +/- 0.5 counts and 1%
+	temp := FullSensorRecord{SensorUnits1: 0x80, M: 1, Tolerance: 1, Accuracy: 100}
+	lower, upper, e := temp.ErrorBand(24, 8, nil)
+	if e != nil {
+		t.Fatal(e)
+	}
+	assertEquals(t, "band", []float64{lower, upper}, []float64{23.26, 24.74})
+}
@@ -0,0 +1,340 @@
+package goipmi
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/runner-mei/goipmi/protocol"
+	"github.com/runner-mei/goipmi/protocol/commands"
+)
+
+// SOL configuration parameter selectors per section 26.3
+const (
+	SOLParamSetInProgress       = 0
+	SOLParamEnable              = 1
+	SOLParamAuthentication      = 2
+	SOLParamCharacterAccumulate = 3
+	SOLParamRetry               = 4
+	SOLParamNonVolatileBitRate  = 5
+	SOLParamVolatileBitRate     = 6
+	SOLParamPayloadChannel      = 7
+	SOLParamPayloadPort         = 8
+)
+
+// Completion codes of the SOL configuration commands per section 26.2
+var (
+	ErrSOLParamUnsupported = protocol.CompletionCode(0x80)
+	ErrSOLSetInProgress    = protocol.CompletionCode(0x81) // set in progress by another party
+	ErrSOLParamReadOnly    = protocol.CompletionCode(0x82)
+)
+
+// SOLConfigParameter is a SOL configuration parameter per section 26.3, it
+// is written by Set SOL Configuration Parameters and read from the response
+// of Get SOL Configuration Parameters.
+type SOLConfigParameter interface {
+	Selector() uint8
+	protocol.Readable
+	protocol.Writable
+}
+
+// States of the set in progress parameter
+const (
+	SOLSetComplete   = 0
+	SOLSetInProgress = 1
+	SOLCommitWrite   = 2
+)
+
+// SOLSetInProgressParam is the parameter 0, it is set to SOLSetInProgress
+// before the other parameters are set and to SOLSetComplete after.
+type SOLSetInProgressParam struct {
+	State uint8
+}
+
+func (self *SOLSetInProgressParam) Selector() uint8 { return SOLParamSetInProgress }
+
+func (self *SOLSetInProgressParam) WriteBytes(w *protocol.Writer) {
+	w.WriteUint8(self.State & 0x03)
+}
+
+func (self *SOLSetInProgressParam) ReadBytes(r *protocol.Reader) {
+	self.State = r.ReadUint8() & 0x03
+}
+
+// SOLEnableParam is the parameter 1, SOL can't be activated if it is
+// disabled.
+type SOLEnableParam struct {
+	Enabled bool
+}
+
+func (self *SOLEnableParam) Selector() uint8 { return SOLParamEnable }
+
+func (self *SOLEnableParam) WriteBytes(w *protocol.Writer) {
+	if self.Enabled {
+		w.WriteUint8(1)
+	} else {
+		w.WriteUint8(0)
+	}
+}
+
+func (self *SOLEnableParam) ReadBytes(r *protocol.Reader) {
+	self.Enabled = r.ReadUint8()&0x01 != 0
+}
+
+// SOLAuthenticationParam is the parameter 2, PrivilegeLevel is the minimum
+// privilege level required to activate SOL.
+type SOLAuthenticationParam struct {
+	ForceEncryption     bool
+	ForceAuthentication bool
+	PrivilegeLevel      commands.PrivLevelType
+}
+
+func (self *SOLAuthenticationParam) Selector() uint8 { return SOLParamAuthentication }
+
+func (self *SOLAuthenticationParam) WriteBytes(w *protocol.Writer) {
+	v := uint8(self.PrivilegeLevel) & 0x0f
+	if self.ForceEncryption {
+		v |= 0x80
+	}
+	if self.ForceAuthentication {
+		v |= 0x40
+	}
+	w.WriteUint8(v)
+}
+
+func (self *SOLAuthenticationParam) ReadBytes(r *protocol.Reader) {
+	v := r.ReadUint8()
+	self.ForceEncryption = v&0x80 != 0
+	self.ForceAuthentication = v&0x40 != 0
+	self.PrivilegeLevel = commands.PrivLevelType(v & 0x0f)
+}
+
+// SOLCharacterAccumulateParam is the parameter 3, the BMC sends the
+// characters from the serial controller after Interval (in 5 ms increments)
+// or once SendThreshold characters are accumulated.
+type SOLCharacterAccumulateParam struct {
+	Interval      uint8
+	SendThreshold uint8
+}
+
+func (self *SOLCharacterAccumulateParam) Selector() uint8 { return SOLParamCharacterAccumulate }
+
+func (self *SOLCharacterAccumulateParam) WriteBytes(w *protocol.Writer) {
+	w.WriteUint8(self.Interval)
+	w.WriteUint8(self.SendThreshold)
+}
+
+func (self *SOLCharacterAccumulateParam) ReadBytes(r *protocol.Reader) {
+	self.Interval = r.ReadUint8()
+	self.SendThreshold = r.ReadUint8()
+}
+
+// IntervalDuration returns the Interval as a time.Duration.
+func (self *SOLCharacterAccumulateParam) IntervalDuration() time.Duration {
+	return time.Duration(self.Interval) * 5 * time.Millisecond
+}
+
+// SOLRetryParam is the parameter 4, the BMC retransmits a packet Count (0
+// to 7) times every Interval (in 10 ms increments) until it is acknowledged.
+type SOLRetryParam struct {
+	Count    uint8
+	Interval uint8
+}
+
+func (self *SOLRetryParam) Selector() uint8 { return SOLParamRetry }
+
+func (self *SOLRetryParam) WriteBytes(w *protocol.Writer) {
+	w.WriteUint8(self.Count & 0x07)
+	w.WriteUint8(self.Interval)
+}
+
+func (self *SOLRetryParam) ReadBytes(r *protocol.Reader) {
+	self.Count = r.ReadUint8() & 0x07
+	self.Interval = r.ReadUint8()
+}
+
+// IntervalDuration returns the Interval as a time.Duration.
+func (self *SOLRetryParam) IntervalDuration() time.Duration {
+	return time.Duration(self.Interval) * 10 * time.Millisecond
+}
+
+// SOLBitRate is the bit rate of the serial controller while SOL is active.
+type SOLBitRate uint8
+
+// SOL bit rates per section 26.3
+const (
+	SOLBitRateSerial SOLBitRate = 0 // the bit rate of the serial/modem settings
+	SOLBitRate9600   SOLBitRate = 6
+	SOLBitRate19200  SOLBitRate = 7
+	SOLBitRate38400  SOLBitRate = 8
+	SOLBitRate57600  SOLBitRate = 9
+	SOLBitRate115200 SOLBitRate = 10
+)
+
+// BitsPerSecond returns the bit rate in bps, it is 0 for SOLBitRateSerial
+// and the unknown values.
+func (rate SOLBitRate) BitsPerSecond() int {
+	switch rate {
+	case SOLBitRate9600:
+		return 9600
+	case SOLBitRate19200:
+		return 19200
+	case SOLBitRate38400:
+		return 38400
+	case SOLBitRate57600:
+		return 57600
+	case SOLBitRate115200:
+		return 115200
+	default:
+		return 0
+	}
+}
+
+func (rate SOLBitRate) String() string {
+	if rate == SOLBitRateSerial {
+		return "serial"
+	}
+	if bps := rate.BitsPerSecond(); bps != 0 {
+		return strconv.Itoa(bps)
+	}
+	return "unknown(" + strconv.Itoa(int(rate)) + ")"
+}
+
+// SOLNonVolatileBitRateParam is the parameter 5.
+type SOLNonVolatileBitRateParam struct {
+	BitRate SOLBitRate
+}
+
+func (self *SOLNonVolatileBitRateParam) Selector() uint8 { return SOLParamNonVolatileBitRate }
+
+func (self *SOLNonVolatileBitRateParam) WriteBytes(w *protocol.Writer) {
+	w.WriteUint8(uint8(self.BitRate) & 0x0f)
+}
+
+func (self *SOLNonVolatileBitRateParam) ReadBytes(r *protocol.Reader) {
+	self.BitRate = SOLBitRate(r.ReadUint8() & 0x0f)
+}
+
+// SOLVolatileBitRateParam is the parameter 6, it is lost when the BMC is
+// reset.
+type SOLVolatileBitRateParam struct {
+	BitRate SOLBitRate
+}
+
+func (self *SOLVolatileBitRateParam) Selector() uint8 { return SOLParamVolatileBitRate }
+
+func (self *SOLVolatileBitRateParam) WriteBytes(w *protocol.Writer) {
+	w.WriteUint8(uint8(self.BitRate) & 0x0f)
+}
+
+func (self *SOLVolatileBitRateParam) ReadBytes(r *protocol.Reader) {
+	self.BitRate = SOLBitRate(r.ReadUint8() & 0x0f)
+}
+
+// SOLPayloadChannelParam is the parameter 7, it is read only.
+type SOLPayloadChannelParam struct {
+	Channel uint8
+}
+
+func (self *SOLPayloadChannelParam) Selector() uint8 { return SOLParamPayloadChannel }
+
+func (self *SOLPayloadChannelParam) WriteBytes(w *protocol.Writer) {
+	w.WriteUint8(self.Channel)
+}
+
+func (self *SOLPayloadChannelParam) ReadBytes(r *protocol.Reader) {
+	self.Channel = r.ReadUint8()
+}
+
+// SOLPayloadPortParam is the parameter 8, the UDP port of the SOL payload.
+type SOLPayloadPortParam struct {
+	Port uint16
+}
+
+func (self *SOLPayloadPortParam) Selector() uint8 { return SOLParamPayloadPort }
+
+func (self *SOLPayloadPortParam) WriteBytes(w *protocol.Writer) {
+	w.WriteUint16(self.Port)
+}
+
+func (self *SOLPayloadPortParam) ReadBytes(r *protocol.Reader) {
+	self.Port = r.ReadUint16()
+}
+
+// SOLConfig is the SOL configuration of a channel, the parameters that are
+// unsupported by the BMC are left zero.
+type SOLConfig struct {
+	Enable              SOLEnableParam
+	Authentication      SOLAuthenticationParam
+	CharacterAccumulate SOLCharacterAccumulateParam
+	Retry               SOLRetryParam
+	NonVolatileBitRate  SOLNonVolatileBitRateParam
+	VolatileBitRate     SOLVolatileBitRateParam
+	PayloadChannel      SOLPayloadChannelParam
+	PayloadPort         SOLPayloadPortParam
+}
+
+// Parameters returns the parameters of the config in the selector order.
+func (self *SOLConfig) Parameters() []SOLConfigParameter {
+	return []SOLConfigParameter{
+		&self.Enable,
+		&self.Authentication,
+		&self.CharacterAccumulate,
+		&self.Retry,
+		&self.NonVolatileBitRate,
+		&self.VolatileBitRate,
+		&self.PayloadChannel,
+		&self.PayloadPort,
+	}
+}
+
+// SetSOLConfigRequest per section 26.2
+type SetSOLConfigRequest struct {
+	Channel   uint8
+	Parameter SOLConfigParameter
+}
+
+func (self *SetSOLConfigRequest) WriteBytes(w *protocol.Writer) {
+	w.WriteUint8(self.Channel & 0x0f)
+	w.WriteUint8(self.Parameter.Selector())
+	self.Parameter.WriteBytes(w)
+}
+
+// SetSOLConfigResponse per section 26.2
+type SetSOLConfigResponse struct {
+	// CompletionCode
+}
+
+// GetSOLConfigRequest per section 26.3
+type GetSOLConfigRequest struct {
+	Channel       uint8
+	RevisionOnly  bool
+	Selector      uint8
+	SetSelector   uint8
+	BlockSelector uint8
+}
+
+func (self *GetSOLConfigRequest) WriteBytes(w *protocol.Writer) {
+	channel := self.Channel & 0x0f
+	if self.RevisionOnly {
+		channel |= 0x80
+	}
+	w.WriteUint8(channel)
+	w.WriteUint8(self.Selector)
+	w.WriteUint8(self.SetSelector)
+	w.WriteUint8(self.BlockSelector)
+}
+
+// GetSOLConfigResponse per section 26.3, the data is read into Parameter
+// unless only the revision is requested.
+type GetSOLConfigResponse struct {
+	// CompletionCode
+	Revision  uint8
+	Parameter SOLConfigParameter
+}
+
+func (self *GetSOLConfigResponse) ReadBytes(r *protocol.Reader) {
+	self.Revision = r.ReadUint8()
+	if self.Parameter != nil {
+		self.Parameter.ReadBytes(r)
+	}
+}
@@ -0,0 +1,124 @@
+package goipmi
+
+import (
+	"testing"
+
+	"github.com/runner-mei/goipmi/protocol"
+	"github.com/runner-mei/goipmi/protocol/commands"
+)
+
+// fakeSOLConfig answers Get/Set SOL Configuration Parameters with params,
+// the parameters that aren't in params are unsupported.
+func fakeSOLConfig(params map[uint8][]byte) *fakeHandler {
+	return &fakeHandler{handle: func(cmd commands.CommandCode, data []byte) (protocol.CompletionCode, []byte) {
+		switch cmd {
+		case GetSOLConfigurationParameters:
+			value, ok := params[data[1]]
+			if !ok {
+				return ErrSOLParamUnsupported, nil
+			}
+			return protocol.CommandCompleted, append([]byte{0x11}, value...)
+		case SetSOLConfigurationParameters:
+			value, ok := params[data[1]]
+			if !ok {
+				return ErrSOLParamUnsupported, nil
+			}
+			if data[1] == SOLParamSetInProgress && data[2] == SOLSetInProgress && value[0] != SOLSetComplete {
+				return ErrSOLSetInProgress, nil
+			}
+			if data[1] == SOLParamPayloadChannel {
+				return ErrSOLParamReadOnly, nil
+			}
+			params[data[1]] = append([]byte(nil), data[2:]...)
+			return protocol.CommandCompleted, nil
+		default:
+			return protocol.ErrInvalidCommand, nil
+		}
+	}}
+}
+
+func TestGetSOLConfig(t *testing.T) {
+	h := fakeSOLConfig(map[uint8][]byte{
+		SOLParamEnable:              {0x01},
+		SOLParamAuthentication:      {0xc4},
+		SOLParamCharacterAccumulate: {0x0c, 0x60},
+		SOLParamRetry:               {0x07, 0x32},
+		SOLParamNonVolatileBitRate:  {0x0a},
+		SOLParamVolatileBitRate:     {0x00},
+		SOLParamPayloadChannel:      {0x01},
+	})
+	c := &Client{ClientHandler: h}
+
+	config, e := c.GetSOLConfig(0x0e)
+	if e != nil {
+		t.Fatal(e)
+	}
+	assertEquals(t, "config", *config, SOLConfig{
+		Enable:              SOLEnableParam{Enabled: true},
+		Authentication:      SOLAuthenticationParam{ForceEncryption: true, ForceAuthentication: true, PrivilegeLevel: commands.PrivLevelAdmin},
+		CharacterAccumulate: SOLCharacterAccumulateParam{Interval: 12, SendThreshold: 96},
+		Retry:               SOLRetryParam{Count: 7, Interval: 50},
+		NonVolatileBitRate:  SOLNonVolatileBitRateParam{BitRate: SOLBitRate115200},
+		VolatileBitRate:     SOLVolatileBitRateParam{BitRate: SOLBitRateSerial},
+		PayloadChannel:      SOLPayloadChannelParam{Channel: 1},
+	})
+	assertEquals(t, "request", h.requests[0].data, []byte{0x0e, SOLParamEnable, 0x00, 0x00})
+	assertEquals(t, "accumulate", config.CharacterAccumulate.IntervalDuration().String(), "60ms")
+	assertEquals(t, "retry", config.Retry.IntervalDuration().String(), "500ms")
+	assertEquals(t, "bit rate", config.NonVolatileBitRate.BitRate.String(), "115200")
+}
+
+func TestSetSOLConfig(t *testing.T) {
+	params := map[uint8][]byte{
+		SOLParamSetInProgress:  {SOLSetComplete},
+		SOLParamEnable:         {0x00},
+		SOLParamAuthentication: {0x02},
+		SOLParamRetry:          {0x00, 0x00},
+		SOLParamPayloadChannel: {0x01},
+	}
+	h := fakeSOLConfig(params)
+	c := &Client{ClientHandler: h}
+
+	e := c.SetSOLConfig(0x01, &SOLEnableParam{Enabled: true},
+		&SOLAuthenticationParam{ForceAuthentication: true, PrivilegeLevel: commands.PrivLevelUser},
+		&SOLRetryParam{Count: 9, Interval: 100})
+	if e != nil {
+		t.Error(e)
+	}
+	var sets [][]byte
+	for _, req := range h.requests {
+		sets = append(sets, req.data)
+	}
+	assertEquals(t, "requests", sets, [][]byte{
+		{0x01, SOLParamSetInProgress, SOLSetInProgress},
+		{0x01, SOLParamEnable, 0x01},
+		{0x01, SOLParamAuthentication, 0x42},
+		{0x01, SOLParamRetry, 0x01, 0x64},
+		{0x01, SOLParamSetInProgress, SOLSetComplete},
+	})
+
+	// set complete after a failure
+	h.requests = nil
+	if e := c.SetSOLConfig(0x01, &SOLPayloadChannelParam{Channel: 2}); e != ErrSOLParamReadOnly {
+		t.Error("excepted is", ErrSOLParamReadOnly, ", actual is", e)
+	}
+	assertEquals(t, "requests", len(h.requests), 3)
+	assertEquals(t, "set in progress", params[SOLParamSetInProgress], []byte{SOLSetComplete})
+
+	// set in progress by another party
+	h.requests = nil
+	params[SOLParamSetInProgress] = []byte{SOLSetInProgress}
+	if e := c.SetSOLConfig(0x01, &SOLEnableParam{}); e != ErrSOLSetInProgress {
+		t.Error("excepted is", ErrSOLSetInProgress, ", actual is", e)
+	}
+	assertEquals(t, "requests", len(h.requests), 1)
+
+	// set in progress is optional
+	h.requests = nil
+	delete(params, SOLParamSetInProgress)
+	if e := c.SetSOLConfig(0x01, &SOLEnableParam{}); e != nil {
+		t.Error(e)
+	}
+	assertEquals(t, "requests", len(h.requests), 2)
+	assertEquals(t, "enable", params[SOLParamEnable], []byte{0x00})
+}
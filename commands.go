@@ -77,7 +77,7 @@ var (
 	// Channel Ah enable/disable                   10
 	// Channel Bh enable/disable                   11
 	GetMessage  = commands.CommandCode{Name: "Get Message", NetworkFunction: commands.NetworkFunctionApp, Code: 0x33, PrivilegeLevel: commands.PrivLevelNone}
-	SendMessage = commands.CommandCode{Name: "Send Message", NetworkFunction: commands.NetworkFunctionApp, Code: 0x34, PrivilegeLevel: commands.PrivLevelUser} // Administator for some channels
+	SendMessage = commands.SendMessage
 	// Send to channel 0
 	// Send to channel 1
 	// Send to channel 2
@@ -141,8 +141,8 @@ var (
 	SetUserName            = commands.CommandCode{Name: "Set User Name", NetworkFunction: commands.NetworkFunctionApp, Code: 0x45, PrivilegeLevel: commands.PrivLevelAdmin}
 	GetUserNameCommand     = commands.CommandCode{Name: "Get User Name Command", NetworkFunction: commands.NetworkFunctionApp, Code: 0x46, PrivilegeLevel: commands.PrivLevelOperator}
 	SetUserPasswordCommand = commands.CommandCode{Name: "Set User Password Command", NetworkFunction: commands.NetworkFunctionApp, Code: 0x47, PrivilegeLevel: commands.PrivLevelAdmin}
-	ActivatePayload        = commands.CommandCode{Name: "Activate Payload", NetworkFunction: commands.NetworkFunctionApp, Code: 0x48}   // Depends on payload type.
-	DeactivatePayload      = commands.CommandCode{Name: "Deactivate Payload", NetworkFunction: commands.NetworkFunctionApp, Code: 0x49} // Depends on payload type.
+	ActivatePayload        = commands.ActivatePayload
+	DeactivatePayload      = commands.DeactivatePayload
 
 	SetUserPayloadAccess     = commands.CommandCode{Name: "Set User Payload Access", NetworkFunction: commands.NetworkFunctionApp, Code: 0x4C, PrivilegeLevel: commands.PrivLevelAdmin}
 	GetUserPayloadAccess     = commands.CommandCode{Name: "Get User Payload Access", NetworkFunction: commands.NetworkFunctionApp, Code: 0x4D, PrivilegeLevel: commands.PrivLevelOperator}
@@ -197,7 +197,7 @@ var (
 
 	// unassigned= commands.CommandCode{Name: "unassigned", NetworkFunction: commands.NetworkFunctionApp, Code: 0x53}
 
-	GetChannelCipherSuites         = commands.CommandCode{Name: "Get Channel Cipher Suites", NetworkFunction: commands.NetworkFunctionApp, Code: 0x54, PrivilegeLevel: commands.PrivLevelUnprotected}
+	GetChannelCipherSuites         = commands.GetChannelCipherSuites
 	SuspendResumePayloadEncryption = commands.CommandCode{Name: "Suspend/Resume Payload Encryption", NetworkFunction: commands.NetworkFunctionApp, Code: 0x55, PrivilegeLevel: commands.PrivLevelUser}
 	SetChannelSecurityKeys         = commands.CommandCode{Name: "Set Channel Security Keys", NetworkFunction: commands.NetworkFunctionApp, Code: 0x56, PrivilegeLevel: commands.PrivLevelAdmin}
 	GetSystemInterfaceCapabilities = commands.CommandCode{Name: "Get System Interface Capabilities", NetworkFunction: commands.NetworkFunctionApp, Code: 0x57, PrivilegeLevel: commands.PrivLevelUser}
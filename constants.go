@@ -164,6 +164,31 @@ const (
 	SENSOR_UNIT_GRAMS              = 92
 )
 
+var sensorUnitNames = []string{
+	"unspecified", "degrees C", "degrees F", "degrees K", "Volts", "Amps",
+	"Watts", "Joules", "Coulombs", "VA", "Nits", "lumen", "lux", "Candela",
+	"kPa", "PSI", "Newton", "CFM", "RPM", "Hz", "microsecond", "millisecond",
+	"second", "minute", "hour", "day", "week", "mil", "inches", "feet",
+	"cu in", "cu feet", "mm", "cm", "m", "cu cm", "cu m", "liters",
+	"fluid ounce", "radians", "steradians", "revolutions", "cycles",
+	"gravities", "ounce", "pound", "ft-lb", "oz-in", "gauss", "gilberts",
+	"henry", "millihenry", "farad", "microfarad", "ohms", "siemens", "mole",
+	"becquerel", "PPM", "reserved", "Decibels", "DbA", "DbC", "gray",
+	"sievert", "color temp deg K", "bit", "kilobit", "megabit", "gigabit",
+	"byte", "kilobyte", "megabyte", "gigabyte", "word", "dword", "qword",
+	"line", "hit", "miss", "retry", "reset", "overflow", "underrun",
+	"collision", "packets", "messages", "characters", "error",
+	"correctable error", "uncorrectable error", "fatal error", "grams",
+}
+
+// String returns the name of the unit per table 43-15.
+func (self SensorUnit) String() string {
+	if int(self) < len(sensorUnitNames) {
+		return sensorUnitNames[self]
+	}
+	return "unknown"
+}
+
 const (
 	SENSOR_TEMPERATURE                      = 1
 	SENSOR_VOLTAGE                          = 2
@@ -212,3 +237,29 @@ const (
 	SENSOR_OEM                              = 192
 	SENSOR_OEMRESERVED                      = 118
 )
+
+var sensorTypeNames = []string{
+	"Reserved", "Temperature", "Voltage", "Current", "Fan",
+	"Physical Security", "Platform Security", "Processor", "Power Supply",
+	"Power Unit", "Cooling Device", "Other", "Memory", "Drive Slot / Bay",
+	"POST Memory Resize", "System Firmware Progress", "Event Logging Disabled",
+	"Watchdog 1", "System Event", "Critical Interrupt", "Button / Switch",
+	"Module / Board", "Microcontroller / Coprocessor", "Add-in Card",
+	"Chassis", "Chip Set", "Other FRU", "Cable / Interconnect", "Terminator",
+	"System Boot Initiated", "Boot Error", "OS Boot", "OS Critical Stop",
+	"Slot / Connector", "System ACPI Power State", "Watchdog 2",
+	"Platform Alert", "Entity Presence", "Monitor ASIC / IC", "LAN",
+	"Management Subsystem Health", "Battery", "Session Audit",
+	"Version Change", "FRU State",
+}
+
+// SensorTypeName returns the name of the sensor type per table 42-3.
+func SensorTypeName(sensorType uint8) string {
+	if int(sensorType) < len(sensorTypeNames) {
+		return sensorTypeNames[sensorType]
+	}
+	if sensorType >= SENSOR_OEM {
+		return "OEM"
+	}
+	return "Unknown"
+}
@@ -129,16 +129,24 @@ func main() {
 		log.Fatalln("get List Sdr,", err)
 	}
 
-	fullRecords, readings, err := client.ListFullSDRReading(records)
+	instances, readings, err := client.ListFullSDRReading(records)
 	if err != nil {
 		log.Fatalln("get Sdr reading,", err)
 	}
-	for idx, full := range fullRecords {
+	for idx, instance := range instances {
+		header := instance.Record.GetHeader()
 		if readings[idx].Error != nil {
-			fmt.Println(full.RecordId, full.EntityId, full.IdString, readings[idx].Error)
+			fmt.Println(header.RecordId, instance.EntityInstance, instance.Name, readings[idx].Error)
 			continue
 		}
-		value, err := full.Calc(int32(readings[idx].Response.Reading), 8)
+		full, ok := instance.Record.(*goipmi.FullSensorRecord)
+		if !ok {
+			compact := instance.Record.(*goipmi.CompactSensorRecord)
+			fmt.Println(header.RecordId, instance.EntityInstance, instance.Name)
+			fmt.Println(readings[idx].Response.ToEventString(compact.EventOrReadingTypeCode))
+			continue
+		}
+		value, err := client.CalcSensorReading(full, readings[idx].Response.Reading)
 		fmt.Println(full.RecordId, full.EntityId, full.IdString, value, err)
 
 		fmt.Println(readings[idx].Response.ToEventString(full.EventOrReadingTypeCode))
@@ -0,0 +1,103 @@
+package protocol
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"strconv"
+)
+
+// IPMIv1AuthCode calculates the AuthCode of the IPMI v1.5 session header per
+// section 22.17.1, data is the IPMI message that follows the session header
+// and password is padded with zeros to 16 bytes.
+func IPMIv1AuthCode(authType uint8, password []byte, sessionID, sequence uint32, data []byte) ([]byte, error) {
+	var key [16]byte
+	copy(key[:], password)
+
+	switch authType {
+	case AuthTypeNone:
+		return nil, nil
+	case AuthTypePassword:
+		return key[:], nil
+	case AuthTypeMD5, AuthTypeMD2:
+		var bs = make([]byte, 16+4+len(data)+4+16)
+		copy(bs, key[:])
+		binary.LittleEndian.PutUint32(bs[16:], sessionID)
+		copy(bs[20:], data)
+		binary.LittleEndian.PutUint32(bs[20+len(data):], sequence)
+		copy(bs[24+len(data):], key[:])
+
+		var sum [16]byte
+		if authType == AuthTypeMD5 {
+			sum = md5.Sum(bs)
+		} else {
+			sum = md2Sum(bs)
+		}
+		return sum[:], nil
+	default:
+		return nil, errors.New("AuthType(" + strconv.FormatInt(int64(authType), 10) + ") is unsupported")
+	}
+}
+
+// md2Table is the permutation of 0..255 constructed from the digits of pi
+// per RFC 1319.
+var md2Table = [256]uint8{
+	41, 46, 67, 201, 162, 216, 124, 1, 61, 54, 84, 161, 236, 240, 6, 19,
+	98, 167, 5, 243, 192, 199, 115, 140, 152, 147, 43, 217, 188, 76, 130, 202,
+	30, 155, 87, 60, 253, 212, 224, 22, 103, 66, 111, 24, 138, 23, 229, 18,
+	190, 78, 196, 214, 218, 158, 222, 73, 160, 251, 245, 142, 187, 47, 238, 122,
+	169, 104, 121, 145, 21, 178, 7, 63, 148, 194, 16, 137, 11, 34, 95, 33,
+	128, 127, 93, 154, 90, 144, 50, 39, 53, 62, 204, 231, 191, 247, 151, 3,
+	255, 25, 48, 179, 72, 165, 181, 209, 215, 94, 146, 42, 172, 86, 170, 198,
+	79, 184, 56, 210, 150, 164, 125, 182, 118, 252, 107, 226, 156, 116, 4, 241,
+	69, 157, 112, 89, 100, 113, 135, 32, 134, 91, 207, 101, 230, 45, 168, 2,
+	27, 96, 37, 173, 174, 176, 185, 246, 28, 70, 97, 105, 52, 64, 126, 15,
+	85, 71, 163, 35, 221, 81, 175, 58, 195, 92, 249, 206, 186, 197, 234, 38,
+	44, 83, 13, 110, 133, 40, 132, 9, 211, 223, 205, 244, 65, 129, 77, 82,
+	106, 220, 55, 200, 108, 193, 171, 250, 36, 225, 123, 8, 12, 189, 177, 74,
+	120, 136, 149, 139, 227, 99, 232, 109, 233, 203, 213, 254, 59, 0, 29, 57,
+	242, 239, 183, 14, 102, 88, 208, 228, 166, 119, 114, 248, 235, 117, 75, 10,
+	49, 68, 80, 180, 143, 237, 31, 26, 219, 153, 141, 51, 159, 17, 131, 20,
+}
+
+// md2Sum returns the MD2 digest of data per RFC 1319, MD2 isn't provided by
+// the standard library but it is still offered by some IPMI v1.5 BMCs.
+func md2Sum(data []byte) [16]byte {
+	padding := 16 - len(data)%16
+	bs := make([]byte, len(data), len(data)+padding+16)
+	copy(bs, data)
+	for i := 0; i < padding; i++ {
+		bs = append(bs, uint8(padding))
+	}
+
+	var checksum [16]byte
+	var last uint8
+	for i := 0; i < len(bs); i += 16 {
+		for j := 0; j < 16; j++ {
+			checksum[j] ^= md2Table[bs[i+j]^last]
+			last = checksum[j]
+		}
+	}
+	bs = append(bs, checksum[:]...)
+
+	var x [48]byte
+	for i := 0; i < len(bs); i += 16 {
+		for j := 0; j < 16; j++ {
+			x[16+j] = bs[i+j]
+			x[32+j] = x[16+j] ^ x[j]
+		}
+
+		var t uint8
+		for j := 0; j < 18; j++ {
+			for k := 0; k < 48; k++ {
+				x[k] ^= md2Table[t]
+				t = x[k]
+			}
+			t += uint8(j)
+		}
+	}
+
+	var sum [16]byte
+	copy(sum[:], x[:16])
+	return sum
+}
@@ -0,0 +1,123 @@
+package protocol
+
+import (
+	"github.com/runner-mei/goipmi/protocol/commands"
+)
+
+// bmcSlaveAddr is the IPMB slave address of the BMC.
+const bmcSlaveAddr = 0x20
+
+// Target is a controller that is addressed by a request, the zero value is
+// the BMC. A request to other controllers such as the ME or a PSU is bridged
+// by the BMC with Send Message per section 22.7.
+type Target struct {
+	Address uint8 // IPMB slave address (8-bit) of the controller
+	Channel uint8 // channel of the controller, 0 is the primary IPMB
+	LUN     uint8
+
+	// TransitAddress and TransitChannel enable dual bridging, the request is
+	// bridged to the controller at TransitAddress which bridges it again to
+	// the controller at Address on Channel.
+	TransitAddress uint8
+	TransitChannel uint8
+}
+
+// IsBMC reports whether the target is the BMC itself, which is addressed
+// without bridging. The BMC address on another channel is a controller on
+// that channel as in ipmitool.
+func (t Target) IsBMC() bool {
+	return (t.Address == 0 || t.Address == bmcSlaveAddr) && t.Channel == 0 && t.TransitAddress == 0
+}
+
+// SendMessageRequest per section 22.7, Message is the IPMB request that is
+// bridged to Channel with request tracking.
+type SendMessageRequest struct {
+	Channel uint8
+	Message *Request
+}
+
+func (self *SendMessageRequest) WriteBytes(w *Writer) {
+	w.WriteUint8(0x40 | (self.Channel & 0x0f)) // track request
+	self.Message.WriteBytes(w)
+}
+
+// SendMessageResponse per section 22.7, Message is the response of the
+// bridged request, it is absent if the BMC sends it in a separate message.
+type SendMessageResponse struct {
+	Message *Response
+
+	received bool
+}
+
+func (self *SendMessageResponse) ReadBytes(r *Reader) {
+	if r.Len() == 0 {
+		return
+	}
+	self.Message.ReadBytes(r)
+	self.received = r.Err() == nil
+}
+
+// bridgeRequest encapsulates the request for cmd in one Send Message for
+// single bridging or two nested Send Messages for dual bridging. It returns
+// the outer request and response, and the responses of every level from the
+// outer to the innermost one.
+func bridgeRequest(target Target, cmd commands.CommandCode, reqData, respData interface{}, rqSeq uint8) (*Request, []*Response) {
+	req := NewRequest(cmd, reqData)
+	req.Body.RsAddr = target.Address
+	req.Body.NetFnRsLUN |= target.LUN & 0x03
+	req.Body.RqAddr = bmcSlaveAddr
+	req.Body.RqSeq = rqSeq
+	responses := []*Response{NewResponse(cmd, respData)}
+
+	channel := target.Channel
+	if target.TransitAddress != 0 {
+		req.Body.RqAddr = target.TransitAddress
+		req = &Request{Body: IPMIBody{RsAddr: target.TransitAddress,
+			NetFnRsLUN: uint8(commands.SendMessage.NetworkFunction) << 2,
+			RqAddr:     bmcSlaveAddr,
+			RqSeq:      rqSeq,
+			Cmd:        commands.SendMessage.Code},
+			Data: &SendMessageRequest{Channel: channel, Message: req}}
+		responses = append([]*Response{NewResponse(commands.SendMessage,
+			&SendMessageResponse{Message: responses[0]})}, responses...)
+		channel = target.TransitChannel
+	}
+
+	outer := NewRequest(commands.SendMessage, &SendMessageRequest{Channel: channel, Message: req})
+	responses = append([]*Response{NewResponse(commands.SendMessage,
+		&SendMessageResponse{Message: responses[0]})}, responses...)
+	return outer, responses
+}
+
+// bridgedResult returns the first completion code that isn't
+// CommandCompleted from the outer response to the innermost one.
+func bridgedResult(responses []*Response) error {
+	for idx, resp := range responses {
+		if resp.CompletionCode != CommandCompleted {
+			return resp.CompletionCode
+		}
+		if idx+1 < len(responses) && !resp.Data.(*SendMessageResponse).received {
+			return ErrInsufficientBytes // the bridged response is missing
+		}
+	}
+	return nil
+}
+
+// pendingBridgedResponse reports whether msg, the IPMI message of a response
+// to req, is a Send Message response without the response of the bridged
+// request. The BMC sends the bridged response later with the same rqSeq, so
+// the pending response is skipped while waiting for it.
+func pendingBridgedResponse(req *Request, msg []byte) bool {
+	bridged, ok := req.Data.(*SendMessageRequest)
+	if !ok {
+		return false
+	}
+	// message body, completion code and checksum
+	if len(msg) < IPMIBodySize+2 || msg[IPMIBodySize] != uint8(CommandCompleted) {
+		return false
+	}
+	if len(msg) == IPMIBodySize+2 {
+		return true
+	}
+	return pendingBridgedResponse(bridged.Message, msg[IPMIBodySize+1:len(msg)-1])
+}
@@ -0,0 +1,92 @@
+package protocol
+
+import (
+	"testing"
+
+	"github.com/runner-mei/goipmi/protocol/commands"
+)
+
+var bridgedCommand = commands.CommandCode{Name: "Get Sensor Reading", NetworkFunction: commands.NetworkFunctionSensor, Code: 0x2d}
+
+func TestBridgeRequest(t *testing.T) {
+	for _, test := range []struct {
+		target    Target
+		responses int
+		excepted  []byte
+	}{
+		{target: Target{Address: 0x2c, Channel: 0x07, LUN: 1},
+			responses: 2,
+			excepted: []byte{0x47,
+				0x2c, 0x11, 0xc3, 0x20, 0x04, 0x2d, 0x05, 0xaa}},
+		{target: Target{Address: 0x2c, Channel: 0x07, TransitAddress: 0x82, TransitChannel: 0x06},
+			responses: 3,
+			excepted: []byte{0x46,
+				0x82, 0x18, 0x66, 0x20, 0x04, 0x34, 0x47,
+				0x2c, 0x10, 0xc4, 0x82, 0x04, 0x2d, 0x05, 0x48,
+				0x61}},
+	} {
+		req, responses := bridgeRequest(test.target, bridgedCommand, []byte{0x05}, &[]byte{}, 0x04)
+		assertEquals(t, "Cmd", req.Body.Cmd, commands.SendMessage.Code)
+		assertEquals(t, "responses", len(responses), test.responses)
+
+		w := Writer{}
+		w.Init(nil)
+		req.Data.(*SendMessageRequest).WriteBytes(&w)
+		assertEquals(t, "data", w.Bytes(), test.excepted)
+	}
+}
+
+func TestTargetIsBMC(t *testing.T) {
+	assertEquals(t, "zero", Target{}.IsBMC(), true)
+	assertEquals(t, "BMC", Target{Address: 0x20, LUN: 2}.IsBMC(), true)
+	assertEquals(t, "channel", Target{Address: 0x20, Channel: 7}.IsBMC(), false)
+	assertEquals(t, "IPMB", Target{Address: 0x2c}.IsBMC(), false)
+	assertEquals(t, "dual", Target{TransitAddress: 0x82}.IsBMC(), false)
+}
+
+func TestPendingBridgedResponse(t *testing.T) {
+	single, _ := bridgeRequest(Target{Address: 0x2c}, bridgedCommand, []byte{0x05}, &[]byte{}, 0x04)
+	dual, _ := bridgeRequest(Target{Address: 0x2c, TransitAddress: 0x82}, bridgedCommand, []byte{0x05}, &[]byte{}, 0x04)
+
+	var header = []byte{0x81, 0x1c, 0x63, 0x20, 0x04, 0x34}
+	var pending = append(header[:6:6], 0x00, 0xa8)
+	var failed = append(header[:6:6], 0xd3, 0xa8)
+	var nested = append(append(append(header[:6:6], 0x00),
+		0x20, 0x1c, 0xc4, 0x82, 0x04, 0x34, 0x00, 0x46), 0x00)
+	var completed = append(append(append(header[:6:6], 0x00),
+		0x20, 0x14, 0xcc, 0x2c, 0x04, 0x2d, 0x00, 0x35, 0xc0, 0x00, 0x6e), 0x00)
+
+	assertEquals(t, "pending", pendingBridgedResponse(single, pending), true)
+	assertEquals(t, "failed", pendingBridgedResponse(single, failed), false)
+	assertEquals(t, "completed", pendingBridgedResponse(single, completed), false)
+	assertEquals(t, "nested", pendingBridgedResponse(dual, nested), true)
+	assertEquals(t, "not bridged", pendingBridgedResponse(NewRequest(bridgedCommand, nil), pending), false)
+}
+
+func TestBridgedResult(t *testing.T) {
+	var reading struct{ Reading, Status, State uint8 }
+	_, responses := bridgeRequest(Target{Address: 0x2c}, bridgedCommand, []byte{0x05}, &reading, 0x04)
+
+	var r Reader
+	r.Init([]byte{0x81, 0x1c, 0x63, 0x20, 0x04, 0x34, 0x00,
+		0x20, 0x14, 0xcc, 0x2c, 0x04, 0x2d, 0x00, 0x35, 0xc0, 0x00, 0x6e,
+		0x00})
+	responses[0].ReadBytes(&r)
+	if e := bridgedResult(responses); e != nil {
+		t.Error(e)
+	}
+	assertEquals(t, "Reading", reading.Reading, uint8(0x35))
+	assertEquals(t, "Status", reading.Status, uint8(0xc0))
+
+	_, responses = bridgeRequest(Target{Address: 0x2c}, bridgedCommand, []byte{0x05}, &reading, 0x04)
+	r.Init([]byte{0x81, 0x1c, 0x63, 0x20, 0x04, 0x34, 0x00, 0xa8})
+	responses[0].ReadBytes(&r)
+	assertEquals(t, "missing", bridgedResult(responses), error(ErrInsufficientBytes))
+
+	_, responses = bridgeRequest(Target{Address: 0x2c}, bridgedCommand, []byte{0x05}, &reading, 0x04)
+	r.Init([]byte{0x81, 0x1c, 0x63, 0x20, 0x04, 0x34, 0x00,
+		0x20, 0x14, 0xcc, 0x2c, 0x04, 0x2d, 0xd3, 0xa3,
+		0x00})
+	responses[0].ReadBytes(&r)
+	assertEquals(t, "failed", bridgedResult(responses), error(ErrDestUnavail))
+}
@@ -0,0 +1,181 @@
+package protocol
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/runner-mei/goipmi/protocol/commands"
+)
+
+// GetChannelCipherSuitesRequest per section 22.15
+type GetChannelCipherSuitesRequest struct {
+	ChannelNumber uint8
+	PayloadType   uint8
+	ListIndex     uint8 // bit 7 - list algorithms by cipher suite, bit 5:0 - list index
+}
+
+// GetChannelCipherSuitesResponse per section 22.15
+type GetChannelCipherSuitesResponse struct {
+	ChannelNumber uint8
+	Data          []byte // cipher suite record data, up to 16 bytes
+}
+
+func (self *GetChannelCipherSuitesResponse) ReadBytes(r *Reader) {
+	self.ChannelNumber = r.ReadUint8()
+	self.Data = r.ReadCopy(r.Len())
+}
+
+// cipher suite record tags per table 22-18
+const (
+	cipherSuiteStandardRecord = 0xC0
+	cipherSuiteOEMRecord      = 0xC1
+
+	cipherSuiteTagMask            = 0xC0
+	cipherSuiteTagAuthentication  = 0x00
+	cipherSuiteTagIntegrity       = 0x40
+	cipherSuiteTagConfidentiality = 0x80
+)
+
+// CipherSuite is a combination of the algorithms used by a RMCP+ session
+type CipherSuite struct {
+	ID              uint8
+	OEM             bool
+	OEMIANA         uint32
+	Authentication  RAKPAlgorithmAuthMethod
+	Integrity       RAKPAlgorithmIntegrityMethod
+	Confidentiality RAKPAlgorithmConfidentialityMethod
+}
+
+func (self CipherSuite) String() string {
+	return strconv.FormatInt(int64(self.ID), 10) + "(" +
+		self.Authentication.String() + ", " +
+		self.Integrity.String() + ", " +
+		self.Confidentiality.String() + ")"
+}
+
+// CipherSuites are the standard cipher suites per table 22-20, they are
+// indexed by their ID as used by `ipmitool -C`.
+var CipherSuites = []CipherSuite{
+	{ID: 0, Authentication: RAKPAlgorithmAuth_None, Integrity: RAKPAlgorithmIntegrity_None, Confidentiality: RAKPAlgorithmEncryto_None},
+	{ID: 1, Authentication: RAKPAlgorithmAuth_HMAC_SHA1, Integrity: RAKPAlgorithmIntegrity_None, Confidentiality: RAKPAlgorithmEncryto_None},
+	{ID: 2, Authentication: RAKPAlgorithmAuth_HMAC_SHA1, Integrity: RAKPAlgorithmIntegrity_HMAC_SHA1_96, Confidentiality: RAKPAlgorithmEncryto_None},
+	{ID: 3, Authentication: RAKPAlgorithmAuth_HMAC_SHA1, Integrity: RAKPAlgorithmIntegrity_HMAC_SHA1_96, Confidentiality: RAKPAlgorithmEncryto_AES_CBC_128},
+	{ID: 4, Authentication: RAKPAlgorithmAuth_HMAC_SHA1, Integrity: RAKPAlgorithmIntegrity_HMAC_SHA1_96, Confidentiality: RAKPAlgorithmEncryto_XRC4_128},
+	{ID: 5, Authentication: RAKPAlgorithmAuth_HMAC_SHA1, Integrity: RAKPAlgorithmIntegrity_HMAC_SHA1_96, Confidentiality: RAKPAlgorithmEncryto_XRC4_40},
+	{ID: 6, Authentication: RAKPAlgorithmAuth_HMAC_MD5, Integrity: RAKPAlgorithmIntegrity_None, Confidentiality: RAKPAlgorithmEncryto_None},
+	{ID: 7, Authentication: RAKPAlgorithmAuth_HMAC_MD5, Integrity: RAKPAlgorithmIntegrity_HMAC_MD5_128, Confidentiality: RAKPAlgorithmEncryto_None},
+	{ID: 8, Authentication: RAKPAlgorithmAuth_HMAC_MD5, Integrity: RAKPAlgorithmIntegrity_HMAC_MD5_128, Confidentiality: RAKPAlgorithmEncryto_AES_CBC_128},
+	{ID: 9, Authentication: RAKPAlgorithmAuth_HMAC_MD5, Integrity: RAKPAlgorithmIntegrity_HMAC_MD5_128, Confidentiality: RAKPAlgorithmEncryto_XRC4_128},
+	{ID: 10, Authentication: RAKPAlgorithmAuth_HMAC_MD5, Integrity: RAKPAlgorithmIntegrity_HMAC_MD5_128, Confidentiality: RAKPAlgorithmEncryto_XRC4_40},
+	{ID: 11, Authentication: RAKPAlgorithmAuth_HMAC_MD5, Integrity: RAKPAlgorithmIntegrity_MD5_128, Confidentiality: RAKPAlgorithmEncryto_None},
+	{ID: 12, Authentication: RAKPAlgorithmAuth_HMAC_MD5, Integrity: RAKPAlgorithmIntegrity_MD5_128, Confidentiality: RAKPAlgorithmEncryto_AES_CBC_128},
+	{ID: 13, Authentication: RAKPAlgorithmAuth_HMAC_MD5, Integrity: RAKPAlgorithmIntegrity_MD5_128, Confidentiality: RAKPAlgorithmEncryto_XRC4_128},
+	{ID: 14, Authentication: RAKPAlgorithmAuth_HMAC_MD5, Integrity: RAKPAlgorithmIntegrity_MD5_128, Confidentiality: RAKPAlgorithmEncryto_XRC4_40},
+	{ID: 15, Authentication: RAKPAlgorithmAuth_HMAC_SHA256, Integrity: RAKPAlgorithmIntegrity_None, Confidentiality: RAKPAlgorithmEncryto_None},
+	{ID: 16, Authentication: RAKPAlgorithmAuth_HMAC_SHA256, Integrity: RAKPAlgorithmIntegrity_HMAC_SHA256_128, Confidentiality: RAKPAlgorithmEncryto_None},
+	{ID: 17, Authentication: RAKPAlgorithmAuth_HMAC_SHA256, Integrity: RAKPAlgorithmIntegrity_HMAC_SHA256_128, Confidentiality: RAKPAlgorithmEncryto_AES_CBC_128},
+	{ID: 18, Authentication: RAKPAlgorithmAuth_HMAC_SHA256, Integrity: RAKPAlgorithmIntegrity_HMAC_SHA256_128, Confidentiality: RAKPAlgorithmEncryto_XRC4_128},
+	{ID: 19, Authentication: RAKPAlgorithmAuth_HMAC_SHA256, Integrity: RAKPAlgorithmIntegrity_HMAC_SHA256_128, Confidentiality: RAKPAlgorithmEncryto_XRC4_40},
+}
+
+// strongestCipherSuites are the IDs of the cipher suites selected by "auto",
+// from the strongest to the weakest. The HMAC-SHA256 suites 17, 16 and 15
+// are ranked ahead of the SHA1 suites since 17 is the default of the current
+// BMCs, xRC4-40 is ranked below the suites of integrity only.
+var strongestCipherSuites = []uint8{17, 16, 15, 3, 8, 12, 18, 4, 9, 13, 2, 7, 11, 19, 5, 10, 14, 1, 6}
+
+// ParseCipherSuite parses the CipherSuite option, "" means the algorithms
+// are given by the options, "auto" selects the strongest cipher suite that
+// is supported by both sides, otherwise it is a ipmitool style ID.
+func ParseCipherSuite(s string) (*CipherSuite, error) {
+	switch strings.ToLower(s) {
+	case "", "auto":
+		return nil, nil
+	}
+
+	id, err := strconv.ParseUint(s, 10, 8)
+	if err != nil || int(id) >= len(CipherSuites) {
+		return nil, errors.New(s + " is unsupported cipher suite")
+	}
+	suite := CipherSuites[id]
+	return &suite, nil
+}
+
+// ParseCipherSuiteRecords parses the cipher suite records per table 22-18.
+func ParseCipherSuiteRecords(data []byte) ([]CipherSuite, error) {
+	var results []CipherSuite
+	for i := 0; i < len(data); {
+		var suite CipherSuite
+		switch data[i] {
+		case cipherSuiteStandardRecord:
+			if i+1 >= len(data) {
+				return nil, ErrInsufficientBytes
+			}
+			suite.ID = data[i+1]
+			i += 2
+		case cipherSuiteOEMRecord:
+			if i+4 >= len(data) {
+				return nil, ErrInsufficientBytes
+			}
+			suite.ID = data[i+1]
+			suite.OEM = true
+			suite.OEMIANA = uint32(data[i+2]) | uint32(data[i+3])<<8 | uint32(data[i+4])<<16
+			i += 5
+		default:
+			return nil, errors.New("invalid cipher suite record start(" + strconv.FormatInt(int64(data[i]), 16) + ")")
+		}
+
+		for ; i < len(data) && (data[i]&cipherSuiteTagMask) != cipherSuiteTagMask; i++ {
+			switch data[i] & cipherSuiteTagMask {
+			case cipherSuiteTagAuthentication:
+				suite.Authentication = RAKPAlgorithmAuthMethod(data[i] &^ cipherSuiteTagMask)
+			case cipherSuiteTagIntegrity:
+				suite.Integrity = RAKPAlgorithmIntegrityMethod(data[i] &^ cipherSuiteTagMask)
+			case cipherSuiteTagConfidentiality:
+				suite.Confidentiality = RAKPAlgorithmConfidentialityMethod(data[i] &^ cipherSuiteTagMask)
+			}
+		}
+		results = append(results, suite)
+	}
+	return results, nil
+}
+
+// ReadChannelCipherSuites reads all cipher suite records of the channel, the
+// records are returned in pieces of 16 bytes so exec is called until a
+// shorter piece is received.
+func ReadChannelCipherSuites(ctx context.Context, channel uint8,
+	exec func(ctx context.Context, cmd commands.CommandCode, req, resp interface{}) error) ([]CipherSuite, error) {
+	var data []byte
+	for index := uint8(0); index < 0x40; index++ {
+		req := GetChannelCipherSuitesRequest{
+			ChannelNumber: channel,
+			PayloadType:   uint8(PayloadIPMI),
+			ListIndex:     0x80 | index,
+		}
+		var resp GetChannelCipherSuitesResponse
+		if err := exec(ctx, commands.GetChannelCipherSuites, &req, &resp); err != nil {
+			return nil, err
+		}
+
+		data = append(data, resp.Data...)
+		if len(resp.Data) < 16 {
+			break
+		}
+	}
+	return ParseCipherSuiteRecords(data)
+}
+
+// strongestCipherSuite returns the strongest cipher suite in suites that is
+// supported by lanPlus.
+func strongestCipherSuite(suites []CipherSuite) (*CipherSuite, error) {
+	for _, id := range strongestCipherSuites {
+		for idx := range suites {
+			if suites[idx].ID == id && !suites[idx].OEM {
+				return &suites[idx], nil
+			}
+		}
+	}
+	return nil, errors.New("BMC did not offer a supported cipher suite")
+}
@@ -0,0 +1,83 @@
+package protocol
+
+import (
+	"context"
+	"testing"
+
+	"github.com/runner-mei/goipmi/protocol/commands"
+)
+
+// the cipher suite records are returned in pieces of 16 bytes
+var cipher_suite_records = [][]byte{
+	{0xc0, 0x00, 0x00, 0x40, 0x80, 0xc0, 0x01, 0x01, 0x40, 0x80, 0xc0, 0x02, 0x01, 0x41, 0x80, 0xc0},
+	{0x03, 0x01, 0x41, 0x81, 0xc1, 0x50, 0xa2, 0x02, 0x00, 0x01, 0x41, 0x81, 0xc0, 0x11, 0x03, 0x44},
+	{0x81},
+}
+
+func TestReadChannelCipherSuites(t *testing.T) {
+	calls := 0
+	suites, e := ReadChannelCipherSuites(context.Background(), 0x0e,
+		func(ctx context.Context, cmd commands.CommandCode, req, resp interface{}) error {
+			assertEquals(t, "cmd", cmd, commands.GetChannelCipherSuites)
+			assertEquals(t, "req.ListIndex", req.(*GetChannelCipherSuitesRequest).ListIndex, uint8(0x80|calls))
+			resp.(*GetChannelCipherSuitesResponse).Data = cipher_suite_records[calls]
+			calls++
+			return nil
+		})
+	if e != nil {
+		t.Error(e)
+		return
+	}
+
+	// the first two pieces are full, so a third request is sent.
+	assertEquals(t, "calls", calls, 3)
+	assertEquals(t, "suites", suites, []CipherSuite{
+		{ID: 0},
+		{ID: 1, Authentication: RAKPAlgorithmAuth_HMAC_SHA1},
+		{ID: 2, Authentication: RAKPAlgorithmAuth_HMAC_SHA1, Integrity: RAKPAlgorithmIntegrity_HMAC_SHA1_96},
+		{ID: 3, Authentication: RAKPAlgorithmAuth_HMAC_SHA1, Integrity: RAKPAlgorithmIntegrity_HMAC_SHA1_96, Confidentiality: RAKPAlgorithmEncryto_AES_CBC_128},
+		{ID: 0x50, OEM: true, OEMIANA: 0x02a2, Authentication: RAKPAlgorithmAuth_HMAC_SHA1, Integrity: RAKPAlgorithmIntegrity_HMAC_SHA1_96, Confidentiality: RAKPAlgorithmEncryto_AES_CBC_128},
+		{ID: 17, Authentication: RAKPAlgorithmAuth_HMAC_SHA256, Integrity: RAKPAlgorithmIntegrity_HMAC_SHA256_128, Confidentiality: RAKPAlgorithmEncryto_AES_CBC_128},
+	})
+
+	suite, e := strongestCipherSuite(suites)
+	if e != nil {
+		t.Error(e)
+		return
+	}
+	assertEquals(t, "strongest", suite.ID, uint8(17))
+
+	// a BMC of cipher suite 17 only
+	if suite, e = strongestCipherSuite(suites[5:]); e != nil {
+		t.Error(e)
+		return
+	}
+	assertEquals(t, "17 only", suite.ID, uint8(17))
+
+	if _, e := strongestCipherSuite(suites[:1]); e == nil {
+		t.Error("cipher suite 0 must not be selected")
+	}
+}
+
+func TestParseCipherSuite(t *testing.T) {
+	suite, e := ParseCipherSuite("3")
+	if e != nil {
+		t.Error(e)
+		return
+	}
+	assertEquals(t, "suite", *suite, CipherSuite{ID: 3,
+		Authentication:  RAKPAlgorithmAuth_HMAC_SHA1,
+		Integrity:       RAKPAlgorithmIntegrity_HMAC_SHA1_96,
+		Confidentiality: RAKPAlgorithmEncryto_AES_CBC_128})
+
+	for _, s := range []string{"", "auto"} {
+		if suite, e := ParseCipherSuite(s); e != nil || suite != nil {
+			t.Error(s, suite, e)
+		}
+	}
+	for _, s := range []string{"20", "abc", "-1"} {
+		if _, e := ParseCipherSuite(s); e == nil {
+			t.Error(s, "must be unsupported")
+		}
+	}
+}
@@ -1,28 +1,63 @@
 package protocol
 
 import (
+	"context"
 	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/runner-mei/goipmi/protocol/commands"
 )
 
 type transport interface {
-	open() error
+	open(context.Context) error
+	openSession(context.Context) error
 	close() error
 	isConnected() bool
-	send(interface{}, interface{}) error
+	send(context.Context, interface{}, interface{}) error
 }
 
 // Client provides common high level functionality around the underlying transport
 type Client struct {
 	*ConnectionOption
 	transport
+
+	iface string
+
+	// mu is held for reading by the requests and for writing while the
+	// session is re-established, generation counts the sessions so that a
+	// session invalidated by several requests is re-established once.
+	mu         sync.RWMutex
+	generation uint64
+
+	stopKeepAlive func()
+	keepAliveDone chan struct{}
+
+	// bridgeSeq is the rqSeq of the bridged requests.
+	bridgeSeq uint32
 }
 
 // NewClient creates a new Client with the given Connection properties
 func NewClient(c *ConnectionOption) (*Client, error) {
-	var t transport
-	switch c.Interface {
+	if c.Interface == "auto" {
+		// the transport is selected by OpenContext
+		return &Client{ConnectionOption: c}, nil
+	}
+
+	t, err := newTransport(c, c.Interface)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{
+		ConnectionOption: c,
+		transport:        t,
+		iface:            c.Interface,
+	}, nil
+}
+
+func newTransport(c *ConnectionOption, iface string) (transport, error) {
+	switch iface {
 	case "lan":
 		if c.IntegrityAlgorithm != RAKPAlgorithmIntegrity_None {
 			return nil, fmt.Errorf("unsupported integrity algorithm for lan: %s", c.IntegrityAlgorithm.String())
@@ -32,50 +67,267 @@ func NewClient(c *ConnectionOption) (*Client, error) {
 			return nil, fmt.Errorf("unsupported confidentiality algorithm for lan: %s", c.ConfidentialityAlgorithm.String())
 		}
 
-		t = newLan(c)
+		return newLan(c), nil
 	case "lanplus":
-		if c.ConfidentialityAlgorithm != RAKPAlgorithmEncryto_None &&
-			c.ConfidentialityAlgorithm != RAKPAlgorithmEncryto_AES_CBC_128 {
-			return nil, fmt.Errorf("unsupported confidentiality algorithm: %s", c.ConfidentialityAlgorithm.String())
+		confidentialityAlgorithm := c.ConfidentialityAlgorithm
+		suite, err := ParseCipherSuite(c.CipherSuite)
+		if err != nil {
+			return nil, err
 		}
-		t = newLanPlus(c)
+		if suite != nil {
+			confidentialityAlgorithm = suite.Confidentiality
+		}
+
+		if confidentialityAlgorithm > RAKPAlgorithmEncryto_XRC4_40 {
+			return nil, fmt.Errorf("unsupported confidentiality algorithm: %s", confidentialityAlgorithm.String())
+		}
+		if _, err := ParseBMCKey(c.BMCKey); err != nil {
+			return nil, err
+		}
+		return newLanPlus(c), nil
+	case "open":
+		return newOpenIPMI(c), nil
 	default:
-		return nil, fmt.Errorf("unsupported interface: %s", c.Interface)
+		return nil, fmt.Errorf("unsupported interface: %s", iface)
 	}
+}
 
-	return &Client{
-		ConnectionOption: c,
-		transport:        t,
-	}, nil
+// negotiateInterface asks the BMC for its authentication capabilities with
+// the IPMI v2.0 extended data bit set, it returns "lanplus" if the BMC offers
+// RMCP+ and "lan" otherwise.
+func negotiateInterface(ctx context.Context, c *ConnectionOption) (string, error) {
+	l := newLan(c)
+	if err := l.dial(ctx); err != nil {
+		return "", err
+	}
+	defer l.disconnect()
+
+	var req Request
+	var resp Response
+	var reqData = AuthCapabilitiesRequest{
+		ChannelNumber: 0x8e, // lanChannelE + Version compatibility: IPMI v2.0+ extended data (1)
+		PrivLevel:     uint8(c.PrivLevel),
+	}
+	var respData AuthCapabilitiesResponse
+	if reqData.PrivLevel == uint8(commands.PrivLevelNone) {
+		reqData.PrivLevel = uint8(commands.PrivLevelAdmin)
+	}
+
+	req.Init(commands.GetChannelAuthenticationCapabilities, &reqData)
+	resp.Init(commands.GetChannelAuthenticationCapabilities, &respData)
+	if err := l.sendExt(ctx, &req, &resp); err != nil {
+		// IPMI v1.5 BMCs may reject the extended data bit
+		if resp.CompletionCode != CommandCompleted {
+			return "lan", nil
+		}
+		return "", err
+	}
+	if resp.CompletionCode != CommandCompleted {
+		return "lan", nil
+	}
+
+	if (respData.Reserved & (1 << 1)) != 0 { // is IPMI v2
+		return "lanplus", nil
+	}
+	return "lan", nil
+}
+
+// ActiveInterface returns the interface of the session, it is "lan" or "lanplus"
+// once the "auto" interface has been negotiated by Open.
+func (c *Client) ActiveInterface() string {
+	return c.iface
 }
 
 // Open a new IPMI session
 func (c *Client) IsConnected() bool {
-	// TODO: auto-select transport based on BMC capabilities
+	if c.transport == nil {
+		return false
+	}
 	return c.isConnected()
 }
 
 // Open a new IPMI session
 func (c *Client) Open() error {
-	// TODO: auto-select transport based on BMC capabilities
-	return c.open()
+	return c.OpenContext(context.Background())
+}
+
+// OpenContext open a new IPMI session, the ctx bounds the whole session
+// establishment.
+func (c *Client) OpenContext(ctx context.Context) error {
+	if c.transport == nil {
+		iface, err := negotiateInterface(ctx, c.ConnectionOption)
+		if err != nil {
+			return err
+		}
+		t, err := newTransport(c.ConnectionOption, iface)
+		if err != nil {
+			return err
+		}
+		c.transport = t
+		c.iface = iface
+	}
+	if err := c.open(ctx); err != nil {
+		return err
+	}
+
+	c.stopKeepAliveLoop()
+	if c.KeepAlive > 0 {
+		ctx, cancel := context.WithCancel(context.Background())
+		c.stopKeepAlive = cancel
+		c.keepAliveDone = make(chan struct{})
+		go c.keepAlive(ctx, c.KeepAlive, c.keepAliveDone)
+	}
+	return nil
 }
 
 // Close the IPMI session
 func (c *Client) Close() error {
+	if c.transport == nil {
+		return nil
+	}
+	c.stopKeepAliveLoop()
 	return c.close()
 }
 
+// stopKeepAliveLoop stops the keepalive of the session if it is running.
+func (c *Client) stopKeepAliveLoop() {
+	if c.stopKeepAlive != nil {
+		c.stopKeepAlive()
+		<-c.keepAliveDone
+		c.stopKeepAlive = nil
+	}
+}
+
+// getSessionInfoResponse discards the response data of Get Session Info, it
+// is only sent to keep the session alive.
+type getSessionInfoResponse struct{}
+
+func (self *getSessionInfoResponse) ReadBytes(r *Reader) {
+	r.ReadBytes(r.Len())
+}
+
+// keepAlive sends Get Session Info for the current session every interval
+// until ctx is done, the session is re-established if it is lost.
+func (c *Client) keepAlive(ctx context.Context, interval time.Duration, done chan struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		c.mu.RLock()
+		generation := c.generation
+		err := c.getSessionInfo(ctx)
+		c.mu.RUnlock()
+
+		if ctx.Err() != nil {
+			return
+		}
+		if c.Reconnect && isSessionInvalid(err) {
+			c.reconnect(ctx, generation, err, false)
+		}
+	}
+}
+
+// getSessionInfo sends Get Session Info for the current session.
+func (c *Client) getSessionInfo(ctx context.Context) error {
+	req := NewRequest(commands.GetSessionInfo, []byte{0}) // the current session
+	resp := NewResponse(commands.GetSessionInfo, &getSessionInfoResponse{})
+	if err := c.send(ctx, req, resp); err != nil {
+		return err
+	}
+	if resp.CompletionCode != CommandCompleted {
+		return resp.CompletionCode
+	}
+	return nil
+}
+
+// isSessionInvalid reports whether the error of a request may show that the
+// session is timed out by the BMC or lost by a BMC reboot, 0xD4 and 0xD5 are
+// returned by some BMCs for the requests of a closed session.
+func isSessionInvalid(err error) bool {
+	return err == ErrSessionID || err == ErrTimeout || err == ErrPrivLevel || err == ErrInvalidState
+}
+
+// reconnect re-establishes the session unless it has been re-established
+// since the request of the given generation was sent, it returns true if the
+// session is new. If verify is true the session is checked by Get Session
+// Info first and kept if it is alive.
+func (c *Client) reconnect(ctx context.Context, generation uint64, cause error, verify bool) (bool, error) {
+	c.mu.Lock()
+	if c.generation != generation {
+		c.mu.Unlock()
+		return true, nil
+	}
+	if verify && !isSessionInvalid(c.getSessionInfo(ctx)) {
+		c.mu.Unlock()
+		return false, nil
+	}
+	err := c.openSession(ctx)
+	if err == nil {
+		c.generation++
+	}
+	c.mu.Unlock()
+
+	if c.OnReconnect != nil {
+		c.OnReconnect(cause, err)
+	}
+	return err == nil, err
+}
+
 // Send a Request and unmarshal to given Response type
 func (c *Client) Send(req *Request, resp *Response) error {
-	// TODO: handle retry, timeouts, etc.
-	return c.send(req, resp)
+	return c.SendContext(context.Background(), req, resp)
+}
+
+// SendContext is like Send but returns when the ctx is done. The request is
+// retransmitted according to the Timeout, Retries and Backoff options. If the
+// Reconnect option is set and the session is lost, the session is
+// re-established and the request is replayed once, or the error of the
+// request is returned if the NoReplay option is set.
+func (c *Client) SendContext(ctx context.Context, req *Request, resp *Response) error {
+	if c.transport == nil {
+		return ErrNotOpen
+	}
+
+	c.mu.RLock()
+	generation := c.generation
+	err := c.send(ctx, req, resp)
+	c.mu.RUnlock()
+
+	cause := err
+	if err == nil && resp.CompletionCode != CommandCompleted {
+		cause = resp.CompletionCode
+	}
+	if !c.Reconnect || !isSessionInvalid(cause) {
+		return err
+	}
+	reconnected, rerr := c.reconnect(ctx, generation, cause, true)
+	if !reconnected || rerr != nil || c.NoReplay {
+		return err
+	}
+
+	c.mu.RLock()
+	err = c.send(ctx, req, resp)
+	c.mu.RUnlock()
+	return err
 }
 
 func (c *Client) Exec(cmd commands.CommandCode, req, resp interface{}) error {
+	return c.ExecContext(context.Background(), cmd, req, resp)
+}
+
+// ExecContext is like Exec but returns when the ctx is done.
+func (c *Client) ExecContext(ctx context.Context, cmd commands.CommandCode, req, resp interface{}) error {
 	request := NewRequest(cmd, req)
 	response := NewResponse(cmd, resp)
-	if err := c.Send(request, response); err != nil {
+	if err := c.SendContext(ctx, request, response); err != nil {
 		return err
 	}
 	if response.Code() != CommandCompleted {
@@ -84,6 +336,35 @@ func (c *Client) Exec(cmd commands.CommandCode, req, resp interface{}) error {
 	return nil
 }
 
+func (c *Client) ExecTarget(target Target, cmd commands.CommandCode, req, resp interface{}) error {
+	return c.ExecTargetContext(context.Background(), target, cmd, req, resp)
+}
+
+// ExecTargetContext is like ExecContext but the request is sent to the
+// controller at target, it is bridged by Send Message unless the target is
+// the BMC.
+func (c *Client) ExecTargetContext(ctx context.Context, target Target, cmd commands.CommandCode, req, resp interface{}) error {
+	if target.IsBMC() {
+		request := NewRequest(cmd, req)
+		request.Body.NetFnRsLUN |= target.LUN & 0x03
+		response := NewResponse(cmd, resp)
+		if err := c.SendContext(ctx, request, response); err != nil {
+			return err
+		}
+		if response.Code() != CommandCompleted {
+			return response.Code()
+		}
+		return nil
+	}
+
+	rqSeq := uint8(atomic.AddUint32(&c.bridgeSeq, 1)%64) << 2
+	request, responses := bridgeRequest(target, cmd, req, resp, rqSeq)
+	if err := c.SendContext(ctx, request, responses[0]); err != nil {
+		return err
+	}
+	return bridgedResult(responses)
+}
+
 // // DeviceID get the Device ID of the BMC
 // func (c *Client) DeviceID() (*goipmi.DeviceIDResponse, error) {
 // 	req := NewRequest(goipmi.GetDeviceID, &goipmi.DeviceIDRequest{})
@@ -18,6 +18,8 @@ const (
 
 var ErrTimeout = errors.New("timeout")
 var ErrIPMIVersion = errors.New("ipmi version is unsupported.")
+var ErrNotOpen = errors.New("session isn't opened.")
+var ErrSessionID = errors.New("session ID of the response is mismatched.")
 
 const IPMIBodySize = 6
 
@@ -183,6 +185,11 @@ func (self *Response) ReadBytes(r *Reader) {
 	if self.Data == nil {
 		return
 	}
+	if self.CompletionCode != CommandCompleted && r.Len() <= 1 {
+		// most of the error responses carry no data
+		r.ReadByte() // read checKsum
+		return
+	}
 
 	if rb, ok := self.Data.(Readable); ok {
 		rb.ReadBytes(r.Fork(r.Len() - 1))
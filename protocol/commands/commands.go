@@ -83,6 +83,7 @@ var (
 	// Activate Session                         App  3Ah
 	// Set Session Privilege Level              App  3Bh
 	// Close Session                            App  3Ch
+	// Get Channel Cipher Suites                App  54h
 	// reserved / unspecified  0
 	// Close Channel 1
 	// Close Channel 2
@@ -95,10 +96,14 @@ var (
 	// Close Channel 9
 	// Close Channel Ah
 	// Close Channel Bh
+	SendMessage                          = CommandCode{Name: "Send Message", NetworkFunction: NetworkFunctionApp, Code: 0x34, PrivilegeLevel: PrivLevelUser} // Administator for some channels
 	GetChannelAuthenticationCapabilities = CommandCode{Name: "Get Channel Authentication Capabilities", NetworkFunction: NetworkFunctionApp, Code: 0x38, PrivilegeLevel: PrivLevelUnprotected}
 	GetSessionChallenge                  = CommandCode{Name: "Get Session Challenge", NetworkFunction: NetworkFunctionApp, Code: 0x39, PrivilegeLevel: PrivLevelUnprotected}
 	ActivateSession                      = CommandCode{Name: "Activate Session", NetworkFunction: NetworkFunctionApp, Code: 0x3A, PrivilegeLevel: PrivLevelUnprotected}
 	SetSessionPrivilegeLevel             = CommandCode{Name: "Set Session Privilege Level", NetworkFunction: NetworkFunctionApp, Code: 0x3B, PrivilegeLevel: PrivLevelUser}
 	CloseSession                         = CommandCode{Name: "Close Session", NetworkFunction: NetworkFunctionApp, Code: 0x3C, PrivilegeLevel: PrivLevelCallback}
 	GetSessionInfo                       = CommandCode{Name: "Get Session Info", NetworkFunction: NetworkFunctionApp, Code: 0x3D, PrivilegeLevel: PrivLevelUser}
+	ActivatePayload                      = CommandCode{Name: "Activate Payload", NetworkFunction: NetworkFunctionApp, Code: 0x48}   // Depends on payload type.
+	DeactivatePayload                    = CommandCode{Name: "Deactivate Payload", NetworkFunction: NetworkFunctionApp, Code: 0x49} // Depends on payload type.
+	GetChannelCipherSuites               = CommandCode{Name: "Get Channel Cipher Suites", NetworkFunction: NetworkFunctionApp, Code: 0x54, PrivilegeLevel: PrivLevelUnprotected}
 )
@@ -5,13 +5,15 @@ import (
 	"crypto/cipher"
 	"crypto/hmac"
 	"crypto/md5"
+	"crypto/rc4"
 	"crypto/sha1"
 	"crypto/sha256"
+	"encoding/binary"
 	"errors"
-	"fmt"
 	"hash"
 	"strconv"
 	"strings"
+	"sync"
 )
 
 type RAKPAlgorithmAuthMethod uint8
@@ -266,39 +268,26 @@ var RAKPAlgorithmConfidentialityEncryptMethods = []func(key []byte) func(in, out
 			}
 			in = append(in, byte(padLen))
 
-			fmt.Println(len(out), (16 + len(in)))
 			if len(out) != (16 + len(in)) {
 				for i := len(out); i <= (16 + len(in)); i++ {
-					fmt.Println("=====", i, len(out), (16 + len(in)))
 					out = append(out, byte(0))
 				}
-				fmt.Println(len(out), (16 + len(in)))
 			}
 
 			iv := makeInitializationVector(out[:16])
 
-			fmt.Println("key = ", fmt.Sprintf("%x", key))
-			fmt.Println("iv  = ", fmt.Sprintf("%x", iv))
-			fmt.Println("in  = ", fmt.Sprintf("%x", in))
 			aes := cipher.NewCBCEncrypter(block, iv)
 			aes.CryptBlocks(out[16:], in)
-			fmt.Println("out = ", fmt.Sprintf("%x", out[16:16+len(in)]))
 			return out[:16+len(in)], nil
 		}
 	},
 
 	func(key []byte) func(in, out []byte) ([]byte, error) {
-		return func(in, out []byte) ([]byte, error) {
-			copy(out, in)
-			return out[:len(in)], nil
-		}
+		return newXRC4Stream(key, 16).encrypt
 	},
 
 	func(key []byte) func(in, out []byte) ([]byte, error) {
-		return func(in, out []byte) ([]byte, error) {
-			copy(out, in)
-			return out[:len(in)], nil
-		}
+		return newXRC4Stream(key, 5).encrypt
 	},
 }
 
@@ -318,28 +307,18 @@ var RAKPAlgorithmConfidentialityDecryptMethods = []func(key []byte) func(in, out
 			}
 
 			iv := in[:16]
-			fmt.Println("key = ", fmt.Sprintf("%x", key))
-			fmt.Println("iv  = ", fmt.Sprintf("%x", iv))
-			fmt.Println("in  = ", fmt.Sprintf("%x", in[16:]))
 			aes := cipher.NewCBCDecrypter(block, iv)
 			aes.CryptBlocks(out[:len(in)-16], in[16:])
-			fmt.Println("out = ", fmt.Sprintf("%x", out[:len(in)-16]))
 			return out[:len(in)-16], nil
 		}
 	},
 
 	func(key []byte) func(in, out []byte) ([]byte, error) {
-		return func(in, out []byte) ([]byte, error) {
-			copy(out, in)
-			return out[:len(in)], nil
-		}
+		return newXRC4Stream(key, 16).decrypt
 	},
 
 	func(key []byte) func(in, out []byte) ([]byte, error) {
-		return func(in, out []byte) ([]byte, error) {
-			copy(out, in)
-			return out[:len(in)], nil
-		}
+		return newXRC4Stream(key, 5).decrypt
 	},
 }
 
@@ -351,6 +330,116 @@ func (self RAKPAlgorithmConfidentialityMethod) Decrypt(key []byte) func(in, out
 	return RAKPAlgorithmConfidentialityDecryptMethods[self](key)
 }
 
+// xrc4Stream is a xRC4 keystream per section 13.30. The confidentiality
+// header is a 4 bytes data offset followed by a 16 bytes initialization
+// vector, the vector is only present when a new keystream is started (the
+// data offset is 0). Consecutive packets continue the keystream, the key of
+// a keystream is MD5(K2[:16] + IV), truncated to 40 bits for xRC4-40.
+type xrc4Stream struct {
+	mu     sync.Mutex
+	k2     []byte
+	keyLen int
+	iv     [16]byte
+	cipher *rc4.Cipher
+	offset uint32
+}
+
+func newXRC4Stream(k2 []byte, keyLen int) *xrc4Stream {
+	return &xrc4Stream{k2: k2, keyLen: keyLen}
+}
+
+func (self *xrc4Stream) reset(iv []byte) error {
+	if len(self.k2) < 16 {
+		return errors.New("xRC4 key is too short(" + strconv.Itoa(len(self.k2)) + ")")
+	}
+
+	copy(self.iv[:], iv)
+	h := md5.New()
+	h.Write(self.k2[:16])
+	h.Write(self.iv[:])
+	c, err := rc4.NewCipher(h.Sum(nil)[:self.keyLen])
+	if err != nil {
+		return err
+	}
+	self.cipher = c
+	self.offset = 0
+	return nil
+}
+
+// seek moves the keystream to the offset, a smaller offset restarts the
+// keystream since RC4 can't go backwards.
+func (self *xrc4Stream) seek(offset uint32) error {
+	if offset < self.offset {
+		if err := self.reset(self.iv[:]); err != nil {
+			return err
+		}
+	}
+	skip := make([]byte, offset-self.offset)
+	self.cipher.XORKeyStream(skip, skip)
+	self.offset = offset
+	return nil
+}
+
+func (self *xrc4Stream) encrypt(in, out []byte) ([]byte, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if self.cipher == nil || uint64(self.offset)+uint64(len(in)) > 0xffffffff {
+		var iv [16]byte
+		if err := self.reset(makeInitializationVector(iv[:])); err != nil {
+			return nil, err
+		}
+	}
+
+	headerLen := 4
+	if self.offset == 0 {
+		headerLen += len(self.iv)
+	}
+	if len(out) < headerLen+len(in) {
+		out = make([]byte, headerLen+len(in))
+	}
+
+	binary.LittleEndian.PutUint32(out, self.offset)
+	if self.offset == 0 {
+		copy(out[4:], self.iv[:])
+	}
+	self.cipher.XORKeyStream(out[headerLen:headerLen+len(in)], in)
+	self.offset += uint32(len(in))
+	return out[:headerLen+len(in)], nil
+}
+
+func (self *xrc4Stream) decrypt(in, out []byte) ([]byte, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if len(in) < 4 {
+		return nil, ErrInsufficientBytes
+	}
+	offset := binary.LittleEndian.Uint32(in)
+	in = in[4:]
+
+	if offset == 0 {
+		if len(in) < 16 {
+			return nil, ErrInsufficientBytes
+		}
+		if err := self.reset(in[:16]); err != nil {
+			return nil, err
+		}
+		in = in[16:]
+	} else if self.cipher == nil {
+		return nil, errors.New("xRC4 keystream isn't started")
+	} else if err := self.seek(offset); err != nil {
+		return nil, err
+	}
+
+	if len(out) < len(in) {
+		out = make([]byte, len(in))
+	}
+	self.cipher.XORKeyStream(out[:len(in)], in)
+	self.offset += uint32(len(in))
+	return out[:len(in)], nil
+}
+
 type AuthenticationPayload struct {
 	//PayloadType uint8
 	//Reserved1   uint16
@@ -0,0 +1,125 @@
+package protocol
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+var xrc4_k2 = []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a,
+	0x0b, 0x0c, 0x0d, 0x0e, 0x0f, 0x10, 0x11, 0x12, 0x13, 0x14}
+var xrc4_iv = []byte{0xa0, 0xa1, 0xa2, 0xa3, 0xa4, 0xa5, 0xa6, 0xa7,
+	0xa8, 0xa9, 0xaa, 0xab, 0xac, 0xad, 0xae, 0xaf}
+var xrc4_plaintexts = [][]byte{
+	{0x20, 0x18, 0xc8, 0x81, 0x04, 0x3b, 0x04, 0x3c},
+	{0x20, 0x28, 0xb8, 0x81, 0x08, 0x2d, 0x01, 0x49},
+}
+
+// xrc4Packets are the known answers of the plaintexts, they are encrypted by
+// an implementation of section 13.30 in Python (hashlib MD5 and its own RC4)
+// that shares no code with this package, since neither the specification
+// nor ipmitool gives xRC4 test vectors. Every packet is the data offset, the
+// initialization vector in the first packet and the ciphertext.
+var xrc4Packets = map[int][]string{
+	16: {"00000000a0a1a2a3a4a5a6a7a8a9aaabacadaeaf1e09b408784ca40c", "080000009da9865d267ef43b"},
+	5:  {"00000000a0a1a2a3a4a5a6a7a8a9aaabacadaeafea346261a8ff2cfa", "08000000df9a9277d12287c5"},
+}
+
+func decodeXRC4Packets(t *testing.T, keyLen int) [][]byte {
+	var packets [][]byte
+	for _, s := range xrc4Packets[keyLen] {
+		bs, e := hex.DecodeString(s)
+		if e != nil {
+			t.Fatal(e)
+		}
+		packets = append(packets, bs)
+	}
+	return packets
+}
+
+func TestXRC4(t *testing.T) {
+	for _, test := range []struct {
+		method    RAKPAlgorithmConfidentialityMethod
+		keyLen    int
+		encrypted [][]byte
+	}{
+		{method: RAKPAlgorithmEncryto_XRC4_128, keyLen: 16, encrypted: decodeXRC4Packets(t, 16)},
+		{method: RAKPAlgorithmEncryto_XRC4_40, keyLen: 5, encrypted: decodeXRC4Packets(t, 5)},
+	} {
+		t.Run(test.method.String(), func(t *testing.T) {
+			// the keystream is started with a known initialization vector
+			stream := newXRC4Stream(xrc4_k2, test.keyLen)
+			if e := stream.reset(xrc4_iv); e != nil {
+				t.Error(e)
+				return
+			}
+			for idx, plaintext := range xrc4_plaintexts {
+				encrypted, e := stream.encrypt(plaintext, make([]byte, 32+len(plaintext)))
+				if e != nil {
+					t.Error(e)
+					return
+				}
+				assertEquals(t, "encrypted", encrypted, test.encrypted[idx])
+			}
+
+			decrypt := test.method.Decrypt(xrc4_k2)
+			for idx, encrypted := range test.encrypted {
+				plaintext, e := decrypt(encrypted, make([]byte, len(encrypted)))
+				if e != nil {
+					t.Error(e)
+					return
+				}
+				assertEquals(t, "plaintext", plaintext, xrc4_plaintexts[idx])
+			}
+
+			// a retransmitted packet is decrypted again by restarting the keystream
+			plaintext, e := decrypt(test.encrypted[1], nil)
+			if e != nil {
+				t.Error(e)
+				return
+			}
+			assertEquals(t, "retransmitted", plaintext, xrc4_plaintexts[1])
+
+			// a lost packet is skipped by the data offset
+			decrypt = test.method.Decrypt(xrc4_k2)
+			if _, e := decrypt(test.encrypted[1], nil); e == nil {
+				t.Error("a keystream must be started by offset 0")
+			}
+			if _, e := decrypt(test.encrypted[0][:20], nil); e != nil {
+				t.Error(e)
+				return
+			}
+			plaintext, e = decrypt(test.encrypted[1], nil)
+			if e != nil {
+				t.Error(e)
+				return
+			}
+			assertEquals(t, "skipped", plaintext, xrc4_plaintexts[1])
+		})
+	}
+}
+
+func TestXRC4NewKeystream(t *testing.T) {
+	encrypt := RAKPAlgorithmEncryto_XRC4_128.Encrypt(xrc4_k2)
+	decrypt := RAKPAlgorithmEncryto_XRC4_128.Decrypt(xrc4_k2)
+
+	for idx, plaintext := range xrc4_plaintexts {
+		encrypted, e := encrypt(plaintext, nil)
+		if e != nil {
+			t.Error(e)
+			return
+		}
+		if idx == 0 {
+			// the first packet starts the keystream with its initialization vector
+			assertEquals(t, "len", len(encrypted), 4+16+len(plaintext))
+		} else {
+			assertEquals(t, "len", len(encrypted), 4+len(plaintext))
+		}
+
+		bs, e := decrypt(encrypted, nil)
+		if e != nil {
+			t.Error(e)
+			return
+		}
+		assertEquals(t, "plaintext", bs, plaintext)
+	}
+}
@@ -1,6 +1,9 @@
 package protocol
 
 import (
+	"context"
+	"crypto/hmac"
+	"encoding/binary"
 	"errors"
 	"log"
 	"strconv"
@@ -12,12 +15,20 @@ type lan struct {
 	lanBase
 
 	active bool
+	// perMsgAuth is false if the BMC disabled the per-message authentication,
+	// the messages after Activate Session are sent without AuthCode then.
+	perMsgAuth bool
 
 	PrivLevel uint8
 	AuthType  uint8
 	Authcode  [16]uint8
 	Username  [16]uint8
 	SessionID uint32
+
+	// outSeq is the highest session sequence number received from the BMC
+	// and outSeqSeen marks which of the 8 numbers before it are received.
+	outSeq     uint32
+	outSeqSeen uint8
 }
 
 func (l *lan) FromBytes(resp *Response, bs []byte) error {
@@ -38,22 +49,79 @@ func IPMIv1FromBytes(resp *Response, bs []byte) error {
 	return r.Err()
 }
 
+// IPMIv1MatchResponse returns a func that reports whether a IPMI v1.5 packet
+// is the response of req, only the message header is read so that late
+// responses of other commands are dropped without decoding their data.
+func IPMIv1MatchResponse(req *Request) func([]byte) bool {
+	return func(bs []byte) bool {
+		var rmcpHeader RMCPHeader
+		var ipmiHeader IPMIV1Header
+		var body IPMIBody
+
+		var r Reader
+		r.Init(bs)
+
+		rmcpHeader.ReadBytes(&r)
+		ipmiHeader.ReadBytes(&r)
+		msg := r.Bytes()
+		body.ReadBytes(&r)
+		if r.Err() != nil || rmcpHeader.Class != rmcpClassIPMI {
+			return false
+		}
+		if int(ipmiHeader.Length) < len(msg) {
+			msg = msg[:ipmiHeader.Length]
+		}
+		return matchResponseBody(&req.Body, &body) && !pendingBridgedResponse(req, msg)
+	}
+}
+
+func matchResponseBody(req, resp *IPMIBody) bool {
+	return resp.RqSeq == req.RqSeq &&
+		resp.Cmd == req.Cmd &&
+		resp.NetFnRsLUN>>2 == (req.NetFnRsLUN>>2)|1
+}
+
 func (l *lan) ToBytes(req *Request, bs []byte) ([]byte, error) {
-	if req.NetFn() == commands.NetworkFunctionApp && req.Body.Cmd == commands.GetChannelAuthenticationCapabilities.Code {
+	if req.NetFn() == commands.NetworkFunctionApp &&
+		(req.Body.Cmd == commands.GetChannelAuthenticationCapabilities.Code ||
+			req.Body.Cmd == commands.GetSessionChallenge.Code) {
 		return IPMIv1ToBytes(req, bs, 0, l.nextRqSequence())
 	}
-	return IPMIv1ToBytes(req, bs, l.nextSequence(), l.nextRqSequence())
+
+	l.mu.Lock()
+	authType, sessionID := l.AuthType, l.SessionID
+	active, perMsgAuth := l.active, l.perMsgAuth
+	l.mu.Unlock()
+
+	// Activate Session is sent with the temporary session ID and the
+	// sequence number 0, see section 22.17
+	var sequence uint32
+	if active {
+		sequence = l.nextSequence()
+		if !perMsgAuth {
+			authType = AuthTypeNone
+		}
+	}
+	return IPMIv1SessionToBytes(req, bs, authType, sessionID, sequence, l.nextRqSequence(), l.Authcode[:])
 }
 
 func IPMIv1ToBytes(req *Request, bs []byte, ipmiSeq uint32, rqSeq uint8) ([]byte, error) {
+	return IPMIv1SessionToBytes(req, bs, AuthTypeNone, 0, ipmiSeq, rqSeq, nil)
+}
+
+// IPMIv1SessionToBytes encodes req in a IPMI v1.5 session packet, the AuthCode
+// of the session header is calculated over the IPMI message with password
+// unless authType is AuthTypeNone.
+func IPMIv1SessionToBytes(req *Request, bs []byte, authType uint8, sessionID, ipmiSeq uint32, rqSeq uint8, password []byte) ([]byte, error) {
 	rmcpHeader := RMCPHeader{
 		Version:            rmcpVersion1,
 		Class:              rmcpClassIPMI,
 		RMCPSequenceNumber: 0xff,
 	}
 	ipmiHeader := IPMIV1Header{
-		Sequence: ipmiSeq,
-		//SessionID: l.SessionID, //l.SessionID,
+		AuthType:  authType,
+		Sequence:  ipmiSeq,
+		SessionID: sessionID,
 	}
 	req.Body.RqSeq = rqSeq
 
@@ -72,11 +140,87 @@ func IPMIv1ToBytes(req *Request, bs []byte, ipmiSeq uint32, rqSeq uint8) ([]byte
 	tmp := w.Bytes()
 	tmp[old_length-1] = uint8(w.Len() - old_length)
 
+	if authType != AuthTypeNone {
+		authCode, err := IPMIv1AuthCode(authType, password, sessionID, ipmiSeq, tmp[old_length:])
+		if err != nil {
+			return nil, err
+		}
+		copy(tmp[old_length-1-len(NullAuthCode):], authCode)
+	}
 	return tmp, nil
 }
 
-func (l *lan) open() error {
-	err := l.dial()
+// checkPacket drops the session packets whose AuthCode is invalid or whose
+// session sequence number is a duplicate or out of the window.
+func (l *lan) checkPacket(bs []byte) ([]byte, error) {
+	var rmcpHeader RMCPHeader
+	var ipmiHeader IPMIV1Header
+
+	var r Reader
+	r.Init(bs)
+
+	rmcpHeader.ReadBytes(&r)
+	if r.Err() != nil || rmcpHeader.Class != rmcpClassIPMI {
+		return bs, nil
+	}
+	ipmiHeader.ReadBytes(&r)
+	if r.Err() != nil {
+		return nil, r.Err()
+	}
+	if ipmiHeader.SessionID == 0 {
+		return bs, nil
+	}
+	if int(ipmiHeader.Length) > r.Len() {
+		return nil, ErrInsufficientBytes
+	}
+
+	if ipmiHeader.AuthType != AuthTypeNone {
+		authCode, err := IPMIv1AuthCode(ipmiHeader.AuthType, l.Authcode[:],
+			ipmiHeader.SessionID, ipmiHeader.Sequence, r.Bytes()[:ipmiHeader.Length])
+		if err != nil {
+			return nil, err
+		}
+		if !hmac.Equal(authCode, ipmiHeader.AuthCode) {
+			return nil, ErrInvalidAuthCode
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.active && ipmiHeader.SessionID == l.SessionID && ipmiHeader.Sequence != 0 &&
+		!l.acceptSequence(ipmiHeader.Sequence) {
+		return nil, ErrSequenceNumber
+	}
+	return bs, nil
+}
+
+// acceptSequence reports whether seq is a new outbound sequence number of the
+// BMC per section 6.12.13, the numbers ahead of the highest received number
+// are accepted and the 8 numbers behind it are accepted only once so that
+// replayed or duplicated packets are dropped. l.mu must be held.
+func (l *lan) acceptSequence(seq uint32) bool {
+	if diff := int32(seq - l.outSeq); diff > 0 {
+		if diff > 8 {
+			l.outSeqSeen = 0
+		} else {
+			l.outSeqSeen = l.outSeqSeen<<uint(diff) | 1<<uint(diff-1)
+		}
+		l.outSeq = seq
+		return true
+	} else if diff < 0 && diff >= -8 {
+		bit := uint8(1) << uint(-diff-1)
+		if l.outSeqSeen&bit != 0 {
+			return false
+		}
+		l.outSeqSeen |= bit
+		return true
+	}
+	return false
+}
+
+func (l *lan) open(ctx context.Context) error {
+	err := l.dial(ctx)
 	if err != nil {
 		return err
 	}
@@ -85,76 +229,115 @@ func (l *lan) open() error {
 	// l.priv = PrivLevelAdmin
 	// l.timeout = time.Second * 5
 	// l.lun = 0
-	return l.openSession()
+	return l.openSession(ctx)
 }
 
 func (l *lan) close() error {
 	if l.active {
-		err := l.closeSession()
+		err := l.closeSession(context.Background())
 		if err != nil {
 			log.Printf("error closing session: %s", err)
 		}
+		l.mu.Lock()
 		l.active = false
+		l.mu.Unlock()
 	}
 
 	l.disconnect()
 	return nil
 }
 
-func (l *lan) send(req, resp interface{}) error {
-	return l.sendExt(req.(*Request), resp.(*Response))
+func (l *lan) send(ctx context.Context, req, resp interface{}) error {
+	return l.sendExt(ctx, req.(*Request), resp.(*Response))
 }
 
-func (l *lan) sendExt(req *Request, resp *Response) error {
+func (l *lan) sendExt(ctx context.Context, req *Request, resp *Response) error {
+	release, err := l.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
 	bsReq, err := l.ToBytes(req, make([]byte, 0, 1024))
 	if nil != err {
 		return err
 	}
 
-	if err = l.sendPacket(bsReq); err != nil {
+	bsResp, err := l.exchange(ctx, bsReq, IPMIv1MatchResponse(req))
+	if err != nil {
 		return err
 	}
-
-	var bsResp []byte
-	if bsResp, err = l.recvPacket(); err != nil {
+	if err := l.checkSessionID(bsResp); err != nil {
 		return err
 	}
 
 	return l.FromBytes(resp, bsResp)
 }
 
-func (l *lan) exec(cmd commands.CommandCode, reqData, respData interface{}) error {
+// checkSessionID returns ErrSessionID if the response isn't in the active
+// session, e.g. the session is timed out or the BMC is rebooted.
+func (l *lan) checkSessionID(bs []byte) error {
+	var rmcpHeader RMCPHeader
+	var ipmiHeader IPMIV1Header
+
+	var r Reader
+	r.Init(bs)
+
+	rmcpHeader.ReadBytes(&r)
+	ipmiHeader.ReadBytes(&r)
+	if r.Err() != nil {
+		return r.Err()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.active && ipmiHeader.SessionID != l.SessionID {
+		return ErrSessionID
+	}
+	return nil
+}
+
+func (l *lan) exec(ctx context.Context, cmd commands.CommandCode, reqData, respData interface{}) error {
 	var req Request
 	var resp Response
 
 	req.Init(cmd, reqData)
 	resp.Init(cmd, respData)
 
-	return l.sendExt(&req, &resp)
+	err := l.sendExt(ctx, &req, &resp)
+	if resp.CompletionCode != CommandCompleted {
+		return resp.CompletionCode
+	}
+	return err
 }
 
-func (l *lan) openSession() error {
-	if err := l.ping(); err != nil {
+func (l *lan) openSession(ctx context.Context) error {
+	l.mu.Lock()
+	l.active = false
+	l.SessionID = 0
+	l.mu.Unlock()
+
+	if err := l.ping(ctx); err != nil {
 		return err
 	}
 
-	if err := l.getAuthCapabilities(false); err != nil {
+	if err := l.getAuthCapabilities(ctx, false); err != nil {
 		return err
 	}
 
-	res, err := l.getSessionChallenge()
+	res, err := l.getSessionChallenge(ctx)
 	if err != nil {
 		return err
 	}
 
-	if err := l.activateSession(res); err != nil {
+	if err := l.activateSession(ctx, res); err != nil {
 		return err
 	}
 
-	return l.setSessionPriv()
+	return l.setSessionPriv(ctx)
 }
 
-func (l *lan) getAuthCapabilities(isV2 bool) error {
+func (l *lan) getAuthCapabilities(ctx context.Context, isV2 bool) error {
 	var req AuthCapabilitiesRequest
 	var resp AuthCapabilitiesResponse
 
@@ -165,11 +348,13 @@ func (l *lan) getAuthCapabilities(isV2 bool) error {
 	}
 	req.PrivLevel = l.PrivLevel
 
-	if err := l.exec(commands.GetChannelAuthenticationCapabilities, &req, &resp); err != nil {
+	if err := l.exec(ctx, commands.GetChannelAuthenticationCapabilities, &req, &resp); err != nil {
 		return err
 	}
 
-	for _, t := range []uint8{AuthTypeMD5, AuthTypePassword} {
+	l.perMsgAuth = (resp.Status & (1 << 4)) == 0
+
+	for _, t := range []uint8{AuthTypeMD5, AuthTypeMD2, AuthTypePassword} {
 		if (resp.AuthTypeSupport & (1 << t)) != 0 {
 			l.AuthType = t
 			return nil
@@ -180,7 +365,7 @@ func (l *lan) getAuthCapabilities(isV2 bool) error {
 		return errors.New("IPMI version is unsupported v1.5")
 	}
 
-	if (resp.AuthTypeSupport & 0x7f) == AuthTypeNone {
+	if (resp.AuthTypeSupport & (1 << AuthTypeNone)) != 0 {
 		l.AuthType = AuthTypeNone
 		return nil
 	}
@@ -189,47 +374,57 @@ func (l *lan) getAuthCapabilities(isV2 bool) error {
 	return errors.New("BMC did not offer a supported AuthType(" + strconv.FormatInt(int64(resp.AuthTypeSupport), 10) + ")")
 }
 
-func (l *lan) getSessionChallenge() (*SessionChallengeResponse, error) {
+func (l *lan) getSessionChallenge(ctx context.Context) (*SessionChallengeResponse, error) {
 	var req SessionChallengeRequest
 	var resp SessionChallengeResponse
 
 	req.AuthType = l.AuthType
 	req.Username = l.Username
 
-	if err := l.exec(commands.GetSessionChallenge, req, resp); err != nil {
+	if err := l.exec(ctx, commands.GetSessionChallenge, &req, &resp); err != nil {
 		return nil, err
 	}
 
+	l.mu.Lock()
 	l.SessionID = resp.TemporarySessionID
+	l.mu.Unlock()
 	return &resp, nil
 }
 
-func (l *lan) activateSession(sc *SessionChallengeResponse) error {
+func (l *lan) activateSession(ctx context.Context, sc *SessionChallengeResponse) error {
 	req := &ActivateSessionRequest{
 		AuthType:  l.AuthType,
 		PrivLevel: l.PrivLevel,
-		AuthCode:  sc.Challenge,
-		InSeq:     l.inSeq(),
+		// the challenge is returned to the BMC in the request data, the
+		// session header carries the AuthCode calculated by ToBytes.
+		AuthCode: sc.Challenge,
+		InSeq:    l.inSeq(),
 	}
 	resp := &ActivateSessionResponse{}
 
-	if err := l.exec(commands.ActivateSession, req, resp); err != nil {
+	if err := l.exec(ctx, commands.ActivateSession, req, resp); err != nil {
 		return err
 	}
 
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
 	l.active = true
 	l.SessionID = resp.SessionID
-	l.AuthType = resp.AuthType
-	l.sequence = resp.InboundSeq
+	l.AuthType = resp.AuthType & 0x0f
+	// nextSequence returns the initial inbound sequence number first
+	l.sequence = resp.InboundSeq - 1
+	l.outSeq = binary.LittleEndian.Uint32(req.InSeq[:]) - 1
+	l.outSeqSeen = 0xff
 	return nil
 }
 
-func (l *lan) setSessionPriv() error {
+func (l *lan) setSessionPriv(ctx context.Context) error {
 	var req SessionPrivilegeLevelRequest
 	var resp SessionPrivilegeLevelResponse
 	req.PrivLevel = l.PrivLevel
 
-	if err := l.exec(commands.SetSessionPrivilegeLevel, req, resp); err != nil {
+	if err := l.exec(ctx, commands.SetSessionPrivilegeLevel, &req, &resp); err != nil {
 		return err
 	}
 
@@ -237,11 +432,11 @@ func (l *lan) setSessionPriv() error {
 	return nil
 }
 
-func (l *lan) closeSession() error {
+func (l *lan) closeSession(ctx context.Context) error {
 	var req CloseSessionRequest
 	var resp CloseSessionResponse
 	req.SessionID = l.SessionID
-	return l.exec(commands.SetSessionPrivilegeLevel, req, resp)
+	return l.exec(ctx, commands.CloseSession, &req, &resp)
 }
 
 func newLan(opt *ConnectionOption) *lan {
@@ -249,5 +444,12 @@ func newLan(opt *ConnectionOption) *lan {
 
 	copy(l.Username[:], opt.Username[:])
 	copy(l.Authcode[:], opt.Password[:])
+	l.filter = l.checkPacket
+
+	if opt.PrivLevel == commands.PrivLevelNone {
+		l.PrivLevel = uint8(commands.PrivLevelAdmin)
+	} else {
+		l.PrivLevel = uint8(opt.PrivLevel)
+	}
 	return l
 }
@@ -1,11 +1,14 @@
 package protocol
 
 import (
+	"context"
 	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"net"
-	"strconv"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -24,22 +27,134 @@ type ConnectionOption struct {
 	AuthenticationAlgorithm  RAKPAlgorithmAuthMethod
 	IntegrityAlgorithm       RAKPAlgorithmIntegrityMethod
 	ConfidentialityAlgorithm RAKPAlgorithmConfidentialityMethod
+	// CipherSuite is a ipmitool style cipher suite ID (3, 17, ...) that
+	// overrides the three algorithms above, "auto" selects the strongest
+	// cipher suite supported by both the BMC and lanplus.
+	CipherSuite string
+	// BMCKey is the BMC key (Kg) used to generate the session integrity key
+	// of lanplus, it is raw bytes or hex prefixed with "0x". The password is
+	// used if it is empty.
+	BMCKey string
+	// PrivilegeLookup makes lanplus request username/privilege lookup instead
+	// of name-only lookup in the RAKP messages.
+	PrivilegeLookup bool
+	// PreferIPv6 connects over IPv6 when the Hostname resolves to both IPv4
+	// and IPv6 addresses, IPv4 is preferred by default.
+	PreferIPv6 bool
+	// Device is the OpenIPMI character device of the "open" interface,
+	// /dev/ipmi0, /dev/ipmi/0 and /dev/ipmidev/0 are tried by default.
+	Device string
+
+	// Timeout is how long to wait for a response before the request is
+	// retransmitted, the default is 10 seconds.
+	Timeout time.Duration
+	// Retries is how many times a request is retransmitted after a timeout,
+	// the default is 2 so that a request is sent up to 3 times, a negative
+	// value disables the retransmission.
+	Retries int
+	// Backoff multiplies the timeout after every retransmission, a value
+	// less than or equal to 1 keeps the timeout constant.
+	Backoff float64
+	// MaxTimeout caps the timeout grown by Backoff, zero means no cap.
+	MaxTimeout time.Duration
+	// Window is how many requests may be outstanding on the session at the
+	// same time, the default is 1 and it is limited to 63 by the rqSeq size.
+	Window int
+
+	// KeepAlive is the interval of the Get Session Info command sent to keep
+	// the session from the idle timeout of the BMC, zero disables it.
+	KeepAlive time.Duration
+	// Reconnect re-establishes the session when a request times out, its
+	// response is of another session or its completion code is 0xD4 or 0xD5
+	// and Get Session Info shows that the session is lost, or when the
+	// keepalive shows it. The failed request is replayed once in the new
+	// session unless NoReplay is set.
+	Reconnect bool
+	// NoReplay returns the error of the failed request after the session is
+	// re-established instead of replaying it, for the commands that aren't
+	// idempotent.
+	NoReplay bool
+	// OnReconnect is called after the session is re-established, cause is
+	// the error that showed the session is invalid and err is the result.
+	OnReconnect func(cause, err error)
+}
+
+// ParseBMCKey parses the BMCKey option, a value prefixed with "0x" is hex
+// encoded, otherwise it is used as raw bytes.
+func ParseBMCKey(s string) ([]byte, error) {
+	var key = []byte(s)
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+		bs, err := hex.DecodeString(s[2:])
+		if err != nil {
+			return nil, errors.New("BMC key is invalid hex, " + err.Error())
+		}
+		key = bs
+	}
+	if len(key) > 20 {
+		return nil, errors.New("BMC key is longer than 20 bytes")
+	}
+	return key, nil
+}
+
+func (c *ConnectionOption) attemptTimeout() time.Duration {
+	if c.Timeout <= 0 {
+		return 10 * time.Second
+	}
+	return c.Timeout
+}
+
+func (c *ConnectionOption) retries() int {
+	if c.Retries == 0 {
+		return 2
+	}
+	if c.Retries < 0 {
+		return 0
+	}
+	return c.Retries
+}
+
+func (c *ConnectionOption) nextTimeout(timeout time.Duration) time.Duration {
+	if c.Backoff <= 1 {
+		return timeout
+	}
+	timeout = time.Duration(float64(timeout) * c.Backoff)
+	if c.MaxTimeout > 0 && timeout > c.MaxTimeout {
+		timeout = c.MaxTimeout
+	}
+	return timeout
+}
+
+// WindowSize returns how many requests may be outstanding on the session,
+// it is the Window option limited to 1..63.
+func (c *ConnectionOption) WindowSize() int {
+	if c.Window <= 0 {
+		return 1
+	}
+	if c.Window > maxWindow {
+		return maxWindow
+	}
+	return c.Window
 }
 
 // RemoteIP returns the remote (bmc) IP address of the Connection
 func (c *ConnectionOption) RemoteIP() string {
-	if net.ParseIP(c.Hostname) == nil {
-		addrs, err := net.LookupHost(c.Hostname)
-		if err != nil && len(addrs) > 0 {
-			return addrs[0]
-		}
+	addr, err := c.resolveUDPAddr(context.Background())
+	if err != nil {
+		return c.Hostname
+	}
+	if addr.Zone != "" {
+		return addr.IP.String() + "%" + addr.Zone
 	}
-	return c.Hostname
+	return addr.IP.String()
 }
 
 // LocalIP returns the local (client) IP address of the Connection
 func (c *ConnectionOption) LocalIP() string {
-	conn, err := net.Dial("udp", fmt.Sprintf("%s:%d", c.Hostname, c.Port))
+	addr, err := c.resolveUDPAddr(context.Background())
+	if err != nil {
+		return c.Hostname
+	}
+	conn, err := net.DialUDP("udp", nil, addr)
 	if err != nil {
 		// don't bother returning an error, since this value will never
 		// make it to the bmc if we can't connect to it.
@@ -50,17 +165,89 @@ func (c *ConnectionOption) LocalIP() string {
 	return host
 }
 
+// resolveUDPAddr resolves the address of the BMC, the Hostname is an IPv4 or
+// IPv6 literal (optionally in brackets and with a zone ID) or a hostname,
+// the IPv4 or IPv6 address of the hostname is picked by PreferIPv6.
+func (c *ConnectionOption) resolveUDPAddr(ctx context.Context) (*net.UDPAddr, error) {
+	host := c.Hostname
+	if strings.HasPrefix(host, "[") && strings.HasSuffix(host, "]") {
+		host = host[1 : len(host)-1]
+	}
+
+	ip := host
+	zone := ""
+	if idx := strings.LastIndexByte(host, '%'); idx >= 0 {
+		ip, zone = host[:idx], host[idx+1:]
+	}
+	if addr := net.ParseIP(ip); addr != nil {
+		return &net.UDPAddr{IP: addr, Port: c.Port, Zone: zone}, nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	addr, ok := pickIPAddr(addrs, c.PreferIPv6)
+	if !ok {
+		return nil, errors.New("no address found for " + host)
+	}
+	return &net.UDPAddr{IP: addr.IP, Port: c.Port, Zone: addr.Zone}, nil
+}
+
+// pickIPAddr returns the first address of the preferred family, or the first
+// address if there is no such address.
+func pickIPAddr(addrs []net.IPAddr, preferIPv6 bool) (net.IPAddr, bool) {
+	if len(addrs) == 0 {
+		return net.IPAddr{}, false
+	}
+	for _, addr := range addrs {
+		if isIPv6 := addr.IP.To4() == nil; isIPv6 == preferIPv6 {
+			return addr, true
+		}
+	}
+	return addrs[0], true
+}
+
+// maxWindow is the number of the distinct rqSeq values.
+const maxWindow = 63
+
 type lanBase struct {
 	conn_opt *ConnectionOption
-	conn     *net.UDPConn
 	//addr     net.Addr
 
+	// mu guards conn, window and done too, they are replaced by dial and
+	// disconnect while the requests are sent.
+	mu        sync.Mutex
+	conn      *net.UDPConn
 	sequence  uint32
 	rqSeqence uint8
+	window    chan struct{}
+	waiters   []*waiter
+	done      chan struct{}
+	readErr   error
+
+	// filter is applied to every received packet before it is dispatched,
+	// the packet is dropped if it returns an error.
+	filter func([]byte) ([]byte, error)
+}
+
+// waiter is a caller waiting for the response accepted by match.
+type waiter struct {
+	match func([]byte) bool
+	c     chan []byte
 }
 
 func (l *lanBase) isConnected() bool {
-	return l.conn != nil
+	conn, _, _ := l.connection()
+	return conn != nil
+}
+
+// connection returns the connection, the window and the done channel of the
+// read loop, conn is nil if it isn't connected.
+func (l *lanBase) connection() (conn *net.UDPConn, window, done chan struct{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.conn, l.window, l.done
 }
 
 func (l *lanBase) inSeq() [4]uint8 {
@@ -68,47 +255,91 @@ func (l *lanBase) inSeq() [4]uint8 {
 	if _, err := rand.Read(seq[:]); err != nil {
 		panic(err)
 	}
+	if seq == [4]uint8{} {
+		seq[0] = 1 // 0 is reserved for the messages outside of a session
+	}
 	return seq
 }
 
 func (l *lanBase) nextSequence() uint32 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
 	l.sequence++
+	if l.sequence == 0 {
+		l.sequence++ // 0 is reserved for the messages outside of a session
+	}
 	return l.sequence
 }
 
 func (l *lanBase) nextRqSequence() uint8 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
 	l.rqSeqence++
 	return l.rqSeqence << 2
 }
 
-func (l *lanBase) dial() error {
-	addr, err := net.ResolveUDPAddr("udp4",
-		net.JoinHostPort(l.conn_opt.Hostname, strconv.Itoa(l.conn_opt.Port)))
+func (l *lanBase) dial(ctx context.Context) error {
+	addr, err := l.conn_opt.resolveUDPAddr(ctx)
 	if err != nil {
 		return err
 	}
 	//l.addr = addr
 
-	conn, err := net.DialUDP("udp4",
-		nil, //net.JoinHostPort(l.conn_opt.Hostname, strconv.Itoa(l.conn_opt.Port)),
-		addr)
+	conn, err := net.DialUDP("udp", nil, addr)
 	if err != nil {
 		return err
 	}
+
+	size := l.conn_opt.WindowSize()
+	done := make(chan struct{})
+	l.mu.Lock()
 	l.conn = conn
+	l.window = make(chan struct{}, size)
+	l.done = done
+	l.readErr = nil
+	l.mu.Unlock()
+	go l.readLoop(conn, done)
 	return nil
 }
 
 func (l *lanBase) disconnect() {
-	if l.conn != nil {
-		_ = l.conn.Close()
+	conn, _, done := l.connection()
+	if conn != nil {
+		_ = conn.Close()
+		<-done
+		l.mu.Lock()
 		l.conn = nil
+		l.mu.Unlock()
+	}
+}
+
+// acquire blocks until there is room in the window for one more outstanding
+// request, the returned func must be called once the response is received.
+func (l *lanBase) acquire(ctx context.Context) (func(), error) {
+	_, window, _ := l.connection()
+	if window == nil {
+		return nil, ErrNotOpen
+	}
+	select {
+	case window <- struct{}{}:
+		return func() { <-window }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
 	}
 }
 
-func (l *lanBase) sendPacket(buf []byte) error {
+func (l *lanBase) sendPacket(ctx context.Context, buf []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	//fmt.Println(l.addr)
-	_, err := l.conn.Write(buf)
+	conn, _, _ := l.connection()
+	if conn == nil {
+		return ErrNotOpen
+	}
+	_, err := conn.Write(buf)
 	return err
 }
 
@@ -116,37 +347,125 @@ func (l *lanBase) isTargetAddr(addr net.Addr) bool {
 	return true // addr.String() == l.addr.String()
 }
 
-func (l *lanBase) recvPacket() ([]byte, error) {
-	buf := make([]byte, ipmiBufSize)
+// readLoop is the only reader of conn, every packet is handed to the first
+// waiter whose match accepts it and is dropped if nobody wants it.
+func (l *lanBase) readLoop(conn *net.UDPConn, done chan struct{}) {
+	defer close(done)
 
-	for i := 0; ; i++ {
-		if i >= 3 {
-			return nil, ErrTimeout
-		}
-		err := l.conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	for {
+		buf := make([]byte, ipmiBufSize)
+		n, addr, err := conn.ReadFrom(buf)
 		if err != nil {
-			return nil, err
+			l.mu.Lock()
+			l.readErr = err
+			l.mu.Unlock()
+			return
 		}
 
-		n, addr, err := l.conn.ReadFrom(buf)
-		if err != nil {
-			if to, ok := err.(interface {
-				Timeout() bool
-			}); ok {
-				if to.Timeout() {
-					return nil, ErrTimeout
-				}
+		if !l.isTargetAddr(addr) {
+			continue
+		}
+
+		bs := buf[:n]
+		if l.filter != nil {
+			if bs, err = l.filter(bs); err != nil {
+				continue
 			}
+		}
+		l.dispatch(bs)
+	}
+}
+
+func (l *lanBase) dispatch(bs []byte) {
+	l.mu.Lock()
+	waiters := make([]*waiter, len(l.waiters))
+	copy(waiters, l.waiters)
+	l.mu.Unlock()
+
+	for _, w := range waiters {
+		if w.match == nil || w.match(bs) {
+			select {
+			case w.c <- bs:
+			default: // duplicated response
+			}
+			return
+		}
+	}
+}
+
+func (l *lanBase) addWaiter(match func([]byte) bool) *waiter {
+	w := &waiter{match: match, c: make(chan []byte, 1)}
+
+	l.mu.Lock()
+	l.waiters = append(l.waiters, w)
+	l.mu.Unlock()
+	return w
+}
+
+// addListener is like addWaiter but the waiter receives every packet accepted
+// by match until it is removed, up to size packets are buffered.
+func (l *lanBase) addListener(match func([]byte) bool, size int) *waiter {
+	w := &waiter{match: match, c: make(chan []byte, size)}
+
+	l.mu.Lock()
+	l.waiters = append(l.waiters, w)
+	l.mu.Unlock()
+	return w
+}
+
+func (l *lanBase) removeWaiter(w *waiter) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for i, v := range l.waiters {
+		if v == w {
+			copy(l.waiters[i:], l.waiters[i+1:])
+			l.waiters[len(l.waiters)-1] = nil
+			l.waiters = l.waiters[:len(l.waiters)-1]
+			return
+		}
+	}
+}
+
+// exchange sends buf and waits for the packet accepted by match. buf is
+// retransmitted unchanged after every timeout so that the rqSeq and session
+// sequence number stay the same, packets rejected by match are duplicated or
+// late responses of earlier requests and are dropped.
+func (l *lanBase) exchange(ctx context.Context, buf []byte, match func([]byte) bool) ([]byte, error) {
+	w := l.addWaiter(match)
+	defer l.removeWaiter(w)
+	_, _, done := l.connection()
+
+	timeout := l.conn_opt.attemptTimeout()
+	for attempt := 0; ; attempt++ {
+		if err := l.sendPacket(ctx, buf); err != nil {
 			return nil, err
 		}
 
-		if l.isTargetAddr(addr) {
-			return buf[:n], nil
+		timer := time.NewTimer(timeout)
+		select {
+		case bs := <-w.c:
+			timer.Stop()
+			return bs, nil
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-done:
+			timer.Stop()
+			l.mu.Lock()
+			err := l.readErr
+			l.mu.Unlock()
+			return nil, err
+		case <-timer.C:
+			if attempt >= l.conn_opt.retries() {
+				return nil, ErrTimeout
+			}
 		}
+		timeout = l.conn_opt.nextTimeout(timeout)
 	}
 }
 
-func (l *lanBase) ping() error {
+func (l *lanBase) ping(ctx context.Context) error {
 	req := &asfMessage{
 		RMCP: RMCPHeader{
 			Version:            rmcpVersion1,
@@ -159,13 +478,14 @@ func (l *lanBase) ping() error {
 		},
 	}
 
-	if bs, err := ToBytes(req); err != nil {
-		return err
-	} else if err := l.sendPacket(bs); err != nil {
+	bs, err := ToBytes(req)
+	if err != nil {
 		return err
 	}
 
-	buf, err := l.recvPacket()
+	buf, err := l.exchange(ctx, bs, func(buf []byte) bool {
+		return len(buf) > 3 && buf[3] == uint8(rmcpClassASF)
+	})
 	if err != nil {
 		return err
 	}
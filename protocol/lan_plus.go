@@ -2,11 +2,13 @@ package protocol
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"log"
 	"strconv"
+	"strings"
 
 	"github.com/runner-mei/goipmi/protocol/commands"
 )
@@ -54,6 +56,7 @@ type lanPlus struct {
 	RoleUserOnlyLookup bool
 	PrivLevel          uint8
 	Authcode           [16]byte
+	BMCKey             []byte
 	UsernameLen        uint8
 	Username           [16]byte
 	LRand              [16]byte
@@ -66,14 +69,76 @@ type lanPlus struct {
 	integrityAlgorithm       RAKPAlgorithmIntegrityMethod
 	confidentialityAlgorithm RAKPAlgorithmConfidentialityMethod
 	sik, k1, k2              []byte
+
+	// the cipher state is kept across packets for the stream ciphers, they
+	// are created with the session keys and guarded by l.mu
+	encrypter, decrypter func(in, out []byte) ([]byte, error)
+}
+
+// resetCipher creates the ciphers of the session keys, l.mu must be held.
+func (l *lanPlus) resetCipher() {
+	l.encrypter = l.confidentialityAlgorithm.Encrypt(l.k2)
+	l.decrypter = l.confidentialityAlgorithm.Decrypt(l.k2)
 }
 
 func (l *lanPlus) encrypto(bs []byte) ([]byte, error) {
-	return l.confidentialityAlgorithm.Encrypt(l.k2)(bs, make([]byte, 32+len(bs)))
+	l.mu.Lock()
+	encrypter := l.encrypter
+	l.mu.Unlock()
+	if encrypter == nil {
+		return nil, errors.New("session keys aren't generated")
+	}
+	return encrypter(bs, make([]byte, 32+len(bs)))
 }
 
 func (l *lanPlus) unencrypto(bs []byte) ([]byte, error) {
-	return l.confidentialityAlgorithm.Decrypt(l.k2)(bs, make([]byte, 32+len(bs)))
+	l.mu.Lock()
+	decrypter := l.decrypter
+	l.mu.Unlock()
+	if decrypter == nil {
+		return nil, errors.New("session keys aren't generated")
+	}
+	return decrypter(bs, make([]byte, 32+len(bs)))
+}
+
+// decryptPacket replaces the encrypted payload of a received packet with its
+// plaintext. It is called once for every packet by the reader goroutine, so
+// the keystream of a stream cipher is consumed exactly once and in order.
+func (l *lanPlus) decryptPacket(bs []byte) ([]byte, error) {
+	var rmcpHeader RMCPHeader
+	var ipmiHeader IPMIV2Header
+
+	var r Reader
+	r.Init(bs)
+
+	rmcpHeader.ReadBytes(&r)
+	if r.Err() != nil || rmcpHeader.Class != rmcpClassIPMI ||
+		r.Len() < 1 || r.Bytes()[0] != AuthTypeFormatIPMIV2 {
+		return bs, nil
+	}
+	ipmiHeader.ReadBytes(&r)
+	if r.Err() != nil || !PayloadType(ipmiHeader.PayloadType).Encryption() {
+		return bs, nil
+	}
+
+	encrypted := r.ReadBytes(int(ipmiHeader.Length))
+	if r.Err() != nil {
+		return nil, r.Err()
+	}
+	plaintext, err := l.unencrypto(encrypted)
+	if err != nil {
+		return nil, err
+	}
+
+	ipmiHeader.PayloadType &^= 0x80
+	ipmiHeader.Length = uint16(len(plaintext))
+
+	var w Writer
+	w.Init(make([]byte, 0, len(bs)))
+	rmcpHeader.WriteBytes(&w)
+	ipmiHeader.WriteBytes(&w)
+	w.WriteBytes(plaintext)
+	return w.Bytes(), w.Err()
 }
 
 func (l *lanPlus) FromBytes(payload interface{}, bs []byte) error {
@@ -150,6 +215,18 @@ func (l *lanPlus) FromBytes(payload interface{}, bs []byte) error {
 		} else {
 			resp.ReadBytes(&r)
 		}
+	case *solPacket:
+		if PayloadType(ipmiHeader.PayloadType).Value() != PayloadSOL {
+			return errors.New("ipmi payload(" +
+				strconv.FormatInt(int64(ipmiHeader.PayloadType), 10) +
+				") isn't SOL.")
+		}
+		// the packet is decrypted by decryptPacket
+		fork := r.Fork(int(ipmiHeader.Length))
+		resp.ReadBytes(fork)
+		if fork.Err() != nil {
+			return errors.New("read payload(*solPacket) failed, " + fork.Err().Error())
+		}
 	case *OpenSessionRequest:
 		if PayloadType(ipmiHeader.PayloadType).Value() != PayloadOpenSessionRequest {
 			return errors.New("ipmi payload(" +
@@ -272,6 +349,21 @@ func (l *lanPlus) ToBytes(payload interface{}, bs []byte) ([]byte, error) {
 			ipmiHeader.PayloadType = ipmiHeader.PayloadType | 0x80
 		}
 
+	case *solPacket:
+		ipmiHeader.PayloadType = uint8(PayloadSOL)
+		ipmiHeader.Sequence = l.nextSequence()
+		reqW = req
+
+		if l.integrityAlgorithm != RAKPAlgorithmIntegrity_None {
+			authenticated = true
+			ipmiHeader.PayloadType = ipmiHeader.PayloadType | 0x40
+		}
+
+		if l.confidentialityAlgorithm != RAKPAlgorithmEncryto_None {
+			encrypted = true
+			ipmiHeader.PayloadType = ipmiHeader.PayloadType | 0x80
+		}
+
 	case *OpenSessionRequest:
 		ipmiHeader.SessionID = 0
 		ipmiHeader.Sequence = 0
@@ -333,7 +425,6 @@ func (l *lanPlus) ToBytes(payload interface{}, bs []byte) ([]byte, error) {
 
 	if authenticated {
 		inputBytes := tmp[unauthenticatedLen:]
-		fmt.Printf("input bytes %x\r\n", inputBytes)
 		inputLen := len(inputBytes) + l.authenticationAlgorithm.Size() + 2 // 2 is 为 pad 数据长度占用一个字节和 nextheader 占用一个字节
 
 		padLen := 4 - (inputLen % 4)
@@ -350,8 +441,6 @@ func (l *lanPlus) ToBytes(payload interface{}, bs []byte) ([]byte, error) {
 		tmp = w.Bytes()
 		inputBytes = tmp[unauthenticatedLen:]
 
-		fmt.Printf("k1 %x\r\n", l.k1)
-		fmt.Printf("input bytes %x\r\n", inputBytes)
 		w.WriteBytes(l.integrityAlgorithm.Gen(l.k1, inputBytes)[:l.integrityAlgorithm.KeyExchangeSize()])
 
 		tmp = w.Bytes()
@@ -360,8 +449,8 @@ func (l *lanPlus) ToBytes(payload interface{}, bs []byte) ([]byte, error) {
 	return tmp, nil
 }
 
-func (l *lanPlus) open() error {
-	err := l.dial()
+func (l *lanPlus) open(ctx context.Context) error {
+	err := l.dial(ctx)
 	if err != nil {
 		return err
 	}
@@ -371,7 +460,7 @@ func (l *lanPlus) open() error {
 	// l.timeout = time.Second * 5
 	// l.lun = 0
 
-	if err := l.openSession(); err != nil {
+	if err := l.openSession(ctx); err != nil {
 		l.close()
 		return err
 	}
@@ -380,53 +469,145 @@ func (l *lanPlus) open() error {
 
 func (l *lanPlus) close() error {
 	if l.active {
-		if err := l.closeSession(); err != nil {
+		if err := l.closeSession(context.Background()); err != nil {
 			log.Println("error closing session:", err)
 		}
 		l.active = false
 	}
 
-	if l.conn != nil {
-		_ = l.conn.Close()
-		l.conn = nil
-	}
-
+	l.disconnect()
 	return nil
 }
 
-func (l *lanPlus) send(req, resp interface{}) error {
-	bsReq, err := l.ToBytes(req, make([]byte, 0, 1024))
-	if nil != err {
+func (l *lanPlus) send(ctx context.Context, req, resp interface{}) error {
+	release, err := l.acquire(ctx)
+	if err != nil {
 		return err
 	}
+	defer release()
 
-	if err = l.sendPacket(bsReq); err != nil {
+	bsReq, err := l.ToBytes(req, make([]byte, 0, 1024))
+	if nil != err {
 		return err
 	}
 
-	var bsResp []byte
-	if bsResp, err = l.recvPacket(); err != nil {
+	bsResp, err := l.exchange(ctx, bsReq, l.matchResponse(req))
+	if err != nil {
 		return err
 	}
+	if _, ok := resp.(*Response); ok {
+		if err := l.checkSessionID(bsResp); err != nil {
+			return err
+		}
+	}
 
 	return l.FromBytes(resp, bsResp)
 }
 
-func (l *lanPlus) exec(cmd commands.CommandCode, reqData, respData interface{}) error {
+// checkSessionID returns ErrSessionID if the response isn't in the active
+// session, e.g. the session is timed out or the BMC is rebooted.
+func (l *lanPlus) checkSessionID(bs []byte) error {
+	var rmcpHeader RMCPHeader
+	var ipmiHeader IPMIV2Header
+
+	var r Reader
+	r.Init(bs)
+
+	rmcpHeader.ReadBytes(&r)
+	ipmiHeader.ReadBytes(&r)
+	if r.Err() != nil {
+		return r.Err()
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.active && ipmiHeader.SessionID != l.LSessionID {
+		return ErrSessionID
+	}
+	return nil
+}
+
+// matchResponse returns a func that reports whether a packet is the response
+// of req, IPMI responses are matched by rqSeq and command, session setup
+// messages by payload type and message tag.
+func (l *lanPlus) matchResponse(req interface{}) func([]byte) bool {
+	switch req := req.(type) {
+	case *Request:
+		return func(bs []byte) bool {
+			var resp Response
+			if err := l.FromBytes(&resp, bs); err != nil {
+				return false
+			}
+			return matchResponseBody(&req.Body, &resp.Body) &&
+				!pendingBridgedResponse(req, ipmiV2Message(bs))
+		}
+	case *OpenSessionRequest:
+		return matchMessageTag(PayloadOpenSessionResponse, req.MessageTag)
+	case *RakpMessage1:
+		return matchMessageTag(PayloadRAKPMessage2, req.MessageTag)
+	case *RakpMessage3:
+		return matchMessageTag(PayloadRAKPMessage4, req.MessageTag)
+	default:
+		return nil
+	}
+}
+
+// ipmiV2Message returns the payload of a unencrypted IPMI v2.0 packet.
+func ipmiV2Message(bs []byte) []byte {
+	var rmcpHeader RMCPHeader
+	var ipmiHeader IPMIV2Header
+
+	var r Reader
+	r.Init(bs)
+
+	rmcpHeader.ReadBytes(&r)
+	ipmiHeader.ReadBytes(&r)
+	if r.Err() != nil || r.Len() < int(ipmiHeader.Length) {
+		return nil
+	}
+	return r.Bytes()[:ipmiHeader.Length]
+}
+
+func matchMessageTag(payloadType PayloadType, messageTag uint8) func([]byte) bool {
+	return func(bs []byte) bool {
+		var rmcpHeader RMCPHeader
+		var ipmiHeader IPMIV2Header
+
+		var r Reader
+		r.Init(bs)
+
+		rmcpHeader.ReadBytes(&r)
+		ipmiHeader.ReadBytes(&r)
+		if r.Err() != nil || r.Len() < 1 {
+			return false
+		}
+		return PayloadType(ipmiHeader.PayloadType).Value() == payloadType &&
+			r.Bytes()[0] == messageTag
+	}
+}
+
+func (l *lanPlus) exec(ctx context.Context, cmd commands.CommandCode, reqData, respData interface{}) error {
 	var req Request
 	var resp Response
 
 	req.Init(cmd, reqData)
 	resp.Init(cmd, respData)
 
-	return l.send(&req, &resp)
+	return l.send(ctx, &req, &resp)
 }
 
-func (l *lanPlus) sendv1(req *Request, res *Response) error {
+func (l *lanPlus) sendv1(ctx context.Context, req *Request, res *Response) error {
+	release, err := l.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
 	var sequence uint32
 	var rqSequence uint8
 
-	if req.NetFn() == commands.NetworkFunctionApp && req.Body.Cmd == commands.GetChannelAuthenticationCapabilities.Code {
+	if req.NetFn() == commands.NetworkFunctionApp &&
+		(req.Body.Cmd == commands.GetChannelAuthenticationCapabilities.Code ||
+			req.Body.Cmd == commands.GetChannelCipherSuites.Code) {
 		sequence = 0
 		rqSequence = 0
 	} else {
@@ -439,54 +620,65 @@ func (l *lanPlus) sendv1(req *Request, res *Response) error {
 		return err
 	}
 
-	if err = l.sendPacket(bsReq); err != nil {
-		return err
-	}
-
-	var bsResp []byte
-	if bsResp, err = l.recvPacket(); err != nil {
+	bsResp, err := l.exchange(ctx, bsReq, IPMIv1MatchResponse(req))
+	if err != nil {
 		return err
 	}
 
 	return IPMIv1FromBytes(res, bsResp)
 }
 
-func (l *lanPlus) execv1(cmd commands.CommandCode, reqData, respData interface{}) error {
+func (l *lanPlus) execv1(ctx context.Context, cmd commands.CommandCode, reqData, respData interface{}) error {
 	var req Request
 	var resp Response
 
 	req.Init(cmd, reqData)
 	resp.Init(cmd, respData)
 
-	return l.sendv1(&req, &resp)
+	return l.sendv1(ctx, &req, &resp)
 }
 
-func (l *lanPlus) openSession() error {
+func (l *lanPlus) openSession(ctx context.Context) error {
 	// if err := l.ping(); err != nil {
 	// 	return err
 	// }
 
+	// the keys of the previous session are dropped when it is re-established,
+	// they are read by the reader goroutine
+	l.mu.Lock()
 	l.sequence = 2
 	l.rqSeqence = 0
+	l.active = false
+	l.LSessionID, l.RSessionID = 0, 0
+	l.sik, l.k1, l.k2 = nil, nil, nil
+	l.encrypter, l.decrypter = nil, nil
+	l.mu.Unlock()
 
-	if err := l.getAuthCapabilities(true); err != nil {
+	if err := l.getAuthCapabilities(ctx, true); err != nil {
 		return err
 	}
-	if err := l.rmcpOpen(); err != nil {
+	if strings.ToLower(l.conn_opt.CipherSuite) == "auto" {
+		if err := l.selectCipherSuite(ctx); err != nil {
+			return err
+		}
+	}
+	if err := l.rmcpOpen(ctx); err != nil {
 		return err
 	}
+	l.mu.Lock()
 	l.active = true
+	l.mu.Unlock()
 
-	if err := l.rakp1(); err != nil {
+	if err := l.rakp1(ctx); err != nil {
 		return err
 	}
-	if err := l.rakp3(); err != nil {
+	if err := l.rakp3(ctx); err != nil {
 		return err
 	}
-	return l.setPrivilegeLevel()
+	return l.setPrivilegeLevel(ctx)
 }
 
-func (l *lanPlus) getAuthCapabilities(isV2 bool) error {
+func (l *lanPlus) getAuthCapabilities(ctx context.Context, isV2 bool) error {
 	var req AuthCapabilitiesRequest
 	var resp AuthCapabilitiesResponse
 
@@ -497,7 +689,7 @@ func (l *lanPlus) getAuthCapabilities(isV2 bool) error {
 	}
 	req.PrivLevel = l.PrivLevel
 
-	if err := l.execv1(commands.GetChannelAuthenticationCapabilities, &req, &resp); err != nil {
+	if err := l.execv1(ctx, commands.GetChannelAuthenticationCapabilities, &req, &resp); err != nil {
 		return err
 	}
 
@@ -521,7 +713,25 @@ func (l *lanPlus) getAuthCapabilities(isV2 bool) error {
 	return errors.New("BMC did not offer a supported AuthType(" + strconv.FormatInt(int64(resp.AuthTypeSupport), 10) + ")")
 }
 
-func (l *lanPlus) rmcpOpen() error {
+// selectCipherSuite uses the strongest cipher suite that is supported by
+// both the BMC and lanPlus.
+func (l *lanPlus) selectCipherSuite(ctx context.Context) error {
+	suites, err := ReadChannelCipherSuites(ctx, 0x0e, l.execv1) // lanChannelE
+	if err != nil {
+		return errors.New("get channel cipher suites failed, " + err.Error())
+	}
+
+	suite, err := strongestCipherSuite(suites)
+	if err != nil {
+		return err
+	}
+	l.authenticationAlgorithm = suite.Authentication
+	l.integrityAlgorithm = suite.Integrity
+	l.confidentialityAlgorithm = suite.Confidentiality
+	return nil
+}
+
+func (l *lanPlus) rmcpOpen(ctx context.Context) error {
 	var req = OpenSessionRequest{
 		PrivLevel: l.PrivLevel,
 		SessionID: nextSessionID(),
@@ -532,7 +742,7 @@ func (l *lanPlus) rmcpOpen() error {
 	req.Authentication.Algorithm = l.authenticationAlgorithm
 	req.Integrity.Algorithm = l.integrityAlgorithm
 	req.Confidentiality.Algorithm = l.confidentialityAlgorithm
-	err := l.send(&req, &resp)
+	err := l.send(ctx, &req, &resp)
 	if nil != err {
 		return err
 	}
@@ -541,6 +751,8 @@ func (l *lanPlus) rmcpOpen() error {
 		return StatusCode(resp.StatusCode)
 	}
 
+	l.mu.Lock()
+	defer l.mu.Unlock()
 	l.PrivLevel = resp.PrivLevel
 	l.LSessionID = resp.SessionID
 	l.RSessionID = resp.MSessionID
@@ -560,7 +772,7 @@ func (l *lanPlus) rmcpOpen() error {
 	return nil
 }
 
-func (l *lanPlus) rakp1() error {
+func (l *lanPlus) rakp1(ctx context.Context) error {
 	privlevel := l.PrivLevel
 	if l.RoleUserOnlyLookup {
 		privlevel |= (1 << 4)
@@ -582,7 +794,7 @@ func (l *lanPlus) rakp1() error {
 	copy(req.UserName[:], l.Username[:l.UsernameLen])
 	req.UserNameLength = l.UsernameLen
 
-	err := l.send(&req, &resp)
+	err := l.send(ctx, &req, &resp)
 	if nil != err {
 		return err
 	}
@@ -610,27 +822,47 @@ func (l *lanPlus) rakp1() error {
 		return ErrPasswordNotMatch
 	}
 
-	w.Reset()
+	l.genSessionKeys(privlevel)
+	return nil
+}
+
+// genSessionKeys generates the SIK and the keys derived from it per section
+// 13.31, the SIK is keyed by the BMC key (Kg) if it is configured, otherwise
+// by the user password (Kuid).
+func (l *lanPlus) genSessionKeys(privlevel uint8) {
+	var w Writer
+	w.Init(make([]byte, 0, 64))
 	w.WriteBytes(l.LRand[:])
 	w.WriteBytes(l.RRand[:])
 	w.WriteUint8(privlevel) // privlevel
 	w.WriteUint8(l.UsernameLen)
 	w.WriteBytes(l.Username[:int(l.UsernameLen)])
 
-	l.sik = l.authenticationAlgorithm.Gen(l.Authcode[:], w.Bytes())
-	fmt.Printf("sik=%x\r\n", l.sik)
-
-	signSize := l.integrityAlgorithm.SignSize()
-	l.k1 = l.integrityAlgorithm.Gen(l.sik, bytes.Repeat([]byte{1}, signSize))[:signSize]
-	fmt.Printf("k1=%x\r\n", l.k1)
+	kg := l.BMCKey
+	if len(kg) == 0 {
+		kg = l.Authcode[:]
+	}
 
-	l.k2 = l.integrityAlgorithm.Gen(l.sik, bytes.Repeat([]byte{2}, signSize))[:signSize]
-	fmt.Printf("k2=%x\r\n", l.k2)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.sik = l.authenticationAlgorithm.Gen(kg, w.Bytes())
+	l.k1 = l.additionalKey(1)
+	l.k2 = l.additionalKey(2)
+	l.resetCipher()
+}
 
-	return nil
+// additionalKey generates K1 or K2 per section 13.32, it is the HMAC of the
+// 20 bytes constant by the authentication algorithm keyed by the SIK, the
+// constant itself is the key if the authentication algorithm is none.
+func (l *lanPlus) additionalKey(constant uint8) []byte {
+	bs := bytes.Repeat([]byte{constant}, 20)
+	if l.authenticationAlgorithm == RAKPAlgorithmAuth_None {
+		return bs
+	}
+	return l.authenticationAlgorithm.Gen(l.sik, bs)
 }
 
-func (l *lanPlus) rakp3() error {
+func (l *lanPlus) rakp3(ctx context.Context) error {
 	var req = RakpMessage3{SessionID: l.RSessionID,
 		StatusCode: uint8(RAKP_STATUS_NO_ERRORS),
 		//KeyExchange []byte // (9-*) N 取决于RakpMessage1 AuthAlg
@@ -652,7 +884,7 @@ func (l *lanPlus) rakp3() error {
 	res := l.authenticationAlgorithm.Gen(l.Authcode[:], w.Bytes())
 	req.KeyExchange = res
 
-	err := l.send(&req, &resp)
+	err := l.send(ctx, &req, &resp)
 	if nil != err {
 		return err
 	}
@@ -681,23 +913,25 @@ func (l *lanPlus) rakp3() error {
 	return errors.New("integrity check is failed")
 }
 
-func (l *lanPlus) setPrivilegeLevel() error {
+func (l *lanPlus) setPrivilegeLevel(ctx context.Context) error {
 	var req_payload = SessionPrivilegeLevelRequest{PrivLevel: l.PrivLevel}
 	var resp_payload = SessionPrivilegeLevelResponse{}
-	return l.exec(commands.SetSessionPrivilegeLevel, &req_payload, &resp_payload)
+	return l.exec(ctx, commands.SetSessionPrivilegeLevel, &req_payload, &resp_payload)
 }
 
-func (l *lanPlus) closeSession() error {
+func (l *lanPlus) closeSession(ctx context.Context) error {
 	var req CloseSessionRequest
 	var resp CloseSessionResponse
 	req.SessionID = l.RSessionID
-	return l.exec(commands.CloseSession, &req, &resp)
+	return l.exec(ctx, commands.CloseSession, &req, &resp)
 }
 
 func newLanPlus(opt *ConnectionOption) *lanPlus {
 	l := &lanPlus{lanBase: lanBase{conn_opt: opt, sequence: 2}}
+	l.filter = l.decryptPacket
 
-	l.RoleUserOnlyLookup = true
+	l.RoleUserOnlyLookup = !opt.PrivilegeLookup
+	l.BMCKey, _ = ParseBMCKey(opt.BMCKey)
 	l.UsernameLen = uint8(len(opt.Username))
 	copy(l.Username[:], opt.Username[:])
 	copy(l.Authcode[:], opt.Password[:])
@@ -714,7 +948,11 @@ func newLanPlus(opt *ConnectionOption) *lanPlus {
 	l.integrityAlgorithm = opt.IntegrityAlgorithm
 	l.confidentialityAlgorithm = opt.ConfidentialityAlgorithm
 
-	if l.authenticationAlgorithm == RAKPAlgorithmAuth_None {
+	if suite, err := ParseCipherSuite(opt.CipherSuite); err == nil && suite != nil {
+		l.authenticationAlgorithm = suite.Authentication
+		l.integrityAlgorithm = suite.Integrity
+		l.confidentialityAlgorithm = suite.Confidentiality
+	} else if l.authenticationAlgorithm == RAKPAlgorithmAuth_None {
 		l.authenticationAlgorithm = RAKPAlgorithmAuth_HMAC_SHA1
 	}
 	// l.authenticationAlgorithm = RAKPAlgorithmAuth_HMAC_SHA1
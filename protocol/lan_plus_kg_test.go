@@ -0,0 +1,135 @@
+package protocol
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+)
+
+func TestParseBMCKey(t *testing.T) {
+	key, e := ParseBMCKey("0x0102030405")
+	if e != nil {
+		t.Error(e)
+		return
+	}
+	assertEquals(t, "hex", key, []byte{1, 2, 3, 4, 5})
+
+	key, e = ParseBMCKey("secret")
+	if e != nil {
+		t.Error(e)
+		return
+	}
+	assertEquals(t, "raw", key, []byte("secret"))
+
+	for _, s := range []string{"0xzz", "012345678901234567890"} {
+		if _, e := ParseBMCKey(s); e == nil {
+			t.Error(s, "must be invalid")
+		}
+	}
+}
+
+func TestBMCKeySIK(t *testing.T) {
+	for _, test := range []struct {
+		bmcKey string
+		key    []byte
+	}{
+		{bmcKey: "", key: []byte("123456abc")},
+		{bmcKey: "0x0102030405060708090a0b0c0d0e0f1011121314", key: []byte{
+			0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a,
+			0x0b, 0x0c, 0x0d, 0x0e, 0x0f, 0x10, 0x11, 0x12, 0x13, 0x14}},
+	} {
+		l := newLanPlus(&ConnectionOption{Username: "Administrator",
+			Password:                "123456abc",
+			BMCKey:                  test.bmcKey,
+			AuthenticationAlgorithm: RAKPAlgorithmAuth_HMAC_SHA1,
+			IntegrityAlgorithm:      RAKPAlgorithmIntegrity_HMAC_SHA1_96})
+		assertEquals(t, "RoleUserOnlyLookup", l.RoleUserOnlyLookup, true)
+
+		copy(l.LRand[:], []byte("0123456789abcdef"))
+		copy(l.RRand[:], []byte("fedcba9876543210"))
+		l.genSessionKeys(0x14)
+
+		mac := hmac.New(sha1.New, test.key)
+		mac.Write(l.LRand[:])
+		mac.Write(l.RRand[:])
+		mac.Write([]byte{0x14, 13})
+		mac.Write([]byte("Administrator"))
+		assertEquals(t, "sik", l.sik, mac.Sum(nil))
+	}
+
+	l := newLanPlus(&ConnectionOption{PrivilegeLookup: true})
+	assertEquals(t, "RoleUserOnlyLookup", l.RoleUserOnlyLookup, false)
+}
+
+func TestSessionKeys(t *testing.T) {
+	// the keys of the session that is logged by "ipmitool -v" in lan_plus_test.go
+	l := newLanPlus(&ConnectionOption{Username: "Administrator",
+		Password:                 "123456abc",
+		AuthenticationAlgorithm:  RAKPAlgorithmAuth_HMAC_SHA1,
+		IntegrityAlgorithm:       RAKPAlgorithmIntegrity_HMAC_SHA1_96,
+		ConfidentialityAlgorithm: RAKPAlgorithmEncryto_AES_CBC_128})
+	rand, _ := hex.DecodeString("457b81bb81b86c946897113ab5ff3b305265751988b73c5e42e8947c25b138b5")
+	copy(l.LRand[:], rand[:16])
+	copy(l.RRand[:], rand[16:])
+	l.genSessionKeys(0x14)
+	assertEquals(t, "sik", hex.EncodeToString(l.sik), "29a3aa86249a8d6bd5a7d9597339375d560f3806")
+	assertEquals(t, "k1", hex.EncodeToString(l.k1), "c54ddc1bcc14a46989c6f2805679bb583d81b1c7")
+	assertEquals(t, "k2", hex.EncodeToString(l.k2), "35f46e582502de151981f9a052d1ee2d5aa73bd5")
+
+	// the keys are generated by the authentication algorithm in full length
+	l.authenticationAlgorithm = RAKPAlgorithmAuth_HMAC_SHA256
+	l.integrityAlgorithm = RAKPAlgorithmIntegrity_HMAC_SHA256_128
+	l.genSessionKeys(0x14)
+	mac := hmac.New(sha256.New, l.sik)
+	mac.Write(bytes.Repeat([]byte{1}, 20))
+	assertEquals(t, "k1", l.k1, mac.Sum(nil))
+	assertEquals(t, "k1 size", len(l.k1), 32)
+
+	// K2 of the MD5-128 integrity suites depends on the SIK
+	l.authenticationAlgorithm = RAKPAlgorithmAuth_HMAC_MD5
+	l.integrityAlgorithm = RAKPAlgorithmIntegrity_MD5_128
+	l.genSessionKeys(0x14)
+	k2 := l.k2
+	l.RRand[0]++
+	l.genSessionKeys(0x14)
+	if bytes.Equal(k2, l.k2) {
+		t.Error("k2 doesn't depend on the SIK")
+	}
+
+	l.authenticationAlgorithm = RAKPAlgorithmAuth_None
+	l.integrityAlgorithm = RAKPAlgorithmIntegrity_None
+	l.confidentialityAlgorithm = RAKPAlgorithmEncryto_None
+	l.genSessionKeys(0x14)
+	assertEquals(t, "k2", l.k2, bytes.Repeat([]byte{2}, 20))
+}
+
+func TestSessionCipherConcurrent(t *testing.T) {
+	l := newLanPlus(&ConnectionOption{Username: "Administrator", Password: "123456abc",
+		AuthenticationAlgorithm:  RAKPAlgorithmAuth_HMAC_SHA1,
+		IntegrityAlgorithm:       RAKPAlgorithmIntegrity_HMAC_SHA1_96,
+		ConfidentialityAlgorithm: RAKPAlgorithmEncryto_XRC4_128})
+	if _, e := l.encrypto([]byte{0x20}); e == nil {
+		t.Error("excepted is no session keys error")
+	}
+	l.genSessionKeys(0x14)
+
+	done := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		go func() {
+			defer func() { done <- struct{}{} }()
+			for j := 0; j < 100; j++ {
+				if _, e := l.encrypto([]byte{0x20, 0x18, 0xc8}); e != nil {
+					t.Error(e)
+					return
+				}
+			}
+		}()
+	}
+	l.genSessionKeys(0x14) // the session is re-established
+	for i := 0; i < 4; i++ {
+		<-done
+	}
+}
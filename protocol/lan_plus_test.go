@@ -2,6 +2,7 @@ package protocol
 
 import (
 	"bytes"
+	"context"
 	"encoding/hex"
 	"fmt"
 	"net"
@@ -786,7 +787,7 @@ func TestOpenSession(t *testing.T) {
 	_session_id = 2695013284 - 1
 
 	is_test = true
-	if e := l.open(); nil != e {
+	if e := l.open(context.Background()); nil != e {
 		t.Error(e)
 	}
 }
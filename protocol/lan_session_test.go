@@ -0,0 +1,727 @@
+package protocol
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/runner-mei/goipmi/protocol/commands"
+)
+
+const (
+	fakeTemporarySessionID = 0x11223344
+	fakeV15SessionID       = 0x55667788
+	fakeInboundSeq         = 0x100
+)
+
+var fakeChallenge = [16]byte{0xc0, 0xc1, 0xc2, 0xc3, 0xc4, 0xc5, 0xc6, 0xc7,
+	0xc8, 0xc9, 0xca, 0xcb, 0xcc, 0xcd, 0xce, 0xcf}
+
+// fakeBMCv15 is a IPMI v1.5 BMC that checks the AuthCode and the session
+// sequence number of every request.
+type fakeBMCv15 struct {
+	conn       *net.UDPConn
+	authType   uint8
+	password   string
+	perMsgAuth bool
+
+	mu        sync.Mutex
+	active    bool
+	closed    bool
+	sessions  int
+	expired   CompletionCode // the completion code of the requests outside of the session
+	rebooted  bool           // the requests outside of the session are answered without session
+	dropped   bool           // the requests outside of the session are dropped
+	lost      int            // the number of the requests in the session to drop
+	rejected  CompletionCode // the completion code of the requests in the session but Get Session Info
+	delayed   bool           // the bridged responses are sent after the Send Message responses
+	early     []byte         // the packet sent before the reply of handle
+	outSeq    uint32
+	authTypes []uint8  // AuthType of the session requests
+	sequences []uint32 // session sequence number of the session requests
+	errs      []error
+}
+
+func newFakeBMCv15(t *testing.T, authType uint8, password string) *fakeBMCv15 {
+	conn, e := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if e != nil {
+		t.Fatal(e)
+	}
+	bmc := &fakeBMCv15{conn: conn, authType: authType, password: password, perMsgAuth: true}
+	go bmc.serve()
+	return bmc
+}
+
+func (bmc *fakeBMCv15) option(password string) *ConnectionOption {
+	return &ConnectionOption{Hostname: "127.0.0.1",
+		Port:      bmc.conn.LocalAddr().(*net.UDPAddr).Port,
+		Interface: "lan",
+		Username:  "admin",
+		Password:  password,
+		Timeout:   200 * time.Millisecond}
+}
+
+// errorf records an error, bmc.mu must be held.
+func (bmc *fakeBMCv15) errorf(s string) {
+	bmc.errs = append(bmc.errs, errors.New(s))
+}
+
+func (bmc *fakeBMCv15) serve() {
+	buf := make([]byte, 1024)
+	for {
+		n, addr, e := bmc.conn.ReadFrom(buf)
+		if e != nil {
+			return
+		}
+		if reply := bmc.handle(buf[:n]); reply != nil {
+			if bmc.early != nil {
+				bmc.conn.WriteTo(bmc.early, addr)
+				bmc.early = nil
+			}
+			bmc.conn.WriteTo(reply, addr)
+		}
+	}
+}
+
+func (bmc *fakeBMCv15) handle(bs []byte) []byte {
+	var rmcpHeader RMCPHeader
+	var ipmiHeader IPMIV1Header
+	var body IPMIBody
+
+	bmc.mu.Lock()
+	defer bmc.mu.Unlock()
+
+	var r Reader
+	r.Init(bs)
+	rmcpHeader.ReadBytes(&r)
+	if rmcpHeader.Class == rmcpClassASF {
+		pong, _ := ToBytes(&asfMessage{
+			RMCP: RMCPHeader{Version: rmcpVersion1, Class: rmcpClassASF, RMCPSequenceNumber: 0xff},
+			ASF:  asfHeader{IANAEnterpriseNumber: asfIANA, MessageType: asfMessageTypePong, DataLength: 16},
+			Data: &asfPong{IANAEnterpriseNumber: asfIANA, SupportedEntities: 0x81},
+		})
+		return pong
+	}
+	ipmiHeader.ReadBytes(&r)
+	msg := r.Bytes()
+	body.ReadBytes(&r)
+	if r.Err() != nil || r.Len() < 1 {
+		bmc.errorf("invalid packet " + hex.EncodeToString(bs))
+		return nil
+	}
+	data := r.Bytes()[:r.Len()-1]
+
+	if ipmiHeader.AuthType != AuthTypeNone {
+		authCode, _ := IPMIv1AuthCode(ipmiHeader.AuthType, []byte(bmc.password),
+			ipmiHeader.SessionID, ipmiHeader.Sequence, msg)
+		if !bytes.Equal(authCode, ipmiHeader.AuthCode) {
+			return nil // an invalid packet is dropped silently
+		}
+	}
+
+	var sessionID uint32
+	var respData []byte
+	var code CompletionCode
+	switch body.Cmd {
+	case commands.GetChannelAuthenticationCapabilities.Code:
+		status := uint8(0)
+		if !bmc.perMsgAuth {
+			status = 1 << 4
+		}
+		respData = []byte{0x01, 1 << bmc.authType, status, 0, 0, 0, 0, 0}
+	case commands.GetSessionChallenge.Code:
+		if data[0] != bmc.authType || string(bytes.TrimRight(data[1:17], "\x00")) != "admin" {
+			bmc.errorf("invalid session challenge request " + hex.EncodeToString(data))
+		}
+		respData = make([]byte, 20)
+		binary.LittleEndian.PutUint32(respData, fakeTemporarySessionID)
+		copy(respData[4:], fakeChallenge[:])
+	case commands.ActivateSession.Code:
+		sessionID = fakeTemporarySessionID
+		if ipmiHeader.AuthType != bmc.authType || ipmiHeader.SessionID != fakeTemporarySessionID ||
+			ipmiHeader.Sequence != 0 || !bytes.Equal(data[2:18], fakeChallenge[:]) {
+			bmc.errorf("invalid activate session request " + hex.EncodeToString(bs))
+		}
+		bmc.active = true
+		bmc.sessions++
+		bmc.outSeq = binary.LittleEndian.Uint32(data[18:])
+		respData = make([]byte, 10)
+		respData[0] = bmc.authType
+		binary.LittleEndian.PutUint32(respData[1:], fakeV15SessionID)
+		binary.LittleEndian.PutUint32(respData[5:], fakeInboundSeq)
+		respData[9] = data[1]
+	default:
+		sessionID = fakeV15SessionID
+		if !bmc.active || ipmiHeader.SessionID != fakeV15SessionID {
+			if bmc.rebooted {
+				sessionID = 0
+				break
+			}
+			if bmc.dropped {
+				return nil
+			}
+			if bmc.expired == CommandCompleted {
+				bmc.errorf("request outside of the session " + hex.EncodeToString(bs))
+				return nil
+			}
+			code = bmc.expired
+			break
+		}
+		if bmc.lost > 0 {
+			bmc.lost--
+			return nil
+		}
+		bmc.authTypes = append(bmc.authTypes, ipmiHeader.AuthType)
+		bmc.sequences = append(bmc.sequences, ipmiHeader.Sequence)
+		if bmc.rejected != CommandCompleted && body.Cmd != commands.GetSessionInfo.Code {
+			code = bmc.rejected
+			break
+		}
+
+		switch body.Cmd {
+		case commands.SetSessionPrivilegeLevel.Code:
+			respData = []byte{data[0]}
+		case commands.GetSessionInfo.Code:
+			respData = []byte{0x01, 0x04, 0x01}
+		case commands.SendMessage.Code:
+			respData = bridgedResponse(data)
+			if bmc.delayed {
+				bmc.early = bmc.packet(sessionID, &body, CommandCompleted, []byte{})
+			}
+		case commands.CloseSession.Code:
+			if binary.LittleEndian.Uint32(data) != fakeV15SessionID {
+				bmc.errorf("invalid close session request " + hex.EncodeToString(data))
+			}
+			bmc.active = false
+			bmc.closed = true
+		}
+	}
+
+	return bmc.packet(sessionID, &body, code, respData)
+}
+
+// packet returns the response to the request body in the session.
+func (bmc *fakeBMCv15) packet(sessionID uint32, body *IPMIBody, code CompletionCode, respData []byte) []byte {
+	var resp = Response{Body: IPMIBody{RsAddr: body.RqAddr,
+		NetFnRsLUN: (body.NetFnRsLUN>>2 | 1) << 2,
+		RqAddr:     body.RsAddr,
+		RqSeq:      body.RqSeq,
+		Cmd:        body.Cmd},
+		CompletionCode: code,
+		Data:           respData}
+
+	var header = IPMIV1Header{SessionID: sessionID}
+	if sessionID != 0 && code == CommandCompleted {
+		header.AuthType = bmc.authType
+		if sessionID == fakeV15SessionID {
+			header.Sequence = bmc.outSeq
+			bmc.outSeq++
+			if !bmc.perMsgAuth {
+				header.AuthType = AuthTypeNone
+			}
+		}
+	}
+	return bmc.reply(&header, &resp)
+}
+
+// bridgedResponse returns the IPMB response of the controllers behind the
+// BMC to the Send Message request data, the controller at 0x2c answers Get
+// Sensor Reading and the controller at 0x82 bridges requests again.
+func bridgedResponse(data []byte) []byte {
+	var body IPMIBody
+	var r Reader
+	r.Init(data[1:])
+	body.ReadBytes(&r)
+	reqData := r.Bytes()[:r.Len()-1]
+
+	var respData []byte
+	var code CompletionCode
+	switch {
+	case body.RsAddr == 0x82 && body.Cmd == commands.SendMessage.Code:
+		respData = bridgedResponse(reqData)
+	case body.RsAddr == 0x2c && body.Cmd == 0x2d:
+		respData = []byte{reqData[0] + 0x30, 0xc0, 0x00}
+	default:
+		code = ErrDestUnavail
+	}
+
+	resp := Response{Body: IPMIBody{RsAddr: body.RqAddr,
+		NetFnRsLUN: (body.NetFnRsLUN>>2|1)<<2 | body.NetFnRsLUN&0x03,
+		RqAddr:     body.RsAddr,
+		RqSeq:      body.RqSeq,
+		Cmd:        body.Cmd},
+		CompletionCode: code,
+		Data:           respData}
+
+	w := Writer{}
+	w.Init(nil)
+	resp.WriteBytes(&w)
+	return w.Bytes()
+}
+
+func (bmc *fakeBMCv15) reply(header *IPMIV1Header, resp *Response) []byte {
+	w := Writer{}
+	w.Init(nil)
+	(&RMCPHeader{Version: rmcpVersion1, Class: rmcpClassIPMI, RMCPSequenceNumber: 0xff}).WriteBytes(&w)
+	header.WriteBytes(&w)
+	old_length := w.Len()
+	resp.WriteBytes(&w)
+	bs := w.Bytes()
+	bs[old_length-1] = uint8(len(bs) - old_length)
+
+	if header.AuthType != AuthTypeNone {
+		authCode, _ := IPMIv1AuthCode(header.AuthType, []byte(bmc.password),
+			header.SessionID, header.Sequence, bs[old_length:])
+		copy(bs[old_length-17:], authCode)
+	}
+	return bs
+}
+
+// check reports the recorded errors and returns the requests in the session.
+func (bmc *fakeBMCv15) check(t *testing.T) (closed bool, authTypes []uint8, sequences []uint32) {
+	bmc.mu.Lock()
+	defer bmc.mu.Unlock()
+	for _, e := range bmc.errs {
+		t.Error(e)
+	}
+	return bmc.closed, bmc.authTypes, bmc.sequences
+}
+
+func TestLanSession(t *testing.T) {
+	for _, authType := range []uint8{AuthTypeMD5, AuthTypeMD2, AuthTypePassword, AuthTypeNone} {
+		bmc := newFakeBMCv15(t, authType, "password")
+		defer bmc.conn.Close()
+
+		l := newLan(bmc.option("password"))
+		if e := l.open(context.Background()); e != nil {
+			t.Error(authType, e)
+			continue
+		}
+		assertEquals(t, "AuthType", l.AuthType, authType)
+		assertEquals(t, "SessionID", l.SessionID, uint32(fakeV15SessionID))
+		assertEquals(t, "PrivLevel", l.PrivLevel, uint8(commands.PrivLevelAdmin))
+
+		for i := 0; i < 2; i++ {
+			var req = SessionPrivilegeLevelRequest{PrivLevel: uint8(commands.PrivLevelOperator)}
+			var resp SessionPrivilegeLevelResponse
+			if e := l.exec(context.Background(), commands.SetSessionPrivilegeLevel, &req, &resp); e != nil {
+				t.Error(authType, e)
+			}
+			assertEquals(t, "NewPrivilegeLevel", resp.NewPrivilegeLevel, uint8(commands.PrivLevelOperator))
+		}
+		l.close()
+
+		closed, authTypes, sequences := bmc.check(t)
+		assertEquals(t, "closed", closed, true)
+		assertEquals(t, "authTypes", authTypes, []uint8{authType, authType, authType, authType})
+		assertEquals(t, "sequences", sequences, []uint32{fakeInboundSeq, fakeInboundSeq + 1, fakeInboundSeq + 2, fakeInboundSeq + 3})
+	}
+}
+
+func TestLanSessionPerMessageAuthDisabled(t *testing.T) {
+	bmc := newFakeBMCv15(t, AuthTypeMD5, "password")
+	bmc.mu.Lock()
+	bmc.perMsgAuth = false
+	bmc.mu.Unlock()
+	defer bmc.conn.Close()
+
+	l := newLan(bmc.option("password"))
+	if e := l.open(context.Background()); e != nil {
+		t.Error(e)
+		return
+	}
+	l.close()
+
+	closed, authTypes, _ := bmc.check(t)
+	assertEquals(t, "closed", closed, true)
+	assertEquals(t, "authTypes", authTypes, []uint8{AuthTypeNone, AuthTypeNone})
+}
+
+func TestLanSessionInvalidPassword(t *testing.T) {
+	bmc := newFakeBMCv15(t, AuthTypeMD5, "password")
+	defer bmc.conn.Close()
+
+	l := newLan(bmc.option("invalid"))
+	defer l.close()
+	if e := l.open(context.Background()); e != ErrTimeout {
+		t.Error("excepted is timeout, actual is", e)
+	}
+	bmc.check(t)
+}
+
+func TestLanCheckPacket(t *testing.T) {
+	bmc := &fakeBMCv15{authType: AuthTypeMD5, password: "password"}
+	l := newLan(&ConnectionOption{Password: "password"})
+	l.active = true
+	l.SessionID = fakeV15SessionID
+	l.outSeq = 9
+	l.outSeqSeen = 0xff
+
+	packet := func(seq uint32, password string) []byte {
+		bmc.password = password
+		return bmc.reply(&IPMIV1Header{AuthType: AuthTypeMD5, SessionID: fakeV15SessionID, Sequence: seq},
+			NewResponse(commands.SetSessionPrivilegeLevel, []byte{0x04}))
+	}
+
+	for idx, test := range []struct {
+		bs  []byte
+		err error
+	}{
+		{bs: packet(10, "password")},
+		{bs: packet(10, "password"), err: ErrSequenceNumber},
+		{bs: packet(11, "invalid"), err: ErrInvalidAuthCode},
+		{bs: packet(13, "password")},
+		{bs: packet(11, "password")},
+		{bs: packet(11, "password"), err: ErrSequenceNumber},
+		{bs: packet(9, "password"), err: ErrSequenceNumber},
+		{bs: packet(30, "password")},
+		{bs: packet(21, "password"), err: ErrSequenceNumber},
+		{bs: packet(22, "password")},
+	} {
+		_, e := l.checkPacket(test.bs)
+		if e != test.err {
+			t.Error(idx, "excepted is", test.err, ", actual is", e)
+		}
+	}
+}
+
+func TestIPMIv1AuthCode(t *testing.T) {
+	data, _ := hex.DecodeString("2018c88104")
+	for _, test := range []struct {
+		authType uint8
+		excepted string
+	}{
+		{authType: AuthTypePassword, excepted: "70617373776f72640000000000000000"},
+		// MD5(password + session ID + data + sequence + password)
+		{authType: AuthTypeMD5, excepted: "f7795b8a7096da9a7c77f04643fc58ef"},
+	} {
+		authCode, e := IPMIv1AuthCode(test.authType, []byte("password"), 0x04030201, 0x08070605, data)
+		if e != nil {
+			t.Error(e)
+			continue
+		}
+		assertEquals(t, "AuthCode", hex.EncodeToString(authCode), test.excepted)
+	}
+
+	// test vectors of RFC 1319
+	for _, test := range []struct {
+		s        string
+		excepted string
+	}{
+		{s: "", excepted: "8350e5a3e24c153df2275c9f80692773"},
+		{s: "a", excepted: "32ec01ec4a6dac72c0ab96fb34c0b5d1"},
+		{s: "abc", excepted: "da853b0d3f88d99b30283a69e6ded6bb"},
+		{s: "message digest", excepted: "ab4f496bfb2a530b219ff33031fe06b0"},
+		{s: "12345678901234567890123456789012345678901234567890123456789012345678901234567890", excepted: "d5976f79d83d3a0dc9806c3c66f3efd8"},
+	} {
+		sum := md2Sum([]byte(test.s))
+		assertEquals(t, "MD2("+test.s+")", hex.EncodeToString(sum[:]), test.excepted)
+	}
+}
+
+// expire drops the session of the BMC, the requests in the dropped session
+// are answered with code, or without session if rebooted, or never if code
+// is CommandCompleted and not rebooted.
+func (bmc *fakeBMCv15) expire(code CompletionCode, rebooted bool) {
+	bmc.mu.Lock()
+	defer bmc.mu.Unlock()
+	bmc.active = false
+	bmc.expired = code
+	bmc.rebooted = rebooted
+	bmc.dropped = code == CommandCompleted && !rebooted
+}
+
+func (bmc *fakeBMCv15) sessionCount() int {
+	bmc.mu.Lock()
+	defer bmc.mu.Unlock()
+	return bmc.sessions
+}
+
+func TestClientReconnect(t *testing.T) {
+	for _, test := range []struct {
+		code     CompletionCode
+		rebooted bool
+		cause    error
+		noReplay bool
+	}{
+		{rebooted: true, cause: ErrSessionID},
+		{cause: ErrTimeout},
+		{code: ErrPrivLevel, cause: ErrPrivLevel},
+		{code: ErrInvalidState, cause: ErrInvalidState},
+		{rebooted: true, cause: ErrSessionID, noReplay: true},
+		{code: ErrPrivLevel, cause: ErrPrivLevel, noReplay: true},
+	} {
+		bmc := newFakeBMCv15(t, AuthTypeMD5, "password")
+		defer bmc.conn.Close()
+
+		var causes, errs []error
+		opt := bmc.option("password")
+		opt.Reconnect = true
+		opt.NoReplay = test.noReplay
+		opt.OnReconnect = func(cause, err error) {
+			causes = append(causes, cause)
+			errs = append(errs, err)
+		}
+
+		c, e := NewClient(opt)
+		if e != nil {
+			t.Error(e)
+			continue
+		}
+		if e := c.Open(); e != nil {
+			t.Error(e)
+			continue
+		}
+
+		bmc.expire(test.code, test.rebooted)
+
+		// the request is replayed once in the new session
+		var req = SessionPrivilegeLevelRequest{PrivLevel: uint8(commands.PrivLevelOperator)}
+		var resp SessionPrivilegeLevelResponse
+		e = c.Exec(commands.SetSessionPrivilegeLevel, &req, &resp)
+		requests := 3 // Set Session Privilege Level of the sessions and the replayed one
+		if test.noReplay {
+			if e != test.cause {
+				t.Error("excepted is", test.cause, ", actual is", e)
+			}
+			requests = 2
+		} else if e != nil {
+			t.Error(e)
+		}
+		assertEquals(t, "sessions", bmc.sessionCount(), 2)
+		assertEquals(t, "causes", causes, []error{test.cause})
+		assertEquals(t, "errs", errs, []error{nil})
+		_, _, sequences := bmc.check(t)
+		assertEquals(t, "requests", len(sequences), requests)
+
+		if e := c.Exec(commands.SetSessionPrivilegeLevel, &req, &resp); e != nil {
+			t.Error(e)
+		}
+		assertEquals(t, "NewPrivilegeLevel", resp.NewPrivilegeLevel, uint8(commands.PrivLevelOperator))
+
+		c.Close()
+		bmc.check(t)
+	}
+}
+
+func TestClientReconnectDisabled(t *testing.T) {
+	bmc := newFakeBMCv15(t, AuthTypeMD5, "password")
+	defer bmc.conn.Close()
+
+	c, e := NewClient(bmc.option("password"))
+	if e != nil {
+		t.Error(e)
+		return
+	}
+	if e := c.Open(); e != nil {
+		t.Error(e)
+		return
+	}
+	defer c.Close()
+
+	bmc.expire(ErrPrivLevel, false)
+
+	var req = SessionPrivilegeLevelRequest{PrivLevel: uint8(commands.PrivLevelOperator)}
+	var resp SessionPrivilegeLevelResponse
+	if e := c.Exec(commands.SetSessionPrivilegeLevel, &req, &resp); e != ErrPrivLevel {
+		t.Error("excepted is", ErrPrivLevel, ", actual is", e)
+	}
+	assertEquals(t, "sessions", bmc.sessionCount(), 1)
+}
+
+func TestClientReconnectCompletionCode(t *testing.T) {
+	for _, code := range []CompletionCode{ErrPrivLevel, ErrInvalidState} {
+		bmc := newFakeBMCv15(t, AuthTypeMD5, "password")
+		defer bmc.conn.Close()
+
+		opt := bmc.option("password")
+		opt.Reconnect = true
+		c, e := NewClient(opt)
+		if e != nil {
+			t.Error(e)
+			continue
+		}
+		if e := c.Open(); e != nil {
+			t.Error(e)
+			continue
+		}
+
+		// the command is rejected, but Get Session Info shows the session
+		// is alive
+		bmc.mu.Lock()
+		bmc.rejected = code
+		bmc.mu.Unlock()
+		var req = SessionPrivilegeLevelRequest{PrivLevel: uint8(commands.PrivLevelOperator)}
+		var resp SessionPrivilegeLevelResponse
+		if e := c.Exec(commands.SetSessionPrivilegeLevel, &req, &resp); e != code {
+			t.Error("excepted is", code, ", actual is", e)
+		}
+		assertEquals(t, "sessions", bmc.sessionCount(), 1)
+		c.Close()
+	}
+}
+
+func TestClientReconnectSessionAlive(t *testing.T) {
+	bmc := newFakeBMCv15(t, AuthTypeMD5, "password")
+	defer bmc.conn.Close()
+
+	reconnected := 0
+	opt := bmc.option("password")
+	opt.Retries = 1
+	opt.Reconnect = true
+	opt.OnReconnect = func(cause, err error) {
+		reconnected++
+	}
+	c, e := NewClient(opt)
+	if e != nil {
+		t.Error(e)
+		return
+	}
+	if e := c.Open(); e != nil {
+		t.Error(e)
+		return
+	}
+	defer c.Close()
+
+	// the request is lost, but Get Session Info shows the session is alive
+	bmc.mu.Lock()
+	bmc.lost = 2
+	bmc.mu.Unlock()
+	var req = SessionPrivilegeLevelRequest{PrivLevel: uint8(commands.PrivLevelOperator)}
+	var resp SessionPrivilegeLevelResponse
+	if e := c.Exec(commands.SetSessionPrivilegeLevel, &req, &resp); e != ErrTimeout {
+		t.Error("excepted is", ErrTimeout, ", actual is", e)
+	}
+	assertEquals(t, "sessions", bmc.sessionCount(), 1)
+	assertEquals(t, "reconnected", reconnected, 0)
+}
+
+func TestClientKeepAlive(t *testing.T) {
+	bmc := newFakeBMCv15(t, AuthTypeMD5, "password")
+	defer bmc.conn.Close()
+
+	reconnected := make(chan error, 1)
+	opt := bmc.option("password")
+	opt.KeepAlive = 20 * time.Millisecond
+	opt.Reconnect = true
+	opt.OnReconnect = func(cause, err error) {
+		reconnected <- err
+	}
+
+	c, e := NewClient(opt)
+	if e != nil {
+		t.Error(e)
+		return
+	}
+	if e := c.Open(); e != nil {
+		t.Error(e)
+		return
+	}
+
+	bmc.expire(CommandCompleted, true)
+	select {
+	case e := <-reconnected:
+		if e != nil {
+			t.Error(e)
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("session isn't re-established by the keepalive")
+	}
+	c.Close()
+
+	bmc.check(t)
+	assertEquals(t, "sessions", bmc.sessionCount(), 2)
+	_, _, sequences := bmc.check(t)
+	if len(sequences) < 3 { // Set Session Privilege Level, Get Session Info, ...
+		t.Error("keepalive isn't sent,", sequences)
+	}
+}
+
+func TestClientKeepAliveReopen(t *testing.T) {
+	bmc := newFakeBMCv15(t, AuthTypeMD5, "password")
+	defer bmc.conn.Close()
+
+	opt := bmc.option("password")
+	opt.KeepAlive = 10 * time.Millisecond
+	c, e := NewClient(opt)
+	if e != nil {
+		t.Error(e)
+		return
+	}
+	if e := c.Open(); e != nil {
+		t.Error(e)
+		return
+	}
+	first := c.keepAliveDone
+	if e := c.Open(); e != nil {
+		t.Error(e)
+		return
+	}
+
+	// the keepalive of the first Open is stopped by the second one
+	select {
+	case <-first:
+	default:
+		t.Error("the first keepalive is running")
+	}
+	second := c.keepAliveDone
+	c.Close()
+	select {
+	case <-second:
+	default:
+		t.Error("the second keepalive is running")
+	}
+}
+
+func TestClientExecTarget(t *testing.T) {
+	var getSensorReading = commands.CommandCode{Name: "Get Sensor Reading", NetworkFunction: commands.NetworkFunctionSensor, Code: 0x2d}
+
+	for _, test := range []struct {
+		target  Target
+		delayed bool
+		err     error
+	}{
+		{target: Target{Address: 0x2c}},
+		{target: Target{Address: 0x2c, LUN: 1}, delayed: true},
+		{target: Target{Address: 0x2c, Channel: 7, TransitAddress: 0x82, TransitChannel: 6}},
+		{target: Target{Address: 0x2c, Channel: 7, TransitAddress: 0x82, TransitChannel: 6}, delayed: true},
+		{target: Target{Address: 0x2e}, err: ErrDestUnavail},
+		{target: Target{Address: 0x2e, TransitAddress: 0x82}, delayed: true, err: ErrDestUnavail},
+	} {
+		bmc := newFakeBMCv15(t, AuthTypeMD5, "password")
+		defer bmc.conn.Close()
+		bmc.mu.Lock()
+		bmc.delayed = test.delayed
+		bmc.mu.Unlock()
+
+		c, e := NewClient(bmc.option("password"))
+		if e != nil {
+			t.Error(e)
+			continue
+		}
+		if e := c.Open(); e != nil {
+			t.Error(e)
+			continue
+		}
+
+		var req = struct{ Number uint8 }{Number: 0x05}
+		var resp struct{ Reading, Status, State uint8 }
+		e = c.ExecTarget(test.target, getSensorReading, &req, &resp)
+		if e != test.err {
+			t.Error("excepted is", test.err, ", actual is", e)
+		}
+		if test.err == nil {
+			assertEquals(t, "Reading", resp.Reading, uint8(0x35))
+			assertEquals(t, "Status", resp.Status, uint8(0xc0))
+		}
+
+		c.Close()
+		bmc.check(t)
+	}
+}
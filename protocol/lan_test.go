@@ -2,9 +2,13 @@ package protocol
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"net"
 	"reflect"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/runner-mei/goipmi/protocol/commands"
 )
@@ -183,3 +187,420 @@ func TestIPMIV1AuthCapabilitiesResponse(t *testing.T) {
 		return
 	}
 }
+
+func TestLanOpenContextDeadline(t *testing.T) {
+	conn, e := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+	if nil != e {
+		t.Error(e)
+		return
+	}
+	defer conn.Close()
+
+	_, sport, _ := net.SplitHostPort(conn.LocalAddr().String())
+	port, _ := strconv.Atoi(sport)
+
+	l := newLan(&ConnectionOption{Hostname: "127.0.0.1",
+		Port:      port,
+		Username:  "Administrator",
+		Password:  "123456abc",
+		Interface: "lan"})
+	defer l.close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	e = l.open(ctx)
+	if e != context.DeadlineExceeded {
+		t.Error("excepted is", context.DeadlineExceeded)
+		t.Error("actual   is", e)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Error("open isn't interrupted by deadline, elapsed", elapsed)
+	}
+}
+
+func TestLanSendContextCancel(t *testing.T) {
+	conn, e := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+	if nil != e {
+		t.Error(e)
+		return
+	}
+	defer conn.Close()
+
+	l := newLan(&ConnectionOption{Interface: "lan"})
+	l.conn_opt.Hostname, l.conn_opt.Port = "127.0.0.1", conn.LocalAddr().(*net.UDPAddr).Port
+	if e := l.dial(context.Background()); e != nil {
+		t.Error(e)
+		return
+	}
+	defer l.close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+
+	var req AuthCapabilitiesRequest
+	var resp AuthCapabilitiesResponse
+	start := time.Now()
+	e = l.exec(ctx, commands.GetChannelAuthenticationCapabilities, &req, &resp)
+	if e != context.Canceled {
+		t.Error("excepted is", context.Canceled)
+		t.Error("actual   is", e)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Error("exec isn't interrupted by cancel, elapsed", elapsed)
+	}
+}
+
+// replyAuthCapabilities answers the Get Channel Authentication Capabilities
+// request in bs with the given rqSeq, the channel number is echoed back if
+// data is nil.
+func replyAuthCapabilities(conn *net.UDPConn, addr net.Addr, bs []byte, rqSeq uint8, data *AuthCapabilitiesResponse) error {
+	var reqData AuthCapabilitiesRequest
+	var req = Request{Data: &reqData}
+
+	var r Reader
+	r.Init(bs)
+	new(RMCPHeader).ReadBytes(&r)
+	new(IPMIV1Header).ReadBytes(&r)
+	req.ReadBytes(&r)
+	if e := r.Err(); e != nil {
+		return e
+	}
+
+	if data == nil {
+		data = &AuthCapabilitiesResponse{ChannelNumber: reqData.ChannelNumber, AuthTypeSupport: 0x80}
+	}
+
+	resp := Response{Body: IPMIBody{RsAddr: req.Body.RqAddr,
+		NetFnRsLUN: (req.Body.NetFnRsLUN>>2 | 1) << 2,
+		RqAddr:     req.Body.RsAddr,
+		RqSeq:      rqSeq,
+		Cmd:        req.Body.Cmd},
+		Data: data}
+
+	w := Writer{}
+	w.Init(nil)
+	(&RMCPHeader{Version: rmcpVersion1, Class: rmcpClassIPMI, RMCPSequenceNumber: 0xff}).WriteBytes(&w)
+	(&IPMIV1Header{}).WriteBytes(&w)
+	old_length := w.Len()
+	resp.WriteBytes(&w)
+	if e := w.Err(); e != nil {
+		return e
+	}
+	w.Bytes()[old_length-1] = uint8(w.Len() - old_length)
+
+	_, e := conn.WriteTo(w.Bytes(), addr)
+	return e
+}
+
+func TestLanRetransmit(t *testing.T) {
+	conn, e := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+	if nil != e {
+		t.Error(e)
+		return
+	}
+	defer conn.Close()
+
+	received := make(chan [][]byte, 1)
+	go func() {
+		var packets [][]byte
+		defer func() { received <- packets }()
+
+		buf := make([]byte, 1024)
+		for i := 0; i < 2; i++ {
+			n, addr, e := conn.ReadFrom(buf)
+			if e != nil {
+				return
+			}
+			packets = append(packets, append([]byte(nil), buf[:n]...))
+			if i == 0 {
+				continue // drop the first request
+			}
+
+			rqSeq := packets[0][18] // rmcp(4) + session(10) + RsAddr, NetFn, Checksum, RqAddr
+			// a late response of a previous request must be dropped
+			if e := replyAuthCapabilities(conn, addr, buf[:n], rqSeq-4, nil); e != nil {
+				return
+			}
+			if e := replyAuthCapabilities(conn, addr, buf[:n], rqSeq, nil); e != nil {
+				return
+			}
+		}
+	}()
+
+	l := newLan(&ConnectionOption{Interface: "lan",
+		Timeout: 100 * time.Millisecond,
+		Retries: 2,
+		Backoff: 2})
+	l.conn_opt.Hostname, l.conn_opt.Port = "127.0.0.1", conn.LocalAddr().(*net.UDPAddr).Port
+	if e := l.dial(context.Background()); e != nil {
+		t.Error(e)
+		return
+	}
+	defer l.close()
+
+	var req = AuthCapabilitiesRequest{ChannelNumber: 2}
+	var resp AuthCapabilitiesResponse
+	if e := l.exec(context.Background(), commands.GetChannelAuthenticationCapabilities, &req, &resp); e != nil {
+		t.Error(e)
+		return
+	}
+	assertEquals(t, "resp.ChannelNumber", resp.ChannelNumber, uint8(2))
+
+	packets := <-received
+	if len(packets) != 2 {
+		t.Error("excepted 2 packets, actual is", len(packets))
+		return
+	}
+	assertEquals(t, "retransmitted", packets[1], packets[0])
+}
+
+func TestLanRetriesExhausted(t *testing.T) {
+	conn, e := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+	if nil != e {
+		t.Error(e)
+		return
+	}
+	defer conn.Close()
+
+	l := newLan(&ConnectionOption{Interface: "lan",
+		Timeout:    50 * time.Millisecond,
+		Retries:    2,
+		Backoff:    4,
+		MaxTimeout: 100 * time.Millisecond})
+	l.conn_opt.Hostname, l.conn_opt.Port = "127.0.0.1", conn.LocalAddr().(*net.UDPAddr).Port
+	if e := l.dial(context.Background()); e != nil {
+		t.Error(e)
+		return
+	}
+	defer l.close()
+
+	var req AuthCapabilitiesRequest
+	var resp AuthCapabilitiesResponse
+	start := time.Now()
+	e = l.exec(context.Background(), commands.GetChannelAuthenticationCapabilities, &req, &resp)
+	if e != ErrTimeout {
+		t.Error("excepted is", ErrTimeout)
+		t.Error("actual   is", e)
+	}
+	// 50ms + 100ms + 100ms
+	if elapsed := time.Since(start); elapsed < 250*time.Millisecond || elapsed > 2*time.Second {
+		t.Error("unexcepted elapsed", elapsed)
+	}
+
+	_ = conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	count := 0
+	buf := make([]byte, 1024)
+	for {
+		if _, _, e := conn.ReadFrom(buf); e != nil {
+			break
+		}
+		count++
+	}
+	assertEquals(t, "attempts", count, 3)
+}
+
+func TestConnectionOptionRetries(t *testing.T) {
+	// a request is sent up to 3 times by default
+	assertEquals(t, "default", (&ConnectionOption{}).retries(), 2)
+	assertEquals(t, "disabled", (&ConnectionOption{Retries: -1}).retries(), 0)
+	assertEquals(t, "retries", (&ConnectionOption{Retries: 5}).retries(), 5)
+}
+
+func TestLanConcurrentExec(t *testing.T) {
+	conn, e := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+	if nil != e {
+		t.Error(e)
+		return
+	}
+	defer conn.Close()
+
+	const count = 4
+
+	go func() {
+		var packets [][]byte
+		var addr net.Addr
+		buf := make([]byte, 1024)
+		for len(packets) < count {
+			n, raddr, e := conn.ReadFrom(buf)
+			if e != nil {
+				return
+			}
+			addr = raddr
+			packets = append(packets, append([]byte(nil), buf[:n]...))
+		}
+
+		// answer in reverse order
+		for i := len(packets) - 1; i >= 0; i-- {
+			if e := replyAuthCapabilities(conn, addr, packets[i], packets[i][18], nil); e != nil {
+				return
+			}
+		}
+	}()
+
+	l := newLan(&ConnectionOption{Interface: "lan",
+		Timeout: 2 * time.Second,
+		Window:  count})
+	l.conn_opt.Hostname, l.conn_opt.Port = "127.0.0.1", conn.LocalAddr().(*net.UDPAddr).Port
+	if e := l.dial(context.Background()); e != nil {
+		t.Error(e)
+		return
+	}
+	defer l.close()
+
+	errs := make(chan error, count)
+	for i := 0; i < count; i++ {
+		go func(channel uint8) {
+			var req = AuthCapabilitiesRequest{ChannelNumber: channel}
+			var resp AuthCapabilitiesResponse
+			if e := l.exec(context.Background(), commands.GetChannelAuthenticationCapabilities, &req, &resp); e != nil {
+				errs <- e
+				return
+			}
+			if resp.ChannelNumber != channel {
+				errs <- fmt.Errorf("excepted channel is %d, actual is %d", channel, resp.ChannelNumber)
+				return
+			}
+			errs <- nil
+		}(uint8(i + 1))
+	}
+
+	for i := 0; i < count; i++ {
+		if e := <-errs; e != nil {
+			t.Error(e)
+		}
+	}
+}
+
+func TestNegotiateInterface(t *testing.T) {
+	for _, test := range []struct {
+		data     *AuthCapabilitiesResponse
+		excepted string
+	}{
+		{data: &AuthCapabilitiesResponse{ChannelNumber: 0x81, AuthTypeSupport: 0x96, Status: 0x14, Reserved: 0x03}, excepted: "lanplus"},
+		{data: &AuthCapabilitiesResponse{ChannelNumber: 0x01, AuthTypeSupport: 0x16, Status: 0x14, Reserved: 0x00}, excepted: "lan"},
+	} {
+		conn, e := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 0})
+		if nil != e {
+			t.Error(e)
+			return
+		}
+
+		go func(data *AuthCapabilitiesResponse) {
+			buf := make([]byte, 1024)
+			n, addr, e := conn.ReadFrom(buf)
+			if e != nil {
+				return
+			}
+			assertEquals(t, "req.ChannelNumber", buf[20], uint8(0x8e))
+			replyAuthCapabilities(conn, addr, buf[:n], buf[18], data)
+		}(test.data)
+
+		c, e := NewClient(&ConnectionOption{Hostname: "127.0.0.1",
+			Port:      conn.LocalAddr().(*net.UDPAddr).Port,
+			Interface: "auto",
+			Timeout:   time.Second})
+		if e != nil {
+			t.Error(e)
+			conn.Close()
+			return
+		}
+
+		iface, e := negotiateInterface(context.Background(), c.ConnectionOption)
+		conn.Close()
+		if e != nil {
+			t.Error(e)
+			return
+		}
+		assertEquals(t, "interface", iface, test.excepted)
+	}
+}
+
+func TestLanIPv6(t *testing.T) {
+	conn, e := net.ListenUDP("udp6", &net.UDPAddr{IP: net.IPv6loopback, Port: 0})
+	if nil != e {
+		t.Skip("IPv6 is unavailable,", e)
+		return
+	}
+	defer conn.Close()
+
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, addr, e := conn.ReadFrom(buf)
+			if e != nil {
+				return
+			}
+			replyAuthCapabilities(conn, addr, buf[:n], buf[18], nil)
+		}
+	}()
+
+	for _, hostname := range []string{"::1", "[::1]"} {
+		l := newLan(&ConnectionOption{Hostname: hostname,
+			Port:      conn.LocalAddr().(*net.UDPAddr).Port,
+			Interface: "lan",
+			Timeout:   time.Second})
+		if e := l.dial(context.Background()); e != nil {
+			t.Error(hostname, e)
+			continue
+		}
+
+		var req = AuthCapabilitiesRequest{ChannelNumber: 1}
+		var resp AuthCapabilitiesResponse
+		if e := l.exec(context.Background(), commands.GetChannelAuthenticationCapabilities, &req, &resp); e != nil {
+			t.Error(hostname, e)
+		} else {
+			assertEquals(t, "resp.ChannelNumber", resp.ChannelNumber, uint8(1))
+		}
+		l.close()
+
+		assertEquals(t, "RemoteIP", l.conn_opt.RemoteIP(), "::1")
+		assertEquals(t, "LocalIP", l.conn_opt.LocalIP(), "::1")
+	}
+}
+
+func TestResolveUDPAddr(t *testing.T) {
+	for _, test := range []struct {
+		hostname string
+		ip       net.IP
+		zone     string
+	}{
+		{hostname: "192.168.1.2", ip: net.ParseIP("192.168.1.2")},
+		{hostname: "2001:db8::2", ip: net.ParseIP("2001:db8::2")},
+		{hostname: "[2001:db8::2]", ip: net.ParseIP("2001:db8::2")},
+		{hostname: "fe80::2%eth0", ip: net.ParseIP("fe80::2"), zone: "eth0"},
+		{hostname: "[fe80::2%eth0]", ip: net.ParseIP("fe80::2"), zone: "eth0"},
+	} {
+		opt := ConnectionOption{Hostname: test.hostname, Port: 623}
+		addr, e := opt.resolveUDPAddr(context.Background())
+		if e != nil {
+			t.Error(test.hostname, e)
+			continue
+		}
+		assertEquals(t, test.hostname+".IP", addr.IP, test.ip)
+		assertEquals(t, test.hostname+".Zone", addr.Zone, test.zone)
+		assertEquals(t, test.hostname+".Port", addr.Port, 623)
+	}
+
+	// the hostname is resolved within the ctx
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, e := (&ConnectionOption{Hostname: "bmc.invalid", Port: 623}).resolveUDPAddr(ctx); e == nil {
+		t.Error("excepted is canceled error")
+	}
+
+	addrs := []net.IPAddr{{IP: net.ParseIP("192.168.1.2")}, {IP: net.ParseIP("2001:db8::2")}}
+	addr, _ := pickIPAddr(addrs, false)
+	assertEquals(t, "prefer ipv4", addr.IP, addrs[0].IP)
+	addr, _ = pickIPAddr(addrs, true)
+	assertEquals(t, "prefer ipv6", addr.IP, addrs[1].IP)
+	addr, _ = pickIPAddr(addrs[:1], true)
+	assertEquals(t, "ipv4 only", addr.IP, addrs[0].IP)
+	if _, ok := pickIPAddr(nil, true); ok {
+		t.Error("no address must be picked")
+	}
+}
@@ -16,6 +16,7 @@ const (
 var ErrNotIPMIV2 = errors.New("IPMI message version isn't v2.")
 var NullAuthCode = make([]byte, 16)
 var ErrInvalidAuthCode = errors.New("AuthCode is invalid format.")
+var ErrSequenceNumber = errors.New("session sequence number is out of window.")
 
 type IPMIV1Header struct {
 	AuthType  uint8
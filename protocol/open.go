@@ -0,0 +1,265 @@
+package protocol
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"time"
+)
+
+// Address types and receive types of the OpenIPMI driver per linux/ipmi.h.
+const (
+	ipmiSystemInterfaceAddrType = 0x0c
+	ipmiIPMBAddrType            = 0x01
+	ipmiBMCChannel              = 0x0f
+
+	ipmiResponseRecvType   = 1
+	ipmiAsyncEventRecvType = 2
+	ipmiCmdRecvType        = 3
+)
+
+// ipmiDevicePaths are the character devices of the OpenIPMI driver, they are
+// tried in order unless ConnectionOption.Device is given.
+var ipmiDevicePaths = []string{"/dev/ipmi0", "/dev/ipmi/0", "/dev/ipmidev/0"}
+
+// ErrDualBridging is returned by the open interface for dual bridged requests,
+// the OpenIPMI driver only addresses controllers on the IPMB of the BMC.
+var ErrDualBridging = errors.New("dual bridging is unsupported by the open interface.")
+
+// ipmiAddr is the address of a message of the OpenIPMI driver, it is the
+// system interface of the BMC or a controller on a IPMB channel.
+type ipmiAddr struct {
+	addrType  int32
+	channel   int16
+	slaveAddr uint8 // only for ipmiIPMBAddrType
+	lun       uint8
+}
+
+// ipmiMessage is a message sent to or received from the OpenIPMI driver, the
+// data of a response starts with the completion code.
+type ipmiMessage struct {
+	recvType int32 // only for the received messages
+	addr     ipmiAddr
+	msgid    int64
+	netfn    uint8
+	cmd      uint8
+	data     []byte
+}
+
+// ipmiDevice is the character device of the OpenIPMI driver.
+type ipmiDevice interface {
+	// send sends the request with IPMICTL_SEND_COMMAND.
+	send(msg *ipmiMessage) error
+	// receive receives a message with IPMICTL_RECEIVE_MSG_TRUNC, it waits
+	// until the deadline or ctx is done and returns ErrTimeout if no message
+	// is received.
+	receive(ctx context.Context, deadline time.Time) (*ipmiMessage, error)
+	close() error
+}
+
+// openIPMIDevice opens the character device at path, it is replaced by the
+// tests.
+var openIPMIDevice = openDevice
+
+// openIPMI is the "open" interface that sends the requests to the BMC of the
+// local host by the OpenIPMI driver, no session and credentials are needed.
+type openIPMI struct {
+	conn_opt *ConnectionOption
+
+	mu     sync.Mutex // held while a request is outstanding
+	device ipmiDevice
+	msgid  int64
+}
+
+func newOpenIPMI(c *ConnectionOption) *openIPMI {
+	return &openIPMI{conn_opt: c}
+}
+
+func (l *openIPMI) open(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.device != nil {
+		return nil
+	}
+
+	paths := ipmiDevicePaths
+	if l.conn_opt.Device != "" {
+		paths = []string{l.conn_opt.Device}
+	}
+
+	var err error
+	for _, path := range paths {
+		var device ipmiDevice
+		device, err = openIPMIDevice(path)
+		if err == nil {
+			l.device = device
+			return nil
+		}
+		if !os.IsNotExist(err) {
+			break
+		}
+	}
+	return errors.New("could not open the OpenIPMI device, " + err.Error())
+}
+
+// openSession does nothing, the driver has no session.
+func (l *openIPMI) openSession(ctx context.Context) error {
+	return nil
+}
+
+func (l *openIPMI) close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.device == nil {
+		return nil
+	}
+	err := l.device.close()
+	l.device = nil
+	return err
+}
+
+func (l *openIPMI) isConnected() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.device != nil
+}
+
+func (l *openIPMI) send(ctx context.Context, req, resp interface{}) error {
+	return l.sendExt(ctx, req.(*Request), resp.(*Response))
+}
+
+func (l *openIPMI) sendExt(ctx context.Context, req *Request, resp *Response) error {
+	// a Send Message request is addressed to the IPMB controller directly,
+	// the driver encapsulates it and waits for the bridged response.
+	inner, bridged := req, false
+	innerResp := resp
+	if sm, ok := req.Data.(*SendMessageRequest); ok {
+		if _, ok := sm.Message.Data.(*SendMessageRequest); ok {
+			return ErrDualBridging
+		}
+		smResp, ok := resp.Data.(*SendMessageResponse)
+		if !ok {
+			return errors.New("response of Send Message is invalid.")
+		}
+		inner, innerResp, bridged = sm.Message, smResp.Message, true
+	}
+
+	msg, err := openIPMIRequest(inner)
+	if err != nil {
+		return err
+	}
+	if bridged {
+		msg.addr = ipmiAddr{addrType: ipmiIPMBAddrType,
+			channel:   int16(req.Data.(*SendMessageRequest).Channel & 0x0f),
+			slaveAddr: inner.Body.RsAddr,
+			lun:       inner.Body.NetFnRsLUN & 0x03}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.device == nil {
+		return ErrNotOpen
+	}
+
+	reply, err := l.exchange(ctx, msg)
+	if err != nil {
+		return err
+	}
+	if err := openIPMIResponse(inner, innerResp, reply); err != nil {
+		return err
+	}
+	if bridged {
+		resp.Body = IPMIBody{RsAddr: req.Body.RqAddr,
+			NetFnRsLUN: (req.Body.NetFnRsLUN>>2 | 1) << 2,
+			RqAddr:     req.Body.RsAddr,
+			RqSeq:      req.Body.RqSeq,
+			Cmd:        req.Body.Cmd}
+		resp.CompletionCode = CommandCompleted
+		resp.Data.(*SendMessageResponse).received = true
+	}
+	return nil
+}
+
+// exchange sends msg with a new msgid and waits for the response with the
+// same msgid, the other messages such as asynchronous events are discarded.
+// The request is sent again after a timeout according to the Retries and
+// Backoff options. l.mu must be held.
+func (l *openIPMI) exchange(ctx context.Context, msg *ipmiMessage) (*ipmiMessage, error) {
+	timeout := l.conn_opt.attemptTimeout()
+	for attempt := 0; ; attempt++ {
+		l.msgid++
+		msg.msgid = l.msgid
+		if err := l.device.send(msg); err != nil {
+			return nil, err
+		}
+
+		deadline := time.Now().Add(timeout)
+		for {
+			reply, err := l.device.receive(ctx, deadline)
+			if err != nil {
+				if ctxErr := ctx.Err(); ctxErr != nil {
+					return nil, ctxErr
+				}
+				if err == ErrTimeout {
+					break
+				}
+				return nil, err
+			}
+			if reply.recvType == ipmiResponseRecvType && reply.msgid == msg.msgid {
+				return reply, nil
+			}
+		}
+
+		if attempt >= l.conn_opt.retries() {
+			return nil, ErrTimeout
+		}
+		timeout = l.conn_opt.nextTimeout(timeout)
+	}
+}
+
+// openIPMIRequest converts req to a message to the system interface of the
+// BMC, the data is req.Data without the IPMI message header and checksum.
+func openIPMIRequest(req *Request) (*ipmiMessage, error) {
+	w := Writer{}
+	w.Init(make([]byte, 0, 64))
+	req.WriteBytes(&w)
+	if err := w.Err(); err != nil {
+		return nil, err
+	}
+	bs := w.Bytes()
+
+	return &ipmiMessage{
+		addr: ipmiAddr{addrType: ipmiSystemInterfaceAddrType,
+			channel: ipmiBMCChannel,
+			lun:     req.Body.NetFnRsLUN & 0x03},
+		netfn: req.Body.NetFnRsLUN >> 2,
+		cmd:   req.Body.Cmd,
+		data:  bs[IPMIBodySize : len(bs)-1],
+	}, nil
+}
+
+// openIPMIResponse unmarshals the response message of the driver to resp,
+// the IPMI message header and checksum are rebuilt from req so that resp is
+// read as the response from a LAN session.
+func openIPMIResponse(req *Request, resp *Response, reply *ipmiMessage) error {
+	if len(reply.data) == 0 {
+		return ErrInsufficientBytes
+	}
+
+	body := IPMIBody{RsAddr: req.Body.RqAddr,
+		NetFnRsLUN: reply.netfn<<2 | reply.addr.lun&0x03,
+		RqAddr:     req.Body.RsAddr,
+		RqSeq:      req.Body.RqSeq,
+		Cmd:        reply.cmd}
+
+	w := Writer{}
+	w.Init(make([]byte, 0, IPMIBodySize+len(reply.data)+1))
+	body.WriteBytes(&w)
+	w.WriteBytes(reply.data)
+	w.WriteUint8(checksum(body.RqAddr, body.RqSeq, body.Cmd) + checksumBytes(reply.data[1:]))
+
+	r := NewReader(w.Bytes())
+	resp.ReadBytes(r)
+	return r.Err()
+}
@@ -0,0 +1,186 @@
+//go:build linux && (386 || amd64 || arm || arm64 || loong64 || riscv64 || s390x)
+// +build linux
+// +build 386 amd64 arm arm64 loong64 riscv64 s390x
+
+package protocol
+
+import (
+	"context"
+	"os"
+	"runtime"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// ipmiIOCMagic is the ioctl type of the OpenIPMI driver.
+const ipmiIOCMagic = 'i'
+
+// ipmiMaxAddrSize is IPMI_MAX_ADDR_SIZE per linux/ipmi.h.
+const ipmiMaxAddrSize = 32
+
+// ipmiMaxMsgLength is the size of the receive buffer, it is larger than
+// IPMI_MAX_MSG_LENGTH so that the truncated messages are rare.
+const ipmiMaxMsgLength = 272
+
+// cIPMIAddr is struct ipmi_addr, struct ipmi_system_interface_addr and
+// struct ipmi_ipmb_addr share its layout.
+type cIPMIAddr struct {
+	addrType  int32
+	channel   int16
+	slaveAddr uint8 // lun of struct ipmi_system_interface_addr
+	lun       uint8
+	data      [ipmiMaxAddrSize - 2]uint8
+}
+
+// cIPMIMsg is struct ipmi_msg.
+type cIPMIMsg struct {
+	netfn   uint8
+	cmd     uint8
+	dataLen uint16
+	data    *uint8
+}
+
+// cIPMIReq is struct ipmi_req, msgid is a C long.
+type cIPMIReq struct {
+	addr    *cIPMIAddr
+	addrLen uint32
+	msgid   int
+	msg     cIPMIMsg
+}
+
+// cIPMIRecv is struct ipmi_recv, msgid is a C long.
+type cIPMIRecv struct {
+	recvType int32
+	addr     *cIPMIAddr
+	addrLen  uint32
+	msgid    int
+	msg      cIPMIMsg
+}
+
+// ioctl requests per linux/ipmi.h, _IOR is 2 and _IOWR is 3. ioc is the
+// generic _IOC layout, the architectures of another layout such as mips and
+// ppc64 aren't built.
+var (
+	ipmictlSendCommand     = ioc(2, 13, unsafe.Sizeof(cIPMIReq{}))
+	ipmictlReceiveMsgTrunc = ioc(3, 11, unsafe.Sizeof(cIPMIRecv{}))
+)
+
+func ioc(dir, nr, size uintptr) uintptr {
+	return dir<<30 | size<<16 | ipmiIOCMagic<<8 | nr
+}
+
+// linuxIPMIDevice is the OpenIPMI character device such as /dev/ipmi0.
+type linuxIPMIDevice struct {
+	file *os.File
+	conn syscall.RawConn
+}
+
+func openDevice(path string) (ipmiDevice, error) {
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := file.SyscallConn()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &linuxIPMIDevice{file: file, conn: conn}, nil
+}
+
+func (d *linuxIPMIDevice) send(msg *ipmiMessage) error {
+	addr := &cIPMIAddr{addrType: msg.addr.addrType,
+		channel: msg.addr.channel}
+	if msg.addr.addrType == ipmiIPMBAddrType {
+		addr.slaveAddr = msg.addr.slaveAddr
+		addr.lun = msg.addr.lun
+	} else {
+		addr.slaveAddr = msg.addr.lun
+	}
+
+	data := make([]byte, len(msg.data)+1) // never empty
+	copy(data, msg.data)
+	req := &cIPMIReq{addr: addr,
+		addrLen: 8, // the size of both struct ipmi_system_interface_addr and struct ipmi_ipmb_addr
+		msgid:   int(msg.msgid),
+		msg: cIPMIMsg{netfn: msg.netfn,
+			cmd:     msg.cmd,
+			dataLen: uint16(len(msg.data)),
+			data:    &data[0]}}
+
+	var errno syscall.Errno
+	err := d.conn.Control(func(fd uintptr) {
+		_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, fd, ipmictlSendCommand, uintptr(unsafe.Pointer(req)))
+	})
+	runtime.KeepAlive(addr)
+	runtime.KeepAlive(data)
+	if err != nil {
+		return err
+	}
+	if errno != 0 {
+		return os.NewSyscallError("ioctl IPMICTL_SEND_COMMAND", errno)
+	}
+	return nil
+}
+
+func (d *linuxIPMIDevice) receive(ctx context.Context, deadline time.Time) (*ipmiMessage, error) {
+	if err := d.file.SetReadDeadline(deadline); err != nil {
+		return nil, err
+	}
+	if ctx.Done() != nil {
+		stop := make(chan struct{})
+		defer close(stop)
+		go func() {
+			select {
+			case <-ctx.Done():
+				d.file.SetReadDeadline(time.Now())
+			case <-stop:
+			}
+		}()
+	}
+
+	addr := &cIPMIAddr{}
+	data := make([]byte, ipmiMaxMsgLength)
+	recv := &cIPMIRecv{addr: addr,
+		addrLen: uint32(unsafe.Sizeof(*addr)),
+		msg: cIPMIMsg{dataLen: uint16(len(data)),
+			data: &data[0]}}
+
+	var errno syscall.Errno
+	err := d.conn.Read(func(fd uintptr) bool {
+		_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, fd, ipmictlReceiveMsgTrunc, uintptr(unsafe.Pointer(recv)))
+		return errno != syscall.EAGAIN
+	})
+	runtime.KeepAlive(addr)
+	runtime.KeepAlive(data)
+	if err != nil {
+		if os.IsTimeout(err) {
+			return nil, ErrTimeout
+		}
+		return nil, err
+	}
+	// EMSGSIZE is returned with the truncated message
+	if errno != 0 && errno != syscall.EMSGSIZE {
+		return nil, os.NewSyscallError("ioctl IPMICTL_RECEIVE_MSG_TRUNC", errno)
+	}
+
+	msg := &ipmiMessage{recvType: recv.recvType,
+		addr: ipmiAddr{addrType: addr.addrType,
+			channel: addr.channel},
+		msgid: int64(recv.msgid),
+		netfn: recv.msg.netfn,
+		cmd:   recv.msg.cmd,
+		data:  data[:recv.msg.dataLen]}
+	if addr.addrType == ipmiIPMBAddrType {
+		msg.addr.slaveAddr = addr.slaveAddr
+		msg.addr.lun = addr.lun
+	} else {
+		msg.addr.lun = addr.slaveAddr
+	}
+	return msg, nil
+}
+
+func (d *linuxIPMIDevice) close() error {
+	return d.file.Close()
+}
@@ -0,0 +1,10 @@
+//go:build !(linux && (386 || amd64 || arm || arm64 || loong64 || riscv64 || s390x))
+// +build !linux !386,!amd64,!arm,!arm64,!loong64,!riscv64,!s390x
+
+package protocol
+
+import "errors"
+
+func openDevice(path string) (ipmiDevice, error) {
+	return nil, errors.New("the OpenIPMI driver is only available on linux of the generic ioctl layout.")
+}
@@ -0,0 +1,176 @@
+package protocol
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/runner-mei/goipmi/protocol/commands"
+)
+
+// fakeIPMIDevice is a OpenIPMI character device, handle returns the messages
+// received after the request.
+type fakeIPMIDevice struct {
+	handle func(msg *ipmiMessage) []*ipmiMessage
+
+	requests []*ipmiMessage
+	queue    []*ipmiMessage
+	closed   bool
+}
+
+func (d *fakeIPMIDevice) send(msg *ipmiMessage) error {
+	copied := *msg
+	copied.data = append([]byte{}, msg.data...)
+	d.requests = append(d.requests, &copied)
+	d.queue = append(d.queue, d.handle(&copied)...)
+	return nil
+}
+
+func (d *fakeIPMIDevice) receive(ctx context.Context, deadline time.Time) (*ipmiMessage, error) {
+	if len(d.queue) == 0 {
+		return nil, ErrTimeout
+	}
+	msg := d.queue[0]
+	d.queue = d.queue[1:]
+	return msg, nil
+}
+
+func (d *fakeIPMIDevice) close() error {
+	d.closed = true
+	return nil
+}
+
+func newFakeOpenIPMI(t *testing.T, opt *ConnectionOption, device *fakeIPMIDevice) *Client {
+	openIPMIDevice = func(path string) (ipmiDevice, error) {
+		return device, nil
+	}
+	opt.Interface = "open"
+	c, e := NewClient(opt)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if e := c.Open(); e != nil {
+		t.Fatal(e)
+	}
+	return c
+}
+
+// openIPMIReply returns the response of the driver to the request msg.
+func openIPMIReply(msg *ipmiMessage, data ...byte) *ipmiMessage {
+	return &ipmiMessage{recvType: ipmiResponseRecvType,
+		addr:  msg.addr,
+		msgid: msg.msgid,
+		netfn: msg.netfn | 1,
+		cmd:   msg.cmd,
+		data:  data}
+}
+
+func TestOpenIPMI(t *testing.T) {
+	defer func() { openIPMIDevice = openDevice }()
+
+	device := &fakeIPMIDevice{handle: func(msg *ipmiMessage) []*ipmiMessage {
+		stale := openIPMIReply(msg, 0xc3) // the response of a timed out request
+		stale.msgid--
+		return []*ipmiMessage{
+			{recvType: ipmiAsyncEventRecvType, addr: msg.addr, data: []byte{0x01}},
+			stale,
+			openIPMIReply(msg, 0x00, msg.data[0]+1, 0x02),
+		}
+	}}
+	c := newFakeOpenIPMI(t, &ConnectionOption{}, device)
+
+	var req = struct{ Value uint8 }{Value: 0x41}
+	var resp struct{ Value, Flags uint8 }
+	if e := c.Exec(commands.GetSessionInfo, &req, &resp); e != nil {
+		t.Error(e)
+	}
+	assertEquals(t, "Value", resp.Value, uint8(0x42))
+	assertEquals(t, "Flags", resp.Flags, uint8(0x02))
+
+	msg := device.requests[0]
+	assertEquals(t, "addr", msg.addr, ipmiAddr{addrType: ipmiSystemInterfaceAddrType, channel: ipmiBMCChannel})
+	assertEquals(t, "netfn", msg.netfn, uint8(commands.GetSessionInfo.NetworkFunction))
+	assertEquals(t, "cmd", msg.cmd, commands.GetSessionInfo.Code)
+	assertEquals(t, "data", msg.data, []byte{0x41})
+
+	device.handle = func(msg *ipmiMessage) []*ipmiMessage {
+		return []*ipmiMessage{openIPMIReply(msg, uint8(ErrInvalidCommand))}
+	}
+	if e := c.Exec(commands.GetSessionInfo, &req, &resp); e != ErrInvalidCommand {
+		t.Error("excepted is", ErrInvalidCommand, ", actual is", e)
+	}
+
+	c.Close()
+	assertEquals(t, "closed", device.closed, true)
+	assertEquals(t, "IsConnected", c.IsConnected(), false)
+}
+
+func TestOpenIPMITimeout(t *testing.T) {
+	defer func() { openIPMIDevice = openDevice }()
+
+	device := &fakeIPMIDevice{handle: func(msg *ipmiMessage) []*ipmiMessage {
+		return nil
+	}}
+	c := newFakeOpenIPMI(t, &ConnectionOption{Timeout: time.Millisecond, Retries: 2}, device)
+	defer c.Close()
+
+	var resp struct{ Value uint8 }
+	if e := c.Exec(commands.GetSessionInfo, []byte{0}, &resp); e != ErrTimeout {
+		t.Error("excepted is", ErrTimeout, ", actual is", e)
+	}
+	assertEquals(t, "requests", len(device.requests), 3)
+	assertEquals(t, "msgid", device.requests[2].msgid, int64(3))
+}
+
+func TestOpenIPMIBridged(t *testing.T) {
+	defer func() { openIPMIDevice = openDevice }()
+
+	device := &fakeIPMIDevice{handle: func(msg *ipmiMessage) []*ipmiMessage {
+		return []*ipmiMessage{openIPMIReply(msg, 0x00, 0x35, 0xc0, 0x00)}
+	}}
+	c := newFakeOpenIPMI(t, &ConnectionOption{}, device)
+	defer c.Close()
+
+	var resp struct{ Reading, Status, State uint8 }
+	if e := c.ExecTarget(Target{Address: 0x2c, Channel: 7, LUN: 1}, bridgedCommand, []byte{0x05}, &resp); e != nil {
+		t.Error(e)
+	}
+	assertEquals(t, "Reading", resp.Reading, uint8(0x35))
+	assertEquals(t, "Status", resp.Status, uint8(0xc0))
+
+	msg := device.requests[0]
+	assertEquals(t, "addr", msg.addr, ipmiAddr{addrType: ipmiIPMBAddrType, channel: 7, slaveAddr: 0x2c, lun: 1})
+	assertEquals(t, "netfn", msg.netfn, uint8(commands.NetworkFunctionSensor))
+	assertEquals(t, "cmd", msg.cmd, bridgedCommand.Code)
+	assertEquals(t, "data", msg.data, []byte{0x05})
+
+	e := c.ExecTarget(Target{Address: 0x2c, TransitAddress: 0x82}, bridgedCommand, []byte{0x05}, &resp)
+	assertEquals(t, "dual", e, ErrDualBridging)
+}
+
+func TestOpenIPMIDevicePaths(t *testing.T) {
+	defer func() { openIPMIDevice = openDevice }()
+
+	var paths []string
+	openIPMIDevice = func(path string) (ipmiDevice, error) {
+		paths = append(paths, path)
+		if path == "/dev/ipmi/0" {
+			return &fakeIPMIDevice{}, nil
+		}
+		return nil, &os.PathError{Op: "open", Path: path, Err: os.ErrNotExist}
+	}
+
+	l := newOpenIPMI(&ConnectionOption{})
+	if e := l.open(context.Background()); e != nil {
+		t.Error(e)
+	}
+	assertEquals(t, "paths", paths, []string{"/dev/ipmi0", "/dev/ipmi/0"})
+
+	paths = nil
+	l = newOpenIPMI(&ConnectionOption{Device: "/dev/ipmi1"})
+	if e := l.open(context.Background()); e == nil {
+		t.Error("excepted is error")
+	}
+	assertEquals(t, "paths", paths, []string{"/dev/ipmi1"})
+}
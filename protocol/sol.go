@@ -0,0 +1,541 @@
+package protocol
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/runner-mei/goipmi/protocol/commands"
+)
+
+// Operations of the remote console in the SOL packets per section 15.9.
+const (
+	SOLFlushOutbound  uint8 = 1 << 0 // drop the characters not sent to the remote console
+	SOLFlushInbound   uint8 = 1 << 1 // drop the characters not sent to the serial controller
+	SOLDeassertDCDDSR uint8 = 1 << 2
+	SOLDeassertCTS    uint8 = 1 << 3
+	SOLGenerateBreak  uint8 = 1 << 4
+	SOLRingWOR        uint8 = 1 << 5
+)
+
+// Status of the BMC in the SOL packets per section 15.9.
+const (
+	solNACK                    = 1 << 6
+	solCharTransferUnavailable = 1 << 5
+	solDeactivating            = 1 << 4
+	solTransmitOverrun         = 1 << 3
+	solBreakDetected           = 1 << 2
+)
+
+const (
+	solHeaderSize = 4
+
+	// solSerialAlertsDeferred defers the serial/modem alerts while SOL is
+	// active, it is the auxiliary data of Activate Payload.
+	solSerialAlertsDeferred = 0x04
+
+	solRetryInterval      = 500 * time.Millisecond
+	solRetries            = 7
+	solAccumulateInterval = 20 * time.Millisecond
+	solMaxPending         = 4096  // characters queued by Write
+	solMaxReadBuffer      = 65536 // characters received but not read
+	solBufferedPackets    = 16
+)
+
+var (
+	ErrSOLUnsupported = errors.New("SOL is only supported by the lanplus interface.")
+	ErrSOLActive      = errors.New("SOL payload is already active on another session.")
+	ErrSOLClosed      = errors.New("SOL payload is deactivated.")
+)
+
+// ActivatePayloadRequest per section 24.1
+type ActivatePayloadRequest struct {
+	PayloadType uint8
+	Instance    uint8
+	AuxData     [4]uint8
+}
+
+// ActivatePayloadResponse per section 24.1
+type ActivatePayloadResponse struct {
+	AuxData             [4]uint8
+	InboundPayloadSize  uint16 // the max size of the payloads sent to the BMC
+	OutboundPayloadSize uint16
+	PortNumber          uint16
+	VLANNumber          uint16
+}
+
+// DeactivatePayloadRequest per section 24.2
+type DeactivatePayloadRequest struct {
+	PayloadType uint8
+	Instance    uint8
+	AuxData     [4]uint8
+}
+
+// solPacket is the SOL payload per section 15.9, a packet with Sequence 0 is
+// a ACK-only packet and a packet with AckSequence 0 acknowledges nothing.
+type solPacket struct {
+	Sequence      uint8 // 1 to 15
+	AckSequence   uint8
+	AcceptedCount uint8
+	Status        uint8 // operation of the remote console or status of the BMC
+	Data          []byte
+}
+
+func (self *solPacket) WriteBytes(w *Writer) {
+	w.WriteUint8(self.Sequence)
+	w.WriteUint8(self.AckSequence)
+	w.WriteUint8(self.AcceptedCount)
+	w.WriteUint8(self.Status)
+	w.WriteBytes(self.Data)
+}
+
+func (self *solPacket) ReadBytes(r *Reader) {
+	self.Sequence = r.ReadUint8() & 0x0f
+	self.AckSequence = r.ReadUint8() & 0x0f
+	self.AcceptedCount = r.ReadUint8()
+	self.Status = r.ReadUint8()
+	self.Data = r.ReadCopy(r.Len())
+}
+
+// solWrite is the characters or the operations submitted to the SOL loop,
+// done receives the result once the characters are queued or the packet of
+// the operations is acknowledged.
+type solWrite struct {
+	data []byte
+	ops  uint8
+	done chan error
+}
+
+// SOLConn is the host serial console over a active SOL payload instance, it
+// is returned by Client.ActivateSOL. The characters written are accumulated
+// and sent in packets that are retransmitted until the BMC acknowledges them,
+// the characters received are acknowledged and buffered for Read.
+type SOLConn struct {
+	maxData    int
+	send       func(context.Context, *solPacket) error
+	decode     func([]byte) (*solPacket, error)
+	deactivate func() error
+
+	retryInterval      time.Duration
+	retries            int
+	accumulateInterval time.Duration
+
+	writes    chan *solWrite
+	closing   chan struct{} // closed by Close
+	done      chan struct{} // closed when run returns
+	ctx       context.Context
+	cancel    context.CancelFunc // cancels the packets sent when run returns
+	closeOnce sync.Once
+	closeErr  error
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	readBuf bytes.Buffer
+	err     error // why run returned, Read returns it once readBuf is empty
+
+	// the state below is owned by run
+	outSeq     uint8
+	inflight   *solPacket
+	acked      []*solWrite // the operations in the packet in flight
+	attempts   int
+	pending    []byte
+	pendingOps uint8
+	opWrites   []*solWrite // the operations not sent yet
+	queued     []*solWrite // the characters waiting for room in pending
+	lastInSeq  uint8
+	draining   bool
+}
+
+// newSOLConn returns a SOLConn that sends packets with up to
+// payloadSize-solHeaderSize characters, run must be started with the
+// received packets.
+func newSOLConn(payloadSize int, send func(context.Context, *solPacket) error, decode func([]byte) (*solPacket, error), deactivate func() error) *SOLConn {
+	s := &SOLConn{maxData: payloadSize - solHeaderSize,
+		send:               send,
+		decode:             decode,
+		deactivate:         deactivate,
+		retryInterval:      solRetryInterval,
+		retries:            solRetries,
+		accumulateInterval: solAccumulateInterval,
+		writes:             make(chan *solWrite),
+		closing:            make(chan struct{}),
+		done:               make(chan struct{})}
+	if s.maxData <= 0 || s.maxData > 255 {
+		s.maxData = 255 // the accepted character count is a byte
+	}
+	s.cond = sync.NewCond(&s.mu)
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	return s
+}
+
+// Read reads the characters from the serial console, it returns io.EOF
+// after the payload is deactivated and the received characters are read.
+func (s *SOLConn) Read(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for s.readBuf.Len() == 0 && s.err == nil {
+		s.cond.Wait()
+	}
+	if s.readBuf.Len() > 0 {
+		return s.readBuf.Read(p)
+	}
+	return 0, s.err
+}
+
+// Write queues the characters to the serial console, it blocks while too
+// many characters are not acknowledged by the BMC.
+func (s *SOLConn) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if err := s.submit(&solWrite{data: append([]byte(nil), p...), done: make(chan error, 1)}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Control sends the operations such as SOLGenerateBreak and SOLFlushInbound
+// to the BMC and waits for the acknowledgement, the queued characters are
+// sent first.
+func (s *SOLConn) Control(ops uint8) error {
+	return s.submit(&solWrite{ops: ops, done: make(chan error, 1)})
+}
+
+// SendBreak generates a break on the serial console.
+func (s *SOLConn) SendBreak() error {
+	return s.Control(SOLGenerateBreak)
+}
+
+// Flush drops the characters buffered by the BMC in both directions.
+func (s *SOLConn) Flush() error {
+	return s.Control(SOLFlushInbound | SOLFlushOutbound)
+}
+
+func (s *SOLConn) submit(w *solWrite) error {
+	select {
+	case s.writes <- w:
+	case <-s.done:
+		return s.writeErr()
+	}
+
+	select {
+	case err := <-w.done:
+		return err
+	case <-s.done:
+		select {
+		case err := <-w.done:
+			return err
+		default:
+			return s.writeErr()
+		}
+	}
+}
+
+func (s *SOLConn) writeErr() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err == io.EOF {
+		return ErrSOLClosed
+	}
+	return s.err
+}
+
+// Close sends the queued characters and deactivates the payload.
+func (s *SOLConn) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.closing)
+		<-s.done
+		err := s.deactivate()
+		if code, ok := err.(CompletionCode); ok && code == 0x80 {
+			err = nil // the payload is already deactivated by the BMC
+		}
+		s.closeErr = err
+	})
+	return s.closeErr
+}
+
+// run is the loop that owns the SOL state until the payload is deactivated
+// or the packets are not acknowledged.
+func (s *SOLConn) run(in <-chan []byte) {
+	defer close(s.done)
+	defer s.cancel()
+
+	retransmit := time.NewTimer(time.Hour)
+	retransmit.Stop()
+	accumulate := time.NewTimer(time.Hour)
+	accumulate.Stop()
+	accumulating := false
+	closing := s.closing
+
+	var err error
+	for err == nil {
+		select {
+		case bs := <-in:
+			err = s.receive(bs, retransmit)
+		case w := <-s.writes:
+			if s.draining {
+				w.done <- ErrSOLClosed
+				break
+			}
+			if w.ops != 0 {
+				s.pendingOps |= w.ops
+				s.opWrites = append(s.opWrites, w)
+			} else {
+				s.queued = append(s.queued, w)
+				s.fill()
+				if len(s.pending) < s.maxData && !accumulating {
+					accumulate.Reset(s.accumulateInterval)
+					accumulating = true
+					break
+				}
+			}
+			err = s.sendNext(retransmit)
+		case <-accumulate.C:
+			accumulating = false
+			err = s.sendNext(retransmit)
+		case <-retransmit.C:
+			if s.inflight == nil {
+				break
+			}
+			s.attempts++
+			if s.attempts > s.retries {
+				err = ErrTimeout
+				break
+			}
+			err = s.transmit(retransmit)
+		case <-closing:
+			closing = nil
+			s.draining = true
+			err = s.sendNext(retransmit)
+		}
+
+		if err == nil && s.draining && s.inflight == nil && len(s.pending) == 0 && len(s.queued) == 0 {
+			err = io.EOF
+		}
+	}
+
+	retransmit.Stop()
+	accumulate.Stop()
+	s.fail(err)
+}
+
+// fill moves the queued characters to pending while there is room.
+func (s *SOLConn) fill() {
+	for len(s.queued) > 0 && len(s.pending) < solMaxPending {
+		s.pending = append(s.pending, s.queued[0].data...)
+		s.queued[0].done <- nil
+		s.queued[0] = nil
+		s.queued = s.queued[1:]
+	}
+}
+
+// sendNext sends the pending characters and operations unless a packet is
+// waiting for the acknowledgement.
+func (s *SOLConn) sendNext(retransmit *time.Timer) error {
+	if s.inflight != nil || (len(s.pending) == 0 && s.pendingOps == 0) {
+		return nil
+	}
+
+	n := len(s.pending)
+	if n > s.maxData {
+		n = s.maxData
+	}
+	s.outSeq = s.outSeq%15 + 1
+	s.inflight = &solPacket{Sequence: s.outSeq,
+		Status: s.pendingOps,
+		Data:   append([]byte(nil), s.pending[:n]...)}
+	s.pending = s.pending[n:]
+	s.pendingOps = 0
+	s.acked, s.opWrites = s.opWrites, nil
+	s.attempts = 0
+	s.fill()
+	return s.transmit(retransmit)
+}
+
+func (s *SOLConn) transmit(retransmit *time.Timer) error {
+	if err := s.send(s.ctx, s.inflight); err != nil {
+		return err
+	}
+	retransmit.Reset(s.retryInterval)
+	return nil
+}
+
+// receive handles a packet from the BMC, it is the acknowledgement of the
+// packet in flight and/or the characters from the serial console.
+func (s *SOLConn) receive(bs []byte, retransmit *time.Timer) error {
+	p, err := s.decode(bs)
+	if err != nil {
+		return nil // not a packet of the payload
+	}
+
+	if p.AckSequence != 0 && s.inflight != nil && p.AckSequence == s.inflight.Sequence {
+		if p.Status&solNACK != 0 && p.Status&solCharTransferUnavailable != 0 {
+			// the BMC can't accept characters now, the packet is sent
+			// again after the retry interval
+			s.attempts = 0
+		} else {
+			accepted := int(p.AcceptedCount)
+			if accepted > len(s.inflight.Data) {
+				accepted = len(s.inflight.Data)
+			}
+			// the characters not accepted are sent again in a new packet
+			s.pending = append(s.inflight.Data[accepted:], s.pending...)
+			for _, w := range s.acked {
+				w.done <- nil
+			}
+			s.acked = nil
+			s.inflight = nil
+			retransmit.Stop()
+			if err := s.sendNext(retransmit); err != nil {
+				return err
+			}
+		}
+	}
+
+	if p.Sequence != 0 {
+		ack := &solPacket{AckSequence: p.Sequence, AcceptedCount: uint8(len(p.Data))}
+		if p.Sequence != s.lastInSeq {
+			s.mu.Lock()
+			full := s.readBuf.Len() >= solMaxReadBuffer
+			if !full {
+				s.readBuf.Write(p.Data)
+				s.cond.Broadcast()
+			}
+			s.mu.Unlock()
+
+			if full {
+				// the BMC sends the packet again later
+				ack.AcceptedCount = 0
+				ack.Status = solNACK
+			} else {
+				s.lastInSeq = p.Sequence
+			}
+		}
+		if err := s.send(s.ctx, ack); err != nil {
+			return err
+		}
+	}
+
+	if p.Status&solDeactivating != 0 {
+		return io.EOF
+	}
+	return nil
+}
+
+// fail stops the SOLConn with err, the writes waiting in the loop fail.
+func (s *SOLConn) fail(err error) {
+	s.mu.Lock()
+	s.err = err
+	s.cond.Broadcast()
+	s.mu.Unlock()
+
+	werr := s.writeErr()
+	for _, w := range s.acked {
+		w.done <- werr
+	}
+	for _, w := range s.opWrites {
+		w.done <- werr
+	}
+	for _, w := range s.queued {
+		w.done <- werr
+	}
+	s.acked, s.opWrites, s.queued = nil, nil, nil
+}
+
+// ActivateSOL activates the SOL payload instance per section 24.1 and
+// returns the host serial console, it is a *SOLConn.
+func (c *Client) ActivateSOL(instance uint8) (io.ReadWriteCloser, error) {
+	return c.ActivateSOLContext(context.Background(), instance)
+}
+
+// ActivateSOLContext is like ActivateSOL but the activation returns when the
+// ctx is done.
+func (c *Client) ActivateSOLContext(ctx context.Context, instance uint8) (io.ReadWriteCloser, error) {
+	l, ok := c.transport.(*lanPlus)
+	if !ok {
+		return nil, ErrSOLUnsupported
+	}
+
+	// the packets sent by the BMC just after the activation aren't lost
+	w := l.addListener(matchPayloadType(PayloadSOL), solBufferedPackets)
+
+	req := ActivatePayloadRequest{PayloadType: uint8(PayloadSOL),
+		Instance: instance,
+		AuxData:  [4]uint8{solSerialAlertsDeferred}}
+	if l.integrityAlgorithm != RAKPAlgorithmIntegrity_None {
+		req.AuxData[0] |= 0x40
+	}
+	if l.confidentialityAlgorithm != RAKPAlgorithmEncryto_None {
+		req.AuxData[0] |= 0x80
+	}
+	var resp ActivatePayloadResponse
+	if err := c.ExecContext(ctx, commands.ActivatePayload, &req, &resp); err != nil {
+		l.removeWaiter(w)
+		if code, ok := err.(CompletionCode); ok && code == 0x80 {
+			return nil, ErrSOLActive
+		}
+		return nil, err
+	}
+
+	deactivate := func() error {
+		defer l.removeWaiter(w)
+		req := DeactivatePayloadRequest{PayloadType: uint8(PayloadSOL), Instance: instance}
+		return c.Exec(commands.DeactivatePayload, &req, nil)
+	}
+
+	if conn, _, _ := l.connection(); conn == nil {
+		deactivate()
+		return nil, ErrNotOpen
+	} else if addr, ok := conn.RemoteAddr().(*net.UDPAddr); ok &&
+		resp.PortNumber != 0 && int(resp.PortNumber) != addr.Port {
+		deactivate()
+		return nil, errors.New("SOL payload on the other UDP port is unsupported.")
+	}
+
+	s := newSOLConn(int(resp.InboundPayloadSize), l.sendSOL, l.decodeSOL, deactivate)
+	go s.run(w.c)
+	return s, nil
+}
+
+// sendSOL sends a SOL packet in the session, it isn't retransmitted. ctx is
+// of the SOLConn, which outlives the ctx of the activation.
+func (l *lanPlus) sendSOL(ctx context.Context, p *solPacket) error {
+	bs, err := l.ToBytes(p, make([]byte, 0, 512))
+	if err != nil {
+		return err
+	}
+	return l.sendPacket(ctx, bs)
+}
+
+func (l *lanPlus) decodeSOL(bs []byte) (*solPacket, error) {
+	var p solPacket
+	if err := l.FromBytes(&p, bs); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// matchPayloadType returns a func that reports whether a packet is a IPMI
+// v2.0 packet of the payload type.
+func matchPayloadType(payloadType PayloadType) func([]byte) bool {
+	return func(bs []byte) bool {
+		var rmcpHeader RMCPHeader
+		var ipmiHeader IPMIV2Header
+
+		var r Reader
+		r.Init(bs)
+
+		rmcpHeader.ReadBytes(&r)
+		if r.Err() != nil || rmcpHeader.Class != rmcpClassIPMI ||
+			r.Len() < 1 || r.Bytes()[0] != AuthTypeFormatIPMIV2 {
+			return false
+		}
+		ipmiHeader.ReadBytes(&r)
+		return r.Err() == nil && PayloadType(ipmiHeader.PayloadType).Value() == payloadType
+	}
+}
@@ -0,0 +1,221 @@
+package protocol
+
+import (
+	"context"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeSOL is the BMC side of a SOLConn, the packets sent by the SOLConn are
+// received from sent and the packets of the BMC are sent by reply.
+type fakeSOL struct {
+	t           *testing.T
+	s           *SOLConn
+	in          chan []byte
+	sent        chan *solPacket
+	deactivated int32
+}
+
+func newFakeSOL(t *testing.T, payloadSize int) *fakeSOL {
+	f := &fakeSOL{t: t, in: make(chan []byte, 16), sent: make(chan *solPacket, 64)}
+	f.s = newSOLConn(payloadSize, func(ctx context.Context, p *solPacket) error {
+		copied := *p
+		copied.Data = append([]byte(nil), p.Data...)
+		f.sent <- &copied
+		return nil
+	}, func(bs []byte) (*solPacket, error) {
+		var p solPacket
+		r := NewReader(bs)
+		p.ReadBytes(r)
+		return &p, r.Err()
+	}, func() error {
+		atomic.AddInt32(&f.deactivated, 1)
+		return nil
+	})
+	f.s.retryInterval = 50 * time.Millisecond
+	f.s.accumulateInterval = 10 * time.Millisecond
+	f.s.retries = 2
+	go f.s.run(f.in)
+	return f
+}
+
+func (f *fakeSOL) reply(p *solPacket) {
+	w := Writer{}
+	w.Init(nil)
+	p.WriteBytes(&w)
+	f.in <- w.Bytes()
+}
+
+func (f *fakeSOL) next() *solPacket {
+	select {
+	case p := <-f.sent:
+		return p
+	case <-time.After(time.Second):
+		f.t.Fatal("no packet is sent")
+		return nil
+	}
+}
+
+func (f *fakeSOL) write(s string) {
+	if _, e := f.s.Write([]byte(s)); e != nil {
+		f.t.Error(e)
+	}
+}
+
+func assertSOLPacket(t *testing.T, p *solPacket, sequence, status uint8, data string) {
+	assertEquals(t, "Sequence", p.Sequence, sequence)
+	assertEquals(t, "Status", p.Status, status)
+	assertEquals(t, "Data", string(p.Data), data)
+}
+
+func TestSOLOutbound(t *testing.T) {
+	f := newFakeSOL(t, 8) // 4 characters per packet
+
+	// the characters are accumulated
+	f.write("a")
+	f.write("b")
+	p := f.next()
+	assertSOLPacket(t, p, 1, 0, "ab")
+
+	// the characters written while a packet is in flight are sent after it
+	f.write("cdefgh")
+	f.reply(&solPacket{AckSequence: 1, AcceptedCount: 2})
+	assertSOLPacket(t, f.next(), 2, 0, "cdef")
+
+	// the characters not accepted are sent again
+	f.reply(&solPacket{AckSequence: 2, AcceptedCount: 1})
+	assertSOLPacket(t, f.next(), 3, 0, "defg")
+
+	// the packet is retransmitted until it is acknowledged
+	assertSOLPacket(t, f.next(), 3, 0, "defg")
+	f.reply(&solPacket{AckSequence: 3, AcceptedCount: 4})
+	assertSOLPacket(t, f.next(), 4, 0, "h")
+
+	// the packet is sent again if the BMC can't accept characters now
+	f.reply(&solPacket{AckSequence: 4, Status: solNACK | solCharTransferUnavailable})
+	for i := 0; i < 3; i++ {
+		assertSOLPacket(t, f.next(), 4, 0, "h")
+		f.reply(&solPacket{AckSequence: 4, Status: solNACK | solCharTransferUnavailable})
+	}
+	assertSOLPacket(t, f.next(), 4, 0, "h")
+	f.reply(&solPacket{AckSequence: 4, AcceptedCount: 1})
+
+	go func() {
+		p := f.next()
+		assertSOLPacket(t, p, 5, SOLGenerateBreak, "")
+		f.reply(&solPacket{AckSequence: p.Sequence})
+
+		p = f.next()
+		assertSOLPacket(t, p, 6, SOLFlushInbound|SOLFlushOutbound, "")
+		f.reply(&solPacket{AckSequence: p.Sequence})
+	}()
+	if e := f.s.SendBreak(); e != nil {
+		t.Error(e)
+	}
+	if e := f.s.Flush(); e != nil {
+		t.Error(e)
+	}
+
+	if e := f.s.Close(); e != nil {
+		t.Error(e)
+	}
+	assertEquals(t, "deactivated", atomic.LoadInt32(&f.deactivated), int32(1))
+	if _, e := f.s.Write([]byte("i")); e != ErrSOLClosed {
+		t.Error("excepted is", ErrSOLClosed, ", actual is", e)
+	}
+}
+
+func TestSOLSequenceWraps(t *testing.T) {
+	f := newFakeSOL(t, 5) // 1 character per packet
+	defer f.s.Close()
+
+	f.write("0123456789abcdefg")
+	for i := 0; i < 17; i++ {
+		p := f.next()
+		assertEquals(t, "Sequence", p.Sequence, uint8(i%15+1))
+		f.reply(&solPacket{AckSequence: p.Sequence, AcceptedCount: 1})
+	}
+}
+
+func TestSOLInbound(t *testing.T) {
+	f := newFakeSOL(t, 8)
+
+	f.reply(&solPacket{Sequence: 1, Data: []byte("hello")})
+	p := f.next()
+	assertEquals(t, "AckSequence", p.AckSequence, uint8(1))
+	assertEquals(t, "AcceptedCount", p.AcceptedCount, uint8(5))
+	assertSOLPacket(t, p, 0, 0, "")
+
+	// the retransmitted packet is acknowledged again and dropped
+	f.reply(&solPacket{Sequence: 1, Data: []byte("hello")})
+	assertEquals(t, "AckSequence", f.next().AckSequence, uint8(1))
+	f.reply(&solPacket{Sequence: 2, Data: []byte(" world"), Status: solDeactivating})
+	assertEquals(t, "AckSequence", f.next().AckSequence, uint8(2))
+
+	bs, e := readAll(f.s)
+	if e != nil {
+		t.Error(e)
+	}
+	assertEquals(t, "read", string(bs), "hello world")
+
+	if e := f.s.Close(); e != nil {
+		t.Error(e)
+	}
+	assertEquals(t, "deactivated", atomic.LoadInt32(&f.deactivated), int32(1))
+}
+
+func readAll(r io.Reader) ([]byte, error) {
+	var bs []byte
+	var buf [4]byte
+	for {
+		n, e := r.Read(buf[:])
+		bs = append(bs, buf[:n]...)
+		if e == io.EOF {
+			return bs, nil
+		}
+		if e != nil {
+			return bs, e
+		}
+	}
+}
+
+func TestSOLTimeout(t *testing.T) {
+	f := newFakeSOL(t, 8)
+
+	f.write("a")
+	for i := 0; i <= f.s.retries; i++ {
+		assertSOLPacket(t, f.next(), 1, 0, "a")
+	}
+
+	var buf [1]byte
+	if _, e := f.s.Read(buf[:]); e != ErrTimeout {
+		t.Error("excepted is", ErrTimeout, ", actual is", e)
+	}
+	if _, e := f.s.Write([]byte("b")); e != ErrTimeout {
+		t.Error("excepted is", ErrTimeout, ", actual is", e)
+	}
+	f.s.Close()
+}
+
+func TestSOLPacketOfLanPlus(t *testing.T) {
+	l := newLanPlus(&ConnectionOption{IntegrityAlgorithm: RAKPAlgorithmIntegrity_None,
+		ConfidentialityAlgorithm: RAKPAlgorithmEncryto_None})
+	l.RSessionID = 0x01020304
+
+	bs, e := l.ToBytes(&solPacket{Sequence: 3, AckSequence: 2, AcceptedCount: 1, Status: SOLGenerateBreak, Data: []byte("ab")}, nil)
+	if e != nil {
+		t.Fatal(e)
+	}
+	assertEquals(t, "packet", bs[4:], []byte{0x06, 0x01, 0x04, 0x03, 0x02, 0x01, 0x03, 0x00, 0x00, 0x00,
+		0x06, 0x00, 0x03, 0x02, 0x01, 0x10, 'a', 'b'})
+	assertEquals(t, "matchPayloadType", matchPayloadType(PayloadSOL)(bs), true)
+	assertEquals(t, "matchPayloadType", matchPayloadType(PayloadIPMI)(bs), false)
+
+	p, e := l.decodeSOL(append(bs, 0xff)) // trailer isn't the payload
+	if e != nil {
+		t.Fatal(e)
+	}
+	assertEquals(t, "packet", *p, solPacket{Sequence: 3, AckSequence: 2, AcceptedCount: 1, Status: SOLGenerateBreak, Data: []byte("ab")})
+}
@@ -0,0 +1,202 @@
+package goipmi
+
+import (
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+)
+
+// SDRCacheEntry is the SDR repository of a BMC, Records are the raw records
+// in the order of the repository as they are read, the empty records are
+// skipped so there may be less records than RecordCount. The timestamps and
+// the count are of the SDR repository info when the records are read, the
+// entry is valid while they aren't changed.
+type SDRCacheEntry struct {
+	RecentAddTimestamp uint32
+	RecentDelTimestamp uint32
+	RecordCount        uint16
+	Records            [][]byte
+}
+
+// IsValid returns true if the repository isn't changed since the entry is
+// stored.
+func (self *SDRCacheEntry) IsValid(info *GetSDRInfoResponse) bool {
+	return self.RecentAddTimestamp == info.RecentAddTimestamp &&
+		self.RecentDelTimestamp == info.RecentDelTimestamp &&
+		self.RecordCount == info.RecordCount
+}
+
+// SDRCache stores the SDR repositories of the BMCs by their keys, Load
+// returns nil if there isn't the entry of the key.
+type SDRCache interface {
+	Load(key string) (*SDRCacheEntry, error)
+	Store(key string, entry *SDRCacheEntry) error
+}
+
+// NewSDRMemoryCache returns a SDRCache that stores the entries in memory.
+func NewSDRMemoryCache() SDRCache {
+	return &sdrMemoryCache{entries: map[string]*SDRCacheEntry{}}
+}
+
+type sdrMemoryCache struct {
+	mu      sync.Mutex
+	entries map[string]*SDRCacheEntry
+}
+
+func (self *sdrMemoryCache) Load(key string) (*SDRCacheEntry, error) {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	return self.entries[key], nil
+}
+
+func (self *sdrMemoryCache) Store(key string, entry *SDRCacheEntry) error {
+	copyed := *entry
+	copyed.Records = make([][]byte, len(entry.Records))
+	for i, record := range entry.Records {
+		copyed.Records[i] = append([]byte(nil), record...)
+	}
+
+	self.mu.Lock()
+	defer self.mu.Unlock()
+	self.entries[key] = &copyed
+	return nil
+}
+
+// SDRCacheFormat is the file format of the SDR file cache.
+type SDRCacheFormat int
+
+const (
+	// SDRCacheBinary stores an entry in a file of a header and the records.
+	SDRCacheBinary SDRCacheFormat = iota
+
+	// SDRCacheDump stores the records in a file of the format of
+	// "ipmitool sdr dump", which is read by "ipmitool -S". The timestamps are
+	// stored in another file of the suffix ".info".
+	SDRCacheDump
+)
+
+// NewSDRFileCache returns a SDRCache that stores the entries in the files of
+// dir, the files are named by the keys.
+func NewSDRFileCache(dir string, format SDRCacheFormat) SDRCache {
+	return &sdrFileCache{dir: dir, format: format}
+}
+
+type sdrFileCache struct {
+	dir    string
+	format SDRCacheFormat
+}
+
+var sdrCacheMagic = []byte("SDRC\x01")
+
+const sdrCacheInfoSize = 10
+
+func (self *sdrFileCache) filename(key string) string {
+	return filepath.Join(self.dir, key+".sdr")
+}
+
+func (self *sdrFileCache) Load(key string) (*SDRCacheEntry, error) {
+	bs, err := ioutil.ReadFile(self.filename(key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var info []byte
+	if self.format == SDRCacheDump {
+		if info, err = ioutil.ReadFile(self.filename(key) + ".info"); err != nil {
+			if os.IsNotExist(err) {
+				return nil, nil
+			}
+			return nil, err
+		}
+	} else {
+		if len(bs) < len(sdrCacheMagic)+sdrCacheInfoSize || string(bs[:len(sdrCacheMagic)]) != string(sdrCacheMagic) {
+			return nil, errors.New("SDR cache '" + self.filename(key) + "' is invalid.")
+		}
+		info = bs[len(sdrCacheMagic) : len(sdrCacheMagic)+sdrCacheInfoSize]
+		bs = bs[len(sdrCacheMagic)+sdrCacheInfoSize:]
+	}
+	if len(info) != sdrCacheInfoSize {
+		return nil, errors.New("SDR cache '" + self.filename(key) + "' is invalid.")
+	}
+
+	entry := &SDRCacheEntry{
+		RecentAddTimestamp: binary.LittleEndian.Uint32(info),
+		RecentDelTimestamp: binary.LittleEndian.Uint32(info[4:]),
+		RecordCount:        binary.LittleEndian.Uint16(info[8:]),
+	}
+	if entry.Records, err = splitSDRRecords(bs); err != nil {
+		return nil, errors.New("SDR cache '" + self.filename(key) + "' is invalid, " + err.Error())
+	}
+	return entry, nil
+}
+
+func (self *sdrFileCache) Store(key string, entry *SDRCacheEntry) error {
+	info := make([]byte, sdrCacheInfoSize)
+	binary.LittleEndian.PutUint32(info, entry.RecentAddTimestamp)
+	binary.LittleEndian.PutUint32(info[4:], entry.RecentDelTimestamp)
+	binary.LittleEndian.PutUint16(info[8:], entry.RecordCount)
+
+	var bs []byte
+	if self.format != SDRCacheDump {
+		bs = append(append(bs, sdrCacheMagic...), info...)
+	}
+	for _, record := range entry.Records {
+		bs = append(bs, record...)
+	}
+
+	if err := writeFileAtomic(self.filename(key), bs); err != nil {
+		return err
+	}
+	if self.format == SDRCacheDump {
+		// the records are stored before the timestamps, so the records of
+		// the old timestamps are never loaded
+		return writeFileAtomic(self.filename(key)+".info", info)
+	}
+	return nil
+}
+
+// writeFileAtomic writes data to a temporary file and renames it to
+// filename, so that a partial file is never read.
+func writeFileAtomic(filename string, data []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(filename), filepath.Base(filename)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(data); err == nil {
+		err = f.Close()
+	} else {
+		f.Close()
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), filename)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// splitSDRRecords splits the records that are concatenated as in
+// "ipmitool sdr dump", the length of a record is in its header.
+func splitSDRRecords(bs []byte) ([][]byte, error) {
+	var records [][]byte
+	for len(bs) > 0 {
+		if len(bs) < 5 {
+			return nil, errors.New("the SDR record header is truncated.")
+		}
+		length := 5 + int(bs[4])
+		if len(bs) < length {
+			return nil, errors.New("the SDR record " + strconv.Itoa(int(bs[0])|int(bs[1])<<8) + " is truncated.")
+		}
+		records = append(records, bs[:length:length])
+		bs = bs[length:]
+	}
+	return records, nil
+}
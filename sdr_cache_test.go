@@ -0,0 +1,219 @@
+package goipmi
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/runner-mei/goipmi/protocol"
+	"github.com/runner-mei/goipmi/protocol/commands"
+)
+
+func testSDRRecords() [][]byte {
+	temp1 := []byte{0x0f, 0x00, 0x51, 0x01, 0x3b, 0x20, 0x00, 0x0d, 0x27, 0x01, 0x23, 0xc9, 0x01, 0x01, 0x00, 0x0a,
+		0x00, 0x60, 0x30, 0x00, 0x80, 0x01, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x7f, 0x81, 0x2d, 0x29, 0x27, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xc6,
+		0x54, 0x65, 0x6d, 0x70, 0x20, 0x31, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
+	temp2 := append([]byte(nil), temp1...)
+	temp2[0] = 0x10
+	temp2[7] = 0x0e
+	temp2[53] = '2'
+	return [][]byte{temp1, temp2}
+}
+
+// fakeSDR is a BMC of the SDR repository, addTimestamp is returned by the
+// Get SDR Repository Info command.
+func fakeSDR(records [][]byte, addTimestamp *uint32) *fakeHandler {
+	return &fakeHandler{handle: func(cmd commands.CommandCode, req []byte) (protocol.CompletionCode, []byte) {
+		switch cmd {
+		case GetDeviceID:
+			return protocol.CommandCompleted, []byte{0x20, 0x01, 0x02, 0x00, 0x02, 0xbf, 0x57, 0x01, 0x00, 0x34, 0x12}
+		case GetDeviceGUID:
+			return protocol.CommandCompleted, []byte{0x33, 0x22, 0x11, 0x00, 0x55, 0x44, 0x77, 0x66,
+				0x88, 0x99, 0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}
+		case GetSDRRepositoryInfo:
+			ts := *addTimestamp
+			return protocol.CommandCompleted, []byte{0x51, uint8(len(records)), 0x00, 0x00, 0x10,
+				uint8(ts), uint8(ts >> 8), uint8(ts >> 16), uint8(ts >> 24), 0x00, 0x00, 0x00, 0x00, 0x02}
+		case ReserveSDRRepository:
+			return protocol.CommandCompleted, []byte{0x01, 0x00}
+		case GetSDR:
+			// the record 0 is the first record
+			id := int(req[2]) | int(req[3])<<8
+			for i, record := range records {
+				if id != 0 && int(record[0])|int(record[1])<<8 != id {
+					continue
+				}
+				next := []byte{0xff, 0xff}
+				if i+1 < len(records) {
+					next = records[i+1][:2]
+				}
+				end := int(req[4]) + int(req[5])
+				if end > len(record) {
+					end = len(record)
+				}
+				return protocol.CommandCompleted, append(append([]byte(nil), next...), record[req[4]:end]...)
+			}
+			return protocol.ErrNoObj, nil
+		default:
+			return protocol.ErrInvalidCommand, nil
+		}
+	}}
+}
+
+func countRequests(h *fakeHandler, cmd commands.CommandCode) int {
+	count := 0
+	for _, req := range h.requests {
+		if req.cmd == cmd {
+			count++
+		}
+	}
+	return count
+}
+
+func TestListSDRCached(t *testing.T) {
+	ts := uint32(100)
+	h := fakeSDR(testSDRRecords(), &ts)
+	c := &Client{ClientHandler: h}
+	cache := NewSDRMemoryCache()
+
+	key, e := c.SDRCacheKey()
+	if e != nil {
+		t.Fatal(e)
+	}
+	assertEquals(t, "key", key, "1-4660-32-00112233-4455-6677-8899-aabbccddeeff")
+
+	records, e := c.ListSDRCached(cache)
+	if e != nil {
+		t.Fatal(e)
+	}
+	assertEquals(t, "records", len(records), 2)
+	assertEquals(t, "name", records[1].(*FullSensorRecord).IdString, "Temp 2")
+	reads := countRequests(h, GetSDR)
+
+	// the repository isn't changed
+	cached, e := c.ListSDRCached(cache)
+	if e != nil {
+		t.Fatal(e)
+	}
+	assertEquals(t, "cached", cached, records)
+	assertEquals(t, "reads", countRequests(h, GetSDR), reads)
+
+	// a record is added
+	ts++
+	if _, e = c.ListSDRCached(cache); e != nil {
+		t.Fatal(e)
+	}
+	assertEquals(t, "reads", countRequests(h, GetSDR), 2*reads)
+}
+
+func TestListSDRCachedNoGUID(t *testing.T) {
+	ts := uint32(100)
+	h := fakeSDR(testSDRRecords(), &ts)
+	handle := h.handle
+	h.handle = func(cmd commands.CommandCode, req []byte) (protocol.CompletionCode, []byte) {
+		if cmd == GetDeviceGUID {
+			return protocol.ErrInvalidCommand, nil
+		}
+		return handle(cmd, req)
+	}
+	c := &Client{ClientHandler: h}
+	cache := NewSDRMemoryCache()
+
+	key, e := c.SDRCacheKey()
+	if e != nil {
+		t.Fatal(e)
+	}
+	assertEquals(t, "key", key, "")
+
+	// the BMCs of the same product share a key without the GUID
+	reads := 0
+	for i := 1; i <= 2; i++ {
+		records, e := c.ListSDRCached(cache)
+		if e != nil {
+			t.Fatal(e)
+		}
+		assertEquals(t, "records", len(records), 2)
+		if i == 1 {
+			reads = countRequests(h, GetSDR)
+		}
+	}
+	assertEquals(t, "reads", countRequests(h, GetSDR), 2*reads)
+	if entry, _ := cache.Load(""); entry != nil {
+		t.Error("excepted is nil, actual is", entry)
+	}
+}
+
+// failedSDRCache is a SDRCache that can't be written.
+type failedSDRCache struct{}
+
+func (failedSDRCache) Load(key string) (*SDRCacheEntry, error) { return nil, nil }
+func (failedSDRCache) Store(key string, entry *SDRCacheEntry) error {
+	return errors.New("the cache is read-only.")
+}
+
+func TestListSDRCachedStoreFailed(t *testing.T) {
+	ts := uint32(100)
+	c := &Client{ClientHandler: fakeSDR(testSDRRecords(), &ts)}
+	records, e := c.ListSDRCached(failedSDRCache{})
+	if e != nil {
+		t.Fatal(e)
+	}
+	assertEquals(t, "records", len(records), 2)
+}
+
+func TestSDRCacheEntryIsValid(t *testing.T) {
+	// the empty records are skipped
+	entry := &SDRCacheEntry{RecentAddTimestamp: 100, RecentDelTimestamp: 200,
+		RecordCount: 3, Records: testSDRRecords()}
+	info := &GetSDRInfoResponse{RecentAddTimestamp: 100, RecentDelTimestamp: 200, RecordCount: 3}
+	assertEquals(t, "valid", entry.IsValid(info), true)
+
+	info.RecordCount = 2
+	assertEquals(t, "count", entry.IsValid(info), false)
+	info.RecordCount = 3
+	info.RecentDelTimestamp = 201
+	assertEquals(t, "deleted", entry.IsValid(info), false)
+}
+
+func TestSDRFileCache(t *testing.T) {
+	dir, e := ioutil.TempDir("", "sdr")
+	if e != nil {
+		t.Fatal(e)
+	}
+	defer os.RemoveAll(dir)
+
+	entry := &SDRCacheEntry{RecentAddTimestamp: 100, RecentDelTimestamp: 200,
+		RecordCount: 2, Records: testSDRRecords()}
+	for _, format := range []SDRCacheFormat{SDRCacheBinary, SDRCacheDump} {
+		cache := NewSDRFileCache(dir, format)
+		key := "bmc" + string('0'+rune(format))
+		if loaded, e := cache.Load(key); e != nil || loaded != nil {
+			t.Error("excepted is nil, actual is", loaded, e)
+		}
+		if e = cache.Store(key, entry); e != nil {
+			t.Fatal(e)
+		}
+		loaded, e := cache.Load(key)
+		if e != nil {
+			t.Fatal(e)
+		}
+		assertEquals(t, "entry", loaded, entry)
+	}
+
+	// the dump file is the records as "ipmitool sdr dump"
+	bs, e := ioutil.ReadFile(dir + "/bmc1.sdr")
+	if e != nil {
+		t.Fatal(e)
+	}
+	records := testSDRRecords()
+	assertEquals(t, "dump", bs, append(records[0], records[1]...))
+
+	if e = ioutil.WriteFile(dir+"/bmc0.sdr", bs, 0644); e != nil {
+		t.Fatal(e)
+	}
+	if _, e = NewSDRFileCache(dir, SDRCacheBinary).Load("bmc0"); e == nil {
+		t.Error("excepted is invalid error")
+	}
+}
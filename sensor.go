@@ -0,0 +1,199 @@
+package goipmi
+
+import (
+	"strconv"
+)
+
+// SensorStatus is the status of the sensor as "ipmitool sensor list".
+type SensorStatus string
+
+const (
+	SensorStatusOK             SensorStatus = "ok"
+	SensorStatusNonCritical    SensorStatus = "nc"
+	SensorStatusCritical       SensorStatus = "cr"
+	SensorStatusNonRecoverable SensorStatus = "nr"
+	SensorStatusNotAvailable   SensorStatus = "ns"
+)
+
+// SensorThresholds are the converted thresholds of the sensor, a threshold
+// is nil if it isn't readable.
+type SensorThresholds struct {
+	LowerNonRecoverable *float64
+	LowerCritical       *float64
+	LowerNonCritical    *float64
+	UpperNonCritical    *float64
+	UpperCritical       *float64
+	UpperNonRecoverable *float64
+}
+
+// Sensor is a sensor of the SDR repository with its reading.
+type Sensor struct {
+	Record                 Record
+	Name                   string
+	Owner                  Target
+	Number                 uint8
+	EntityId               uint8
+	EntityInstance         uint8
+	Type                   uint8
+	EventOrReadingTypeCode uint8
+	Units                  SensorUnits
+
+	// Reading is the raw reading, Value is the converted reading if HasValue
+	// is true, only the full records of the analog sensors are converted.
+	// The value is in [ValueLower, ValueUpper] per the tolerance and the
+	// accuracy of the sensor.
+	Reading    uint8
+	Value      float64
+	ValueLower float64
+	ValueUpper float64
+	HasValue   bool
+
+	// States are the threshold comparison status bits of the threshold
+	// sensors, or the asserted states of the discrete sensors, StateNames
+	// are the names of the asserted states of the discrete sensors.
+	States     uint16
+	StateNames []string
+	Thresholds SensorThresholds
+	Status     SensorStatus
+
+	// Error is the error of reading the sensor, the status is "ns" if the
+	// reading is unavailable, or the error of converting the reading, then
+	// HasValue is false.
+	Error error
+}
+
+// TypeName returns the name of the sensor type.
+func (self *Sensor) TypeName() string {
+	return SensorTypeName(self.Type)
+}
+
+// IsThreshold returns true if the sensor is a threshold sensor.
+func (self *Sensor) IsThreshold() bool {
+	return self.EventOrReadingTypeCode == 1
+}
+
+// ValueString returns the reading as "ipmitool sensor list", it is the
+// converted reading with the unit, or the states of a discrete sensor, or "na"
+// if there isn't a reading.
+func (self *Sensor) ValueString() string {
+	if self.Status == SensorStatusNotAvailable {
+		return "na"
+	}
+	if self.HasValue {
+		return self.Units.FormatReading(self.Value)
+	}
+	if self.IsThreshold() {
+		return "na"
+	}
+	return "0x" + strconv.FormatUint(uint64(self.States), 16)
+}
+
+// newSensor returns the sensor of the instance.
+func newSensor(instance SensorInstance) Sensor {
+	sensor := Sensor{Record: instance.Record,
+		Name:           instance.Name,
+		Owner:          instance.Owner,
+		Number:         instance.Number,
+		EntityInstance: instance.EntityInstance,
+	}
+	switch rec := instance.Record.(type) {
+	case *FullSensorRecord:
+		sensor.EntityId = rec.EntityId
+		sensor.Type = rec.SensorType
+		sensor.EventOrReadingTypeCode = rec.EventOrReadingTypeCode
+		sensor.Units = rec.Units()
+	case *CompactSensorRecord:
+		sensor.EntityId = rec.EntityId
+		sensor.Type = rec.Type
+		sensor.EventOrReadingTypeCode = rec.EventOrReadingTypeCode
+		sensor.Units = rec.Units()
+	case *EventOnlyRecord:
+		sensor.EntityId = rec.EntityId
+		sensor.Type = rec.Type
+		sensor.EventOrReadingTypeCode = rec.EventOrReadingTypeCode
+		sensor.Status = SensorStatusNotAvailable
+	}
+	return sensor
+}
+
+// setReading sets the reading and the status of the sensor.
+func (self *Sensor) setReading(res *GetSensorReadingResponse) {
+	self.Reading = res.Reading
+	self.States = uint16(res.Flags[1])
+	if len(res.Flags) >= 3 {
+		self.States |= uint16(res.Flags[2]&0x7f) << 8
+	}
+
+	self.Status = SensorStatusOK
+	if !self.IsThreshold() {
+		self.StateNames = res.DiscreteStates(self.EventOrReadingTypeCode, self.Type)
+	} else {
+		self.States &= 0x3f
+		switch {
+		case self.States&(ThresholdLowerNonRecoverable|ThresholdUpperNonRecoverable) != 0:
+			self.Status = SensorStatusNonRecoverable
+		case self.States&(ThresholdLowerCritical|ThresholdUpperCritical) != 0:
+			self.Status = SensorStatusCritical
+		case self.States&(ThresholdLowerNonCritical|ThresholdUpperNonCritical) != 0:
+			self.Status = SensorStatusNonCritical
+		}
+	}
+}
+
+// setValue converts the reading of the full record, factors returns the
+// factors of a reading of the non-linear sensor.
+func (self *Sensor) setValue(full *FullSensorRecord, factors func(raw uint8) (*GetSensorReadingFactorsResponse, error)) {
+	f, err := factors(self.Reading)
+	if err != nil {
+		self.Error = err
+		return
+	}
+	value, err := calcSensorValue(full, self.Reading, f)
+	if err != nil {
+		self.Error = err
+		return
+	}
+	self.Value = value
+	self.HasValue = true
+	if self.ValueLower, self.ValueUpper, err = full.ErrorBand(int32(self.Reading), 8, f); err != nil {
+		self.ValueLower, self.ValueUpper = value, value
+	}
+}
+
+// setThresholds converts the thresholds of the full record.
+func (self *Sensor) setThresholds(full *FullSensorRecord, res *GetSensorThresholdsResponse,
+	factors func(raw uint8) (*GetSensorReadingFactorsResponse, error)) {
+	convert := func(readable bool, raw uint8) *float64 {
+		if !readable {
+			return nil
+		}
+		f, err := factors(raw)
+		if err != nil {
+			return nil
+		}
+		value, err := calcSensorValue(full, raw, f)
+		if err != nil {
+			return nil
+		}
+		return &value
+	}
+
+	self.Thresholds = SensorThresholds{
+		LowerNonRecoverable: convert(res.HasLowerNonrecoverableThreshold(), res.LowerNonrecoverableThreshold),
+		LowerCritical:       convert(res.HasLowerCriticalThreshold(), res.LowerCriticalThreshold),
+		LowerNonCritical:    convert(res.HasLowerNonCriticalThreshold(), res.LowerNonCriticalThreshold),
+		UpperNonCritical:    convert(res.HasUpperNonCriticalThreshold(), res.UpperNonCriticalThreshold),
+		UpperCritical:       convert(res.HasUpperCriticalThreshold(), res.UpperCriticalThreshold),
+		UpperNonRecoverable: convert(res.HasUpperNonrecoverableThreshold(), res.UpperNonrecoverableThreshold),
+	}
+}
+
+// calcSensorValue converts the raw value of the full record with the factors
+// of the non-linear sensor, or with the factors of the record if factors is
+// nil.
+func calcSensorValue(full *FullSensorRecord, raw uint8, factors *GetSensorReadingFactorsResponse) (float64, error) {
+	if factors != nil {
+		return full.CalcWithFactors(int32(raw), 8, factors)
+	}
+	return full.Calc(int32(raw), 8)
+}
@@ -0,0 +1,345 @@
+package goipmi
+
+import (
+	"math"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/runner-mei/goipmi/protocol"
+	"github.com/runner-mei/goipmi/protocol/commands"
+)
+
+func testSensorRecords(t *testing.T) []Record {
+	var full FullSensorRecord
+	r := protocol.NewReader(testSDRRecords()[0])
+	full.ReadBytes(r)
+	if r.Err() != nil {
+		t.Fatal(r.Err())
+	}
+	return []Record{
+		&full,
+		// PSU1 and PSU2 share the record
+		&CompactSensorRecord{SensorOwnerId: 0x20, SensorNumber: 0x30, EntityId: 0x0a, EntityInstance: 0x01,
+			Type: SENSOR_POWERSUPPLY, EventOrReadingTypeCode: 0x6f, IdString: "PSU",
+			SensorRecordSharing: 2, IdStringInstanceModifierOffset: 1},
+		&EventOnlyRecord{SensorOwnerId: 0x20, SensorNumber: 0x40, EntityId: 0x07, EntityInstance: 0x01,
+			Type: SENSOR_WATCHDOG2, EventOrReadingTypeCode: 0x6f, IdString: "Watchdog"},
+		&OEMRecord{},
+	}
+}
+
+func TestReadSensors(t *testing.T) {
+	// the temperature is 85, which is above the upper critical threshold 80
+	h := &fakeHandler{handle: func(cmd commands.CommandCode, req []byte) (protocol.CompletionCode, []byte) {
+		switch {
+		case cmd == GetSensorReading && req[0] == 0x0d:
+			return protocol.CommandCompleted, []byte{85, 0xc0, 0x18, 0x80}
+		case cmd == GetSensorReading && req[0] == 0x30:
+			return protocol.CommandCompleted, []byte{0x00, 0xc0, 0x01, 0x80}
+		case cmd == GetSensorReading && req[0] == 0x31:
+			return protocol.CommandCompleted, []byte{0x00, 0xc0, 0x03, 0x80}
+		case cmd == GetSensorThresholds && req[0] == 0x0d:
+			return protocol.CommandCompleted, []byte{0x30, 0x00, 0x00, 0x00, 0x00, 80, 90}
+		default:
+			return protocol.ErrInvalidCommand, nil
+		}
+	}}
+	c := &Client{ClientHandler: h}
+
+	sensors, e := c.ReadSensors(testSensorRecords(t))
+	if e != nil {
+		t.Fatal(e)
+	}
+	assertEquals(t, "sensors", len(sensors), 4)
+
+	temp := sensors[0]
+	assertEquals(t, "Name", temp.Name, "Temp 1")
+	assertEquals(t, "TypeName", temp.TypeName(), "Temperature")
+	assertEquals(t, "Value", temp.ValueString(), "85 degrees C")
+	assertEquals(t, "Status", temp.Status, SensorStatusCritical)
+	if temp.Thresholds.UpperCritical == nil || *temp.Thresholds.UpperCritical != 80 ||
+		temp.Thresholds.UpperNonRecoverable == nil || *temp.Thresholds.UpperNonRecoverable != 90 {
+		t.Error("excepted is upper thresholds 80 and 90, actual is", temp.Thresholds)
+	}
+	if temp.Thresholds.LowerCritical != nil {
+		t.Error("excepted is no lower threshold, actual is", *temp.Thresholds.LowerCritical)
+	}
+
+	psu := sensors[1]
+	assertEquals(t, "Name", psu.Name, "PSU1")
+	assertEquals(t, "Status", psu.Status, SensorStatusOK)
+	assertEquals(t, "States", psu.States, uint16(0x01))
+	assertEquals(t, "StateNames", psu.StateNames, []string{"Presence detected"})
+	assertEquals(t, "Value", psu.ValueString(), "0x1")
+
+	psu = sensors[2]
+	assertEquals(t, "Name", psu.Name, "PSU2")
+	assertEquals(t, "Number", psu.Number, uint8(0x31))
+	assertEquals(t, "EntityInstance", psu.EntityInstance, uint8(2))
+	assertEquals(t, "StateNames", psu.StateNames, []string{"Presence detected", "Power Supply Failure detected"})
+
+	watchdog := sensors[3]
+	assertEquals(t, "Status", watchdog.Status, SensorStatusNotAvailable)
+	assertEquals(t, "Value", watchdog.ValueString(), "na")
+	for _, req := range h.requests {
+		if req.data[0] == 0x40 {
+			t.Error("the event-only sensor is read")
+		}
+	}
+}
+
+func TestSensorStatus(t *testing.T) {
+	for _, test := range []struct {
+		flags    []byte
+		excepted SensorStatus
+	}{
+		{flags: []byte{0xc0, 0x00}, excepted: SensorStatusOK},
+		{flags: []byte{0xc0, 0x01}, excepted: SensorStatusNonCritical},
+		{flags: []byte{0xc0, 0x09}, excepted: SensorStatusNonCritical},
+		{flags: []byte{0xc0, 0x03}, excepted: SensorStatusCritical},
+		{flags: []byte{0xc0, 0x38}, excepted: SensorStatusNonRecoverable},
+		{flags: []byte{0xc0, 0x04}, excepted: SensorStatusNonRecoverable},
+	} {
+		sensor := Sensor{EventOrReadingTypeCode: 1}
+		sensor.setReading(&GetSensorReadingResponse{Flags: test.flags})
+		assertEquals(t, "Status", sensor.Status, test.excepted)
+	}
+}
+
+func TestSensorInstances(t *testing.T) {
+	records := []Record{
+		&EventOnlyRecord{SensorNumber: 0x10, EntityInstance: 0x05, IdString: "Slot ",
+			SensorRecordSharing: 3, IdStringInstanceModifierType: 1, IdStringInstanceModifierOffset: 25,
+			EntityInstanceSharing: true},
+		&CompactSensorRecord{SensorNumber: 0x20, IdString: "CPU", SensorRecordSharing: 1},
+	}
+	var names []string
+	for _, instance := range SensorInstances(records) {
+		names = append(names, instance.Name)
+		if instance.Record == records[0] && instance.EntityInstance != 5 {
+			t.Error("excepted is the same entity instance, actual is", instance.EntityInstance)
+		}
+	}
+	assertEquals(t, "names", names, []string{"Slot Z", "Slot AA", "Slot AB", "CPU"})
+}
+
+func TestListSDRReading(t *testing.T) {
+	h := &fakeHandler{handle: func(cmd commands.CommandCode, req []byte) (protocol.CompletionCode, []byte) {
+		return protocol.CommandCompleted, []byte{req[0], 0xc0, 0x00}
+	}}
+	c := &Client{ClientHandler: h}
+
+	instances, readings, e := c.ListSDRReading(testSensorRecords(t))
+	if e != nil {
+		t.Fatal(e)
+	}
+	assertEquals(t, "instances", len(instances), 3)
+	for i, instance := range instances {
+		if readings[i].Error != nil || readings[i].Response.Reading != instance.Number {
+			t.Error("the reading of", instance.Name, "is", readings[i])
+		}
+	}
+
+	// the compact records are read by the sweep of the full records too
+	full, fullReadings, e := c.ListFullSDRReading(testSensorRecords(t))
+	if e != nil {
+		t.Fatal(e)
+	}
+	assertEquals(t, "full", full, instances)
+	assertEquals(t, "full readings", fullReadings, readings)
+}
+
+func TestListSDRReadingWindow(t *testing.T) {
+	// the sensors are read by as many workers as the session window, it is 1
+	// for the handlers other than protocol.Client
+	var outstanding, max int32
+	h := &fakeHandler{handle: func(cmd commands.CommandCode, req []byte) (protocol.CompletionCode, []byte) {
+		n := atomic.AddInt32(&outstanding, 1)
+		defer atomic.AddInt32(&outstanding, -1)
+		for m := atomic.LoadInt32(&max); n > m && !atomic.CompareAndSwapInt32(&max, m, n); m = atomic.LoadInt32(&max) {
+		}
+		time.Sleep(time.Millisecond)
+		return protocol.CommandCompleted, []byte{req[0], 0xc0, 0x00}
+	}}
+	c := &Client{ClientHandler: h}
+
+	var records []Record
+	for i := 0; i < 32; i++ {
+		records = append(records, &CompactSensorRecord{SensorNumber: uint8(i), IdString: "Fan"})
+	}
+	instances, readings, e := c.ListSDRReading(records)
+	if e != nil {
+		t.Fatal(e)
+	}
+	assertEquals(t, "readings", len(readings), len(instances))
+	for i, instance := range instances {
+		if readings[i].Error != nil || readings[i].Response.Reading != instance.Number {
+			t.Error("the reading of", instance.Name, "is", readings[i])
+		}
+	}
+	assertEquals(t, "outstanding", atomic.LoadInt32(&max), int32(1))
+
+	if _, e := c.ReadSensors(records); e != nil {
+		t.Fatal(e)
+	}
+	assertEquals(t, "outstanding", atomic.LoadInt32(&max), int32(1))
+}
+
+func TestSetSensorThresholds(t *testing.T) {
+	h := &fakeHandler{handle: func(cmd commands.CommandCode, req []byte) (protocol.CompletionCode, []byte) {
+		return protocol.CommandCompleted, nil
+	}}
+	c := &Client{ClientHandler: h}
+
+	fan := &FullSensorRecord{SensorOwnerId: 0x20, SensorNumber: 0x50, M: 75, IdString: "FAN1",
+		SensorCapablilities: 0x68}
+	fan.Masks[4] = ThresholdLowerCritical | ThresholdLowerNonCritical
+	fan.Masks[5] = ThresholdLowerCritical | ThresholdLowerNonCritical
+
+	lnc, lc := 1500.0, 1200.0
+	if e := c.SetSensorThresholds(fan, SensorThresholds{LowerNonCritical: &lnc, LowerCritical: &lc}); e != nil {
+		t.Fatal(e)
+	}
+	assertEquals(t, "request", h.requests[0].data, []byte{0x50, 0x03, 20, 16, 0, 0, 0, 0})
+
+	uc := 6000.0
+	if e := c.SetSensorThresholds(fan, SensorThresholds{UpperCritical: &uc}); e == nil ||
+		e.Error() != "the upper critical threshold of 'FAN1' isn't settable." {
+		t.Error("excepted is not settable error, actual is", e)
+	}
+	assertEquals(t, "requests", len(h.requests), 1)
+
+	if e := c.SetSensorHysteresis(fan, 150, 75); e != nil {
+		t.Fatal(e)
+	}
+	assertEquals(t, "request", h.requests[1].data, []byte{0x50, 0xff, 2, 1})
+	fan.SensorCapablilities = 0x58
+	if e := c.SetSensorHysteresis(fan, 150, 75); e == nil {
+		t.Error("excepted is not settable error")
+	}
+
+	if e := c.SetSensorEventEnable(Target{}, &SetSensorEventEnableRequest{Number: 0x50,
+		Flags:           SensorAllEventsEnabled | SensorScanningEnabled | SensorDisableSelectedEvents,
+		AssertionEvents: 0x0201}); e != nil {
+		t.Fatal(e)
+	}
+	assertEquals(t, "request", h.requests[2].data, []byte{0x50, 0xe0, 0x01, 0x02, 0x00, 0x00})
+
+	if e := c.RearmSensorEvents(Target{}, &RearmSensorEventsRequest{Number: 0x50, All: true}); e != nil {
+		t.Fatal(e)
+	}
+	assertEquals(t, "request", h.requests[3].data, []byte{0x50, 0x00})
+	assertEquals(t, "cmd", h.requests[3].cmd, ReArmSensorEvents)
+}
+
+func TestNonLinearSensor(t *testing.T) {
+	// (2x + 10) * 0.1 up to the reading 104, the tolerance is +/- 2 counts
+	// and the accuracy is 0.5%
+	factors := []byte{105, 0x02, 0x04, 0x0a, 0x32, 0x00, 0xf0}
+	h := &fakeHandler{handle: func(cmd commands.CommandCode, req []byte) (protocol.CompletionCode, []byte) {
+		switch cmd {
+		case GetSensorReading:
+			return protocol.CommandCompleted, []byte{100, 0xc0, 0x00}
+		case GetSensorThresholds:
+			// the upper critical threshold is 104
+			return protocol.CommandCompleted, []byte{0x10, 0x00, 0x00, 0x00, 0x00, 104, 0x00}
+		case GetSensorReadingFactors:
+			return protocol.CommandCompleted, factors
+		default:
+			return protocol.ErrInvalidCommand, nil
+		}
+	}}
+	c := &Client{ClientHandler: h}
+
+	record := &FullSensorRecord{SensorOwnerId: 0x20, SensorNumber: 0x60, SensorType: SENSOR_VOLTAGE,
+		EventOrReadingTypeCode: 1, SensorUnits2: SENSOR_UNIT_VOLTS, Linearization: 0x70}
+	record.Masks[4] = 0x10
+	if _, e := record.Calc(100, 8); e != ErrNonLinearSensor {
+		t.Error("excepted is", ErrNonLinearSensor, ", actual is", e)
+	}
+	if _, _, e := record.ErrorBand(100, 8, nil); e != ErrNonLinearSensor {
+		t.Error("excepted is", ErrNonLinearSensor, ", actual is", e)
+	}
+
+	sensors, e := c.ReadSensors([]Record{record})
+	if e != nil {
+		t.Fatal(e)
+	}
+	sensor := sensors[0]
+	if sensor.Error != nil {
+		t.Fatal(sensor.Error)
+	}
+	assertEquals(t, "Value", sensor.ValueString(), "21 Volts")
+	if math.Abs(sensor.ValueLower-20.495) > 1e-9 || math.Abs(sensor.ValueUpper-21.505) > 1e-9 {
+		t.Error("excepted is [20.495, 21.505], actual is", sensor.ValueLower, sensor.ValueUpper)
+	}
+	if sensor.Thresholds.UpperCritical == nil || math.Abs(*sensor.Thresholds.UpperCritical-21.8) > 1e-9 {
+		t.Error("excepted is 21.8, actual is", sensor.Thresholds.UpperCritical)
+	}
+	// the factors of 100 are cached for the threshold 104 while the sensors
+	// are read
+	assertEquals(t, "factors", countRequests(h, GetSensorReadingFactors), 1)
+	assertEquals(t, "request", h.requests[1].data, []byte{0x60, 100})
+
+	value, e := c.CalcSensorReading(record, 110)
+	if e != nil {
+		t.Fatal(e)
+	}
+	assertEquals(t, "value", math.Round(value*1000)/1000, 23.0)
+	assertEquals(t, "factors", countRequests(h, GetSensorReadingFactors), 2)
+
+	// the records are plain data, the factors are read by the client
+	f, e := c.GetSensorReadingFactors(record, 104)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if value, e = record.CalcWithFactors(104, 8, f); e != nil {
+		t.Fatal(e)
+	}
+	assertEquals(t, "value", math.Round(value*1000)/1000, 21.8)
+	assertEquals(t, "factors", countRequests(h, GetSensorReadingFactors), 3)
+}
+
+func TestNonLinearSensorRecord(t *testing.T) {
+	records := testSDRRecords()
+	records[0][23] = 0x70 // non-linear
+	ts := uint32(100)
+	h := fakeSDR(records, &ts)
+	handle := h.handle
+	h.handle = func(cmd commands.CommandCode, req []byte) (protocol.CompletionCode, []byte) {
+		if cmd == GetSensorReadingFactors {
+			// 2x + 10 up to the reading 104
+			return protocol.CommandCompleted, []byte{105, 0x02, 0x00, 0x0a, 0x00, 0x00, 0x00}
+		}
+		return handle(cmd, req)
+	}
+	c := &Client{ClientHandler: h}
+
+	listed, e := c.ListSDRCached(NewSDRMemoryCache())
+	if e != nil {
+		t.Fatal(e)
+	}
+	record := listed[0].(*FullSensorRecord)
+	if _, e := record.Calc(100, 8); e != ErrNonLinearSensor {
+		t.Error("excepted is", ErrNonLinearSensor, ", actual is", e)
+	}
+	assertEquals(t, "factors", countRequests(h, GetSensorReadingFactors), 0)
+
+	value, e := c.CalcSensorReading(record, 100)
+	if e != nil {
+		t.Fatal(e)
+	}
+	assertEquals(t, "value", value, 210.0)
+	assertEquals(t, "factors", countRequests(h, GetSensorReadingFactors), 1)
+
+	factors, e := c.GetSensorReadingFactors(record, 100)
+	if e != nil {
+		t.Fatal(e)
+	}
+	lower, upper, e := record.ErrorBand(100, 8, factors)
+	if e != nil {
+		t.Fatal(e)
+	}
+	assertEquals(t, "band", []float64{lower, upper}, []float64{210.0, 210.0})
+}